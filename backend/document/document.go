@@ -59,6 +59,8 @@ type Page struct {
 	Objectnumber      pdf.Objectnumber
 	nextMCID          int
 	pageIndex         int // index of this page in PDFDocument.Pages
+	extGStates        map[pdf.Name]*pdf.Object
+	transparency      bool
 	Finished          bool
 }
 
@@ -203,14 +205,18 @@ type objectContext struct {
 	outputDebug      *outputDebug
 	curOutputDebug   *outputDebug
 	pageObjectnumber pdf.Objectnumber
-	currentExpand    int
+	currentExpand    float64
 	currentVShift    bag.ScaledPoint
 	currentTmY       bag.ScaledPoint // last y written via Tm; used to detect Y changes inside an open TJ
 	currentTmYValid  bool            // false until the first Tm in a content stream
 	shiftX           bag.ScaledPoint
+	ctm              *node.Matrix // transformation of the enclosing Transform nodes, nil outside
+	clip             *clipRect    // bounding box of the enclosing Clip nodes, nil outside
+	group            *node.VList  // box written by outputGroup
 	textmode         TextScope
 	hasNewline       bool
 	inArtifact       bool
+	err              error // first error during output, returned by Shipout
 }
 
 // colorBitmapKey identifies one (face, glyph, strike) tuple. Multiple
@@ -230,6 +236,13 @@ func (oc *objectContext) emitBDC(se *StructureElement, mcid int) {
 	oc.writef("/%s <</MCID %d>> BDC\n", se.Role, mcid)
 }
 
+// setError records err unless an earlier error has been recorded.
+func (oc *objectContext) setError(err error) {
+	if oc.err == nil {
+		oc.err = err
+	}
+}
+
 // writef writes a formatted string to the object stream
 func (oc *objectContext) writef(format string, args ...any) {
 	fmt.Fprintf(oc.s, format, args...)
@@ -287,6 +300,8 @@ func (oc *objectContext) emitColorGlyph(g *node.Glyph, x, y bag.ScaledPoint, lay
 	// perspective and must not contribute to ActualText.
 	g.Font.Face.RegisterGlyph(g.Codepoint, g.Components)
 
+	// alpha is the color of the previous layer if it is translucent.
+	var alpha *color.Color
 	for _, layer := range layers {
 		// Layer glyphs share the subsetter's keep-set with their base
 		// glyph — without this, the subsetter would drop their outlines
@@ -304,6 +319,10 @@ func (oc *objectContext) emitColorGlyph(g *node.Glyph, x, y bag.ScaledPoint, lay
 		// (OT/Color/COLR/COLR.hh:80).
 		if layer.ColorIndex == ot.ForegroundColorIndex || int(layer.ColorIndex) >= len(palette) {
 			oc.writef("0 0 0 rg ")
+			if alpha != nil {
+				oc.setAlpha(alpha, true)
+				alpha = nil
+			}
 		} else {
 			c := palette[layer.ColorIndex]
 			col := color.Color{
@@ -314,6 +333,13 @@ func (oc *objectContext) emitColorGlyph(g *node.Glyph, x, y bag.ScaledPoint, lay
 				A:     float64(c.Alpha) / 255,
 			}
 			oc.writef("%s ", col.PDFStringNonStroking())
+			if !AlphaExtGState(&col, false).IsOpaque() {
+				oc.setAlpha(&col, false)
+				alpha = &col
+			} else if alpha != nil {
+				oc.setAlpha(alpha, true)
+				alpha = nil
+			}
 		}
 
 		// Absolute positioning brings the text cursor back to the base
@@ -330,6 +356,9 @@ func (oc *objectContext) emitColorGlyph(g *node.Glyph, x, y bag.ScaledPoint, lay
 	// rendered in the last layer's color.
 	oc.gotoTextMode(ScopeText)
 	oc.writef("0 0 0 rg ")
+	if alpha != nil {
+		oc.setAlpha(alpha, true)
+	}
 }
 
 // emitColorSVGGlyph paints one SVG-in-OpenType glyph by parsing the
@@ -525,6 +554,14 @@ func (oc *objectContext) gotoTextMode(newMode TextScope) {
 	}
 }
 
+// setExpansion sets the horizontal scaling for font expansion. 0.02 widens
+// the glyphs by 2%.
+func (oc *objectContext) setExpansion(e float64) {
+	oc.gotoTextMode(ScopeText)
+	oc.writef("%g Tz ", math.Round(10000*(1+e))/100)
+	oc.currentExpand = e
+}
+
 // outputHorizontalItems outputs a list of horizontal item and advances the
 // cursor. x and y must be the start of the base line coordinate.
 func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node.HList) {
@@ -571,20 +608,14 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				oc.usedFaces[v.Font.Face] = true
 				oc.currentFont = v.Font
 			}
-			if exp, ok := hlist.Attributes["expand"]; ok {
-				if ex, ok := exp.(int); ok {
-					if ex != oc.currentExpand {
-						oc.gotoTextMode(ScopeText)
-						oc.writef("%d Tz ", 100+ex)
-						oc.currentExpand = ex
-					}
-				}
-			} else {
-				if oc.currentExpand != 0 {
-					oc.gotoTextMode(ScopeText)
-					oc.writef("100 Tz ")
-					oc.currentExpand = 0
-				}
+			if v.Upright {
+				oc.outputUprightGlyph(x+oc.shiftX+sumX, y, v)
+				oc.shiftX = 0
+				sumX += v.Width
+				continue
+			}
+			if v.Expansion != oc.currentExpand {
+				oc.setExpansion(v.Expansion)
 			}
 			if v.YOffset != oc.currentVShift {
 				oc.gotoTextMode(ScopeText)
@@ -614,7 +645,7 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 						oc.emitColorBitmapGlyph(v, x+oc.shiftX+sumX, yPos, pngGlyph)
 						oc.shiftX = 0
 						oc.usedFaces[v.Font.Face] = true
-						sumX += bag.MultiplyFloat(v.Width, float64(100+oc.currentExpand)/100.0)
+						sumX += bag.MultiplyFloat(v.Width, 1+v.Expansion)
 						continue
 					}
 				}
@@ -640,7 +671,7 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 					oc.emitColorSVGGlyph(v, x+oc.shiftX+sumX, yPos, svgBytes)
 					oc.shiftX = 0
 					oc.usedFaces[v.Font.Face] = true
-					sumX += bag.MultiplyFloat(v.Width, float64(100+oc.currentExpand)/100.0)
+					sumX += bag.MultiplyFloat(v.Width, 1+v.Expansion)
 					continue
 				}
 			}
@@ -659,7 +690,7 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 					oc.emitColorGlyph(v, x+oc.shiftX+sumX, yPos, layers, palette)
 					oc.shiftX = 0
 					oc.usedFaces[v.Font.Face] = true
-					sumX += bag.MultiplyFloat(v.Width, float64(100+oc.currentExpand)/100.0)
+					sumX += bag.MultiplyFloat(v.Width, 1+v.Expansion)
 					continue
 				}
 			}
@@ -702,7 +733,7 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				oc.gotoTextMode(ScopeArray)
 				oc.writef(" %d ", -xOffsetMove)
 			}
-			sumX += bag.MultiplyFloat(v.Width, float64(100+oc.currentExpand)/100.0)
+			sumX += bag.MultiplyFloat(v.Width, 1+v.Expansion)
 		case *node.Glue:
 			var od *outputDebug
 			if oc.p.document.DumpOutput {
@@ -718,7 +749,28 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				}
 				oc.curOutputDebug.Items = append(oc.curOutputDebug.Items, od)
 			}
-			if v.Leader != nil && v.Leader.Width > 0 && v.Width > 0 {
+			if v.Subtype == node.GlueKashida {
+				if v.Leader != nil && v.Leader.Width > 0 && v.Width > 0 {
+					oc.gotoTextMode(ScopePage)
+					absX := x + sumX
+					pw := v.Leader.Width
+					// The tatweel copies overlap so that the stroke has
+					// no gap. A kashida narrower than one tatweel gets a
+					// centered copy that overlaps the joined letters.
+					n := int((v.Width + pw - 1) / pw)
+					var step bag.ScaledPoint
+					if n > 1 {
+						step = (v.Width - pw) / bag.ScaledPoint(n-1)
+					} else {
+						absX += (v.Width - pw) / 2
+					}
+					for i := 0; i < n; i++ {
+						oc.outputHorizontalItems(absX+bag.ScaledPoint(i)*step, y, v.Leader)
+						oc.gotoTextMode(ScopePage)
+					}
+				}
+				sumX += v.Width
+			} else if v.Leader != nil && v.Leader.Width > 0 && v.Width > 0 {
 				oc.gotoTextMode(ScopePage)
 				absX := x + sumX
 				endX := absX + v.Width
@@ -740,6 +792,11 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				if oc.textmode < ScopeText {
 					if curFont := oc.currentFont; curFont != nil {
 						if oc.currentFont.Size != 0 {
+							// Only expanded glyphs are scaled, the space
+							// is not.
+							if oc.currentExpand != 0 {
+								oc.setExpansion(0)
+							}
 							// Emit a space glyph so that PDF readers can
 							// extract proper word boundaries.
 							spaceGID := curFont.Face.Codepoint(' ')
@@ -763,7 +820,7 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 						}
 					}
 				}
-				sumX += bag.MultiplyFloat(v.Width, float64(100+oc.currentExpand)/100.0)
+				sumX += v.Width
 			}
 		case *node.Rule:
 			if oc.p.document.DumpOutput {
@@ -866,7 +923,7 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 					rectHT := posY - hyperlink.startposY + hlist.Height + hlist.Depth
 					rectWD := posX - hyperlink.startposX
 					a := pdf.Annotation{
-						Rect:    [4]float64{hyperlink.startposX.ToPT(), hyperlink.startposY.ToPT(), posX.ToPT(), (posY + rectHT).ToPT()},
+						Rect:    oc.pageRect(hyperlink.startposX, hyperlink.startposY, posX, posY+rectHT),
 						Subtype: "Link",
 					}
 					if oc.p.document.ShowHyperlinks {
@@ -924,12 +981,13 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				// dest should be in the top left corner of the current position
 				y := posY + hlist.Height + hlist.Depth
 				var destname string
+				destX, destY := oc.pagePoint(posX, y)
 				switch t := v.Value.(type) {
 				case string:
 					d := &pdf.NameDest{
 						Name:             pdf.String(t),
-						X:                posX.ToPT(),
-						Y:                y.ToPT(),
+						X:                destX,
+						Y:                destY,
 						PageObjectnumber: oc.pageObjectnumber,
 					}
 					destname = t
@@ -941,8 +999,8 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 					oc.p.document.numDestinations[t] = NumDest{
 						PageObjectnumber: oc.pageObjectnumber,
 						Num:              t,
-						X:                posX.ToPT(),
-						Y:                y.ToPT(),
+						X:                destX,
+						Y:                destY,
 					}
 					destname = fmt.Sprintf("numdest-%d", t)
 				}
@@ -976,6 +1034,9 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 			if v.ShipoutCallback != nil {
 				oc.write(v.ShipoutCallback(v))
 			}
+			if col, ok := startNode.Value.(*color.Color); ok {
+				oc.setAlpha(col, !isStartNode)
+			}
 			if v.Position == node.PDFOutputHere {
 				oc.moveto(-posX, -posY)
 			}
@@ -1005,8 +1066,14 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				}
 			}
 			sumX += v.Kern
-		case *node.Lang, *node.Penalty:
-			// ignore
+		case *node.Transform:
+			oc.outputTransform(x+sumX, y, v)
+			sumX += v.Width
+		case *node.Clip:
+			oc.outputClip(x+sumX, y, v)
+			sumX += v.Width
+		case *node.Lang, *node.Penalty, *node.Mark, *node.Insert:
+			// ignore, the material of inserts is placed by the page breaker
 		case *node.Disc:
 			// ignore
 		case *node.HList:
@@ -1063,7 +1130,8 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 				}
 			}
 			// PDF/UA: an inline <math> formula carries its own Formula
-			// structure element on the HList's "tag" attribute. Split the
+			// structure element on the HList's "tag" attribute (a ruby
+			// box its Ruby, RB and RT elements likewise). Split the
 			// surrounding paragraph's marked content so the formula glyphs
 			// sit in their own marked-content sequence tagged to the Formula
 			// element, then resume the paragraph text under a fresh MCID. The
@@ -1082,27 +1150,44 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 					// the Formula run stands alone as a child of the current
 					// structure element.
 					parentTag := oc.tag
+					// A ruby box (see frontend's buildRuby) has no content of
+					// its own. Its Ruby element only groups the RB and RT
+					// elements of the base and the ruby text, which carry the
+					// marked content, and is attached to the surrounding
+					// element here.
+					isRuby := formulaTag.Role == "Ruby"
+					if isRuby && parentTag != nil && formulaTag.Parent == nil {
+						parentTag.AddChild(formulaTag)
+					}
 					if parentTag != nil {
 						// Close the parent's open marked-content run.
 						oc.gotoTextMode(ScopePage)
 						oc.writef("EMC\n")
 					}
-					// Open the Formula run. The StructureElements append puts
-					// formulaTag at page-index == fmcid, which is exactly what
-					// the page ParentTree expects (index == MCID).
-					fmcid := oc.p.nextMCID
-					oc.p.nextMCID++
-					formulaTag.mcids = append(formulaTag.mcids, mcidEntry{pageIndex: oc.p.pageIndex, mcid: fmcid, seq: oc.p.document.nextReadingSeq()})
-					formulaTag.ID = fmcid
-					oc.p.StructureElements = append(oc.p.StructureElements, formulaTag)
-					oc.emitBDC(formulaTag, fmcid)
-					// Render the formula glyphs inside the Formula run.
-					oc.tag = formulaTag
-					oc.outputHorizontalItems(x+sumX, moveY, v)
-					oc.tag = parentTag
-					// Close the Formula run.
-					oc.gotoTextMode(ScopePage)
-					oc.writef("EMC\n")
+					if isRuby {
+						// The RB and RT runs stand alone.
+						oc.tag = nil
+						oc.outputHorizontalItems(x+sumX, moveY, v)
+						oc.tag = parentTag
+					} else {
+						// Open the Formula run. The StructureElements append
+						// puts formulaTag at page-index == fmcid, which is
+						// exactly what the page ParentTree expects (index ==
+						// MCID).
+						fmcid := oc.p.nextMCID
+						oc.p.nextMCID++
+						formulaTag.mcids = append(formulaTag.mcids, mcidEntry{pageIndex: oc.p.pageIndex, mcid: fmcid, seq: oc.p.document.nextReadingSeq()})
+						formulaTag.ID = fmcid
+						oc.p.StructureElements = append(oc.p.StructureElements, formulaTag)
+						oc.emitBDC(formulaTag, fmcid)
+						// Render the formula glyphs inside the Formula run.
+						oc.tag = formulaTag
+						oc.outputHorizontalItems(x+sumX, moveY, v)
+						oc.tag = parentTag
+						// Close the Formula run.
+						oc.gotoTextMode(ScopePage)
+						oc.writef("EMC\n")
+					}
 					if parentTag != nil {
 						// Reopen the parent's marked content with a fresh MCID so
 						// the remaining paragraph text reads under the parent. The
@@ -1243,6 +1328,15 @@ func (oc *objectContext) outputHorizontalItems(x, y bag.ScaledPoint, hlist *node
 // outputVerticalItems iterates through the vlist's list and outputs each item
 // beneath each other.
 func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.VList) {
+	// A box with the attribute "opacity" (a float64 below 1) is written with
+	// a graphics state that sets the opacity. A box with opacity 0 is not
+	// written at all.
+	if op, ok := vlist.Attributes["opacity"].(float64); ok && op < 1 && vlist != oc.group {
+		if op > 0 {
+			oc.outputGroup(x, y, vlist, op)
+		}
+		return
+	}
 	var od, saveCurOutputDebug *outputDebug
 	if oc.p.document.DumpOutput {
 		od := &outputDebug{
@@ -1342,9 +1436,9 @@ func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.V
 					oc.curOutputDebug.Items = append(oc.curOutputDebug.Items, od)
 				}
 			}
-			// Let's assume that the glue ratio has been determined and the
-			// natural width is in v.Width for now.
-			sumY += v.Width
+			// VpackTo leaves the glue alone and stores the glue ratio in
+			// the VList.
+			sumY += vlist.GlueWidth(v)
 		case *node.Kern:
 			if oc.p.document.DumpOutput {
 				if oc.p.document.DumpOutput {
@@ -1441,7 +1535,7 @@ func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.V
 					rectHT := posY - hyperlink.startposY + vlist.Height + vlist.Depth
 					rectWD := posX - hyperlink.startposX
 					a := pdf.Annotation{
-						Rect:    [4]float64{hyperlink.startposX.ToPT(), hyperlink.startposY.ToPT(), posX.ToPT(), (posY + rectHT).ToPT()},
+						Rect:    oc.pageRect(hyperlink.startposX, hyperlink.startposY, posX, posY+rectHT),
 						Subtype: "Link",
 					}
 					if oc.p.document.ShowHyperlinks {
@@ -1499,12 +1593,13 @@ func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.V
 				// dest should be in the top left corner of the current position
 				y := posY
 				var destname string // for debugging only
+				destX, destY := oc.pagePoint(posX, y)
 				switch t := v.Value.(type) {
 				case string:
 					d := &pdf.NameDest{
 						Name:             pdf.String(t),
-						X:                posX.ToPT(),
-						Y:                y.ToPT(),
+						X:                destX,
+						Y:                destY,
 						PageObjectnumber: oc.pageObjectnumber,
 					}
 					destname = t
@@ -1516,8 +1611,8 @@ func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.V
 					oc.p.document.numDestinations[t] = NumDest{
 						PageObjectnumber: oc.pageObjectnumber,
 						Num:              t,
-						X:                posX.ToPT(),
-						Y:                y.ToPT(),
+						X:                destX,
+						Y:                destY,
 					}
 					destname = fmt.Sprintf("numdest-%d", t)
 				}
@@ -1550,6 +1645,9 @@ func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.V
 			if v.ShipoutCallback != nil {
 				oc.write(v.ShipoutCallback(v))
 			}
+			if col, ok := startNode.Value.(*color.Color); ok {
+				oc.setAlpha(col, !isStartNode)
+			}
 			if v.Position == node.PDFOutputHere {
 				oc.moveto(-posX, -posY)
 			}
@@ -1655,6 +1753,18 @@ func (oc *objectContext) outputVerticalItems(x, y bag.ScaledPoint, vlist *node.V
 			oc.inArtifact = savedInArtifact
 
 			sumY += v.Height + v.Depth
+		case *node.Transform:
+			oc.outputTransform(x, y-sumY-v.Height, v)
+			sumY += v.Height + v.Depth
+		case *node.Clip:
+			oc.outputClip(x, y-sumY-v.Height, v)
+			sumY += v.Height + v.Depth
+		case *node.Penalty:
+			// Penalties only matter for page breaking.
+		case *node.Mark:
+			// Marks are read by the page template, see Page.FirstMark.
+		case *node.Insert:
+			// The material of inserts is placed by the page breaker.
 		default:
 			bag.Logger.Error(fmt.Sprintf("Shipout: unknown node %T in vertical mode", v))
 		}
@@ -1689,11 +1799,57 @@ func (p *Page) OutputAt(x bag.ScaledPoint, y bag.ScaledPoint, vlist *node.VList)
 	p.Objects = append(p.Objects, Object{X: x, Y: y, Vlist: vlist})
 }
 
-// Shipout places all objects on a page and finishes this page.
-func (p *Page) Shipout() {
+// Marks returns the marks of the given class in the objects on the page in
+// the order they were placed with OutputAt.
+func (p *Page) Marks(class string) []*node.Mark {
+	var marks []*node.Mark
+	for _, obj := range p.Objects {
+		if obj.Vlist != nil {
+			marks = append(marks, node.FindMarks(obj.Vlist, class)...)
+		}
+	}
+	return marks
+}
+
+// TopMark returns the last mark of the given class on the previous pages
+// (TeX's \topmark) or nil if there is none.
+func (p *Page) TopMark(class string) *node.Mark {
+	if p.document == nil {
+		return nil
+	}
+	for i := p.pageIndex - 1; i >= 0 && i < len(p.document.Pages); i-- {
+		if marks := p.document.Pages[i].Marks(class); len(marks) > 0 {
+			return marks[len(marks)-1]
+		}
+	}
+	return nil
+}
+
+// FirstMark returns the first mark of the given class on the page (TeX's
+// \firstmark). If the page has no such mark, it returns TopMark.
+func (p *Page) FirstMark(class string) *node.Mark {
+	if marks := p.Marks(class); len(marks) > 0 {
+		return marks[0]
+	}
+	return p.TopMark(class)
+}
+
+// BotMark returns the last mark of the given class on the page (TeX's
+// \botmark). If the page has no such mark, it returns TopMark.
+func (p *Page) BotMark(class string) *node.Mark {
+	if marks := p.Marks(class); len(marks) > 0 {
+		return marks[len(marks)-1]
+	}
+	return p.TopMark(class)
+}
+
+// Shipout places all objects on a page and finishes this page. The page is
+// written even if an error is returned, for example when the page uses
+// transparency and the document format does not allow it.
+func (p *Page) Shipout() error {
 	bag.Logger.Debug("Shipout")
 	if p.Finished {
-		return
+		return nil
 	}
 	p.Finished = true
 
@@ -1762,6 +1918,7 @@ func (p *Page) Shipout() {
 	usedFaces := make(map[*pdf.Face]bool)
 	usedImages := make(map[*pdf.Imagefile]bool)
 	var allShadings []pendingShading
+	var err error // first output error of an object
 	if p.document.DumpOutput {
 		p.outputDebug = &outputDebug{
 			Name: "page",
@@ -1837,6 +1994,9 @@ func (p *Page) Shipout() {
 		}
 
 		oc.outputVerticalItems(x, y, vlist)
+		if oc.err != nil && err == nil {
+			err = oc.err
+		}
 		for k := range oc.usedFaces {
 			usedFaces[k] = true
 		}
@@ -1876,6 +2036,12 @@ func (p *Page) Shipout() {
 	if err := materializeShadingsOnPage(page, p.document, allShadings); err != nil {
 		bag.Logger.Error("write shading pattern", "err", err)
 	}
+	if len(p.extGStates) > 0 {
+		page.ExtGStates = p.extGStates
+	}
+	if p.transparency {
+		page.Dict["Group"] = pdf.Dict{"Type": "/Group", "S": "/Transparency"}
+	}
 
 	// annotations are hyperlinks and structure elements
 	page.Annotations = p.Annotations
@@ -1900,6 +2066,7 @@ func (p *Page) Shipout() {
 	for _, s := range p.document.Spotcolors {
 		p.Spotcolors = append(p.Spotcolors, s)
 	}
+	return err
 }
 
 // CallbackShipout gets called before the shipout process starts.
@@ -2378,6 +2545,9 @@ type PDFDocument struct {
 	// /Pattern resource dict can refer back to it. Names are document-wide
 	// so the same SVG re-rendered on multiple pages does not collide.
 	shadingCounter int
+	// extGStates maps the serialized graphics state parameter dictionary to
+	// its object, see NewExtGState.
+	extGStates map[string]*pdf.Object
 	// readingSeq is a document-wide monotonic counter stamped on every
 	// marked-content reference and object reference as it is emitted during
 	// shipout. It records reading order across page boundaries (unlike MCID,
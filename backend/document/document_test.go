@@ -2,10 +2,15 @@ package document
 
 import (
 	"bytes"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	pdf "github.com/boxesandglue/baseline-pdf"
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/font"
+	"github.com/boxesandglue/boxesandglue/backend/node"
 )
 
 func TestFormatPDFVersionMapping(t *testing.T) {
@@ -299,3 +304,390 @@ func TestScopeHierarchy(t *testing.T) {
 		t.Error("ScopeText must be less than ScopePage")
 	}
 }
+
+func TestPageMarks(t *testing.T) {
+	d := NewDocument(&bytes.Buffer{})
+	markList := func(values ...string) *node.VList {
+		var head node.Node
+		for _, v := range values {
+			hl := node.Hpack(node.NewMark("chapter", v))
+			head = node.InsertAfter(head, node.Tail(head), hl)
+		}
+		return node.Vpack(head)
+	}
+	p1 := d.NewPage()
+	p1.OutputAt(0, 0, markList("one", "two"))
+	p2 := d.NewPage()
+	p2.OutputAt(0, 0, markList())
+	p3 := d.NewPage()
+	p3.OutputAt(0, 0, markList("three"))
+
+	value := func(m *node.Mark) any {
+		if m == nil {
+			return nil
+		}
+		return m.Value
+	}
+	data := []struct {
+		p                *Page
+		top, first, last any
+	}{
+		{p1, nil, "one", "two"},
+		{p2, "two", "two", "two"},
+		{p3, "two", "three", "three"},
+	}
+	for i, tc := range data {
+		if got := value(tc.p.TopMark("chapter")); got != tc.top {
+			t.Errorf("page %d: TopMark = %v, want %v", i+1, got, tc.top)
+		}
+		if got := value(tc.p.FirstMark("chapter")); got != tc.first {
+			t.Errorf("page %d: FirstMark = %v, want %v", i+1, got, tc.first)
+		}
+		if got := value(tc.p.BotMark("chapter")); got != tc.last {
+			t.Errorf("page %d: BotMark = %v, want %v", i+1, got, tc.last)
+		}
+	}
+	if m := p1.FirstMark("section"); m != nil {
+		t.Errorf("FirstMark(section) = %v, want nil", m)
+	}
+}
+
+func TestTransformHyperlink(t *testing.T) {
+	pt := bag.Factor
+	d := NewDocument(&bytes.Buffer{})
+	start := node.NewStartStop()
+	start.Action = node.ActionHyperlink
+	start.Value = &Hyperlink{URI: "https://example.com"}
+	r := node.NewRule()
+	r.Width, r.Height = 50*pt, 10*pt
+	stop := node.NewStartStop()
+	stop.StartNode = start
+	node.InsertAfter(start, start, r)
+	node.InsertAfter(start, r, stop)
+	tr, err := node.TransformBox(node.Hpack(start), node.RotateMatrix(90))
+	if err != nil {
+		t.Fatalf("TransformBox: %v", err)
+	}
+	p := d.NewPage()
+	p.OutputAt(100*pt, 500*pt, node.Vpack(node.Hpack(tr)))
+	p.Shipout()
+	if len(p.Annotations) != 1 {
+		t.Fatalf("got %d annotations, want 1", len(p.Annotations))
+	}
+	// The link is 50pt wide and 10pt high, rotated it stands upright left
+	// of the rotation origin at the baseline 450pt.
+	if got, want := p.Annotations[0].Rect, [4]float64{100, 450, 110, 500}; got != want {
+		t.Errorf("annotation rectangle %v, want %v", got, want)
+	}
+}
+
+func TestClipHyperlink(t *testing.T) {
+	pt := bag.Factor
+	d := NewDocument(&bytes.Buffer{})
+	start := node.NewStartStop()
+	start.Action = node.ActionHyperlink
+	start.Value = &Hyperlink{URI: "https://example.com"}
+	r := node.NewRule()
+	r.Width, r.Height = 50*pt, 10*pt
+	stop := node.NewStartStop()
+	stop.StartNode = start
+	node.InsertAfter(start, start, r)
+	node.InsertAfter(start, r, stop)
+	hl := node.Hpack(start)
+	// Only the first 20pt of the link are visible.
+	hl.Width = 20 * pt
+	c, err := node.ClipBox(hl)
+	if err != nil {
+		t.Fatalf("ClipBox: %v", err)
+	}
+	p := d.NewPage()
+	p.OutputAt(100*pt, 500*pt, node.Vpack(node.Hpack(c)))
+	p.Shipout()
+	if len(p.Annotations) != 1 {
+		t.Fatalf("got %d annotations, want 1", len(p.Annotations))
+	}
+	if got, want := p.Annotations[0].Rect, [4]float64{100, 490, 120, 500}; got != want {
+		t.Errorf("annotation rectangle %v, want %v", got, want)
+	}
+}
+
+func TestNewExtGState(t *testing.T) {
+	d := NewDocument(&bytes.Buffer{})
+	gs := ExtGState{FillAlpha: 0.5, BlendMode: BlendMultiply}
+	if got := pdf.Serialize(gs.Dict()); !strings.Contains(got, "/BM /Multiply") || !strings.Contains(got, "/ca 0.5") || strings.Contains(got, "/CA") {
+		t.Errorf("Dict() = %s", got)
+	}
+	obj, err := d.NewExtGState(gs)
+	if err != nil {
+		t.Fatalf("NewExtGState: %v", err)
+	}
+	if obj2, _ := d.NewExtGState(gs); obj2 != obj {
+		t.Error("equal states do not share the object")
+	}
+	col := &color.Color{Space: color.ColorRGB, R: 1, A: 0.25}
+	if gs := AlphaExtGState(col, true); gs.StrokeAlpha != 0.25 || gs.FillAlpha != 0 {
+		t.Errorf("AlphaExtGState = %+v", gs)
+	}
+
+	for _, f := range []Format{FormatPDFX3, {PDFA: &PDFAConf{Part: 1, Level: PDFALevelB}}} {
+		d.Format = f
+		if _, err := d.NewExtGState(gs); err == nil {
+			t.Errorf("%s: no error for transparency", f)
+		}
+		if _, err := d.NewExtGState(ExtGState{FillAlpha: 1}); err != nil {
+			t.Errorf("%s: opaque state: %v", f, err)
+		}
+	}
+	d.Format = FormatPDFX4
+	if _, err := d.NewExtGState(gs); err != nil {
+		t.Errorf("PDF/X-4: %v", err)
+	}
+}
+
+func TestPageTransparency(t *testing.T) {
+	pt := bag.Factor
+	var buf bytes.Buffer
+	d := NewDocument(&buf)
+	d.CompressLevel = 0
+
+	// A rule in a translucent RGB color.
+	col := &color.Color{Space: color.ColorRGB, R: 1, A: 0.5}
+	start := node.NewStartStop()
+	start.Value = col
+	start.ShipoutCallback = func(n node.Node) string { return col.PDFStringNonStroking() + " " }
+	r := node.NewRule()
+	r.Width, r.Height = 50*pt, 10*pt
+	stop := node.NewStartStop()
+	stop.StartNode = start
+	stop.ShipoutCallback = func(n node.Node) string { return "0 0 0 rg " }
+	node.InsertAfter(start, start, r)
+	node.InsertAfter(start, r, stop)
+
+	// A box with opacity and a glyph, so the page resources need the font.
+	face, err := d.LoadFace(filepath.Join("..", "..", "qa", "fonts", "upem", "fonts", "texgyreheros-regular.otf"), 0)
+	if err != nil {
+		t.Fatalf("LoadFace: %v", err)
+	}
+	fnt := font.NewFont(face, 10*pt)
+	atoms := fnt.Shape("A", nil, nil)
+	g := node.NewGlyph()
+	g.Font = fnt
+	g.Codepoint = atoms[0].Codepoint
+	g.Components = atoms[0].Components
+	g.Width = atoms[0].Advance
+	r2 := node.NewRule()
+	r2.Width, r2.Height = 20*pt, 20*pt
+	node.InsertAfter(r2, r2, g)
+	box := node.Vpack(node.Hpack(r2))
+	box.Attributes = node.H{"opacity": 0.25}
+
+	p := d.NewPage()
+	p.OutputAt(100*pt, 500*pt, node.Vpack(node.Hpack(start)))
+	p.OutputAt(100*pt, 400*pt, box)
+	if err := p.Shipout(); err != nil {
+		t.Fatalf("Shipout: %v", err)
+	}
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"1 0 0 rg /GS",     // the color alpha in the content stream
+		"q /GS",            // the box opacity in the content stream
+		"/S /Transparency", // page group
+		"/ca 0.5",          // the color alpha state
+		"/ca 0.25",         // the box opacity state
+		"/ca 1",            // alpha reset at the end of the color
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("PDF does not contain %q", want)
+		}
+	}
+	res := out[strings.Index(out, "/Resources <<"):]
+	if !strings.Contains(res, "/ExtGState <<") {
+		t.Fatal("page resources have no /ExtGState entry")
+	}
+	for name, obj := range p.extGStates {
+		if !strings.Contains(out, name.String()+" gs") {
+			t.Errorf("%s is not used in a content stream", name)
+		}
+		if !strings.Contains(res, name.String()+" "+obj.ObjectNumber.Ref()) {
+			t.Errorf("%s is not in the page resources", name)
+		}
+	}
+	if !strings.Contains(res, face.InternalName()+" ") {
+		t.Errorf("font %s is not in the page resources", face.InternalName())
+	}
+
+	d = NewDocument(&bytes.Buffer{})
+	d.Format = FormatPDFX3
+	p = d.NewPage()
+	r3 := node.NewRule()
+	r3.Width, r3.Height = 20*pt, 20*pt
+	box = node.Vpack(node.Hpack(r3))
+	box.Attributes = node.H{"opacity": 0.25}
+	p.OutputAt(100*pt, 400*pt, box)
+	if err := p.Shipout(); err == nil {
+		t.Error("PDF/X-3: Shipout does not return the transparency error")
+	}
+	if p.transparency {
+		t.Error("PDF/X-3 page uses transparency")
+	}
+}
+
+// TestUAInlineTags outputs a tagged paragraph with a ruby box and two inline
+// formulas, one in the structure tree and one that isn't.
+func TestUAInlineTags(t *testing.T) {
+	pt := bag.Factor
+	var buf bytes.Buffer
+	d := NewDocument(&buf)
+	d.CompressLevel = 0
+	d.Format = FormatPDFUA
+	root := &StructureElement{Role: "Document"}
+	d.RootStructureElement = root
+	para := &StructureElement{Role: "P"}
+	root.AddChild(para)
+
+	rule := func() *node.Rule {
+		r := node.NewRule()
+		r.Width, r.Height = 10*pt, 10*pt
+		return r
+	}
+	tagged := func(se *StructureElement, list node.Node) *node.HList {
+		hl := node.Hpack(list)
+		hl.Attributes = node.H{"tag": se}
+		return hl
+	}
+	ruby, rb, rt := &StructureElement{Role: "Ruby"}, &StructureElement{Role: "RB"}, &StructureElement{Role: "RT"}
+	ruby.AddChild(rb)
+	ruby.AddChild(rt)
+	rbBox := tagged(rb, rule())
+	k := node.NewKern()
+	k.Kern = -10 * pt
+	node.InsertAfter(rbBox, rbBox, k)
+	node.InsertAfter(rbBox, k, tagged(rt, rule()))
+	rubyBox := tagged(ruby, rbBox)
+
+	formula := &StructureElement{Role: "Formula"}
+	para.AddChild(formula)
+	detached := &StructureElement{Role: "Formula"}
+
+	var head node.Node
+	for _, n := range []node.Node{rule(), rubyBox, rule(), tagged(formula, rule()), rule(), tagged(detached, rule())} {
+		head = node.InsertAfter(head, node.Tail(head), n)
+	}
+	vl := node.Vpack(node.Hpack(head))
+	vl.Attributes = node.H{"tag": para}
+	p := d.NewPage()
+	p.OutputAt(100*pt, 500*pt, vl)
+	p.Shipout()
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "/Ruby <<") {
+		t.Error("the Ruby element has marked content")
+	}
+	if strings.Contains(out, "BDC\nEMC") {
+		t.Error("empty marked-content run")
+	}
+	if b, e := strings.Count(out, "BDC"), strings.Count(out, "EMC"); b != 8 || e != 8 {
+		t.Errorf("%d BDC and %d EMC, want 8", b, e)
+	}
+
+	if ruby.Parent != para {
+		t.Errorf("Ruby parent %v, want P", ruby.Parent)
+	}
+	if len(ruby.mcids) != 0 {
+		t.Errorf("Ruby has %d marked-content runs, want 0", len(ruby.mcids))
+	}
+	for _, se := range []*StructureElement{rb, rt, formula, detached} {
+		if len(se.mcids) != 1 {
+			t.Errorf("%s has %d marked-content runs, want 1", se.Role, len(se.mcids))
+		}
+	}
+	if formula.Parent != para || detached.Parent != nil {
+		t.Error("the formulas' structure changed")
+	}
+	if got := para.Children(); len(got) != 2 || got[0] != formula || got[1] != ruby {
+		t.Errorf("P children %v", got)
+	}
+	// The paragraph text is split around the ruby and the formulas: four runs.
+	if got := len(para.mcids); got != 4 {
+		t.Errorf("P has %d marked-content runs, want 4", got)
+	}
+}
+
+// TestKashidaLeader fills a kashida of 10pt with copies of a 4pt tatweel. The
+// three copies overlap, so they start 3pt apart.
+func TestKashidaLeader(t *testing.T) {
+	pt := bag.Factor
+	var buf bytes.Buffer
+	d := NewDocument(&buf)
+	d.CompressLevel = 0
+	tatweel := node.NewRule()
+	tatweel.Width, tatweel.Height = 4*pt, 1*pt
+	g := node.NewGlue()
+	g.Subtype = node.GlueKashida
+	g.Stretch = 10 * pt
+	g.Leader = node.Hpack(tatweel)
+	hl := node.HpackTo(g, 10*pt)
+	p := d.NewPage()
+	p.OutputAt(100*pt, 500*pt, node.Vpack(hl))
+	p.Shipout()
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	out := buf.String()
+	if got := strings.Count(out, "0 0 4 1 re f"); got != 3 {
+		t.Errorf("%d tatweel copies, want 3", got)
+	}
+	for _, x := range []string{"100", "103", "106"} {
+		if !strings.Contains(out, "1 0 0 1 "+x+" ") {
+			t.Errorf("no tatweel at x = %s", x)
+		}
+	}
+}
+
+// TestExpandedGlyphAdvance outputs an expanded glyph followed by a rule, a
+// glue and another rule. The glyph advances by its expanded width, the glue
+// by its own width.
+func TestExpandedGlyphAdvance(t *testing.T) {
+	pt := bag.Factor
+	var buf bytes.Buffer
+	d := NewDocument(&buf)
+	d.CompressLevel = 0
+	face, err := d.LoadFace(filepath.Join("..", "..", "qa", "fonts", "upem", "fonts", "texgyreheros-regular.otf"), 0)
+	if err != nil {
+		t.Fatalf("LoadFace: %v", err)
+	}
+	fnt := font.NewFont(face, 10*pt)
+	atoms := fnt.Shape("A", nil, nil)
+	g := node.NewGlyph()
+	g.Font = fnt
+	g.Codepoint = atoms[0].Codepoint
+	g.Components = atoms[0].Components
+	g.Width = 10 * pt
+	g.Expansion = 0.1
+	r1 := node.NewRule()
+	r1.Width, r1.Height = 1*pt, 1*pt
+	gl := node.NewGlue()
+	gl.Width = 5 * pt
+	r2 := node.NewRule()
+	r2.Width, r2.Height = 1*pt, 1*pt
+	node.InsertAfter(g, g, r1)
+	node.InsertAfter(g, r1, gl)
+	node.InsertAfter(g, gl, r2)
+	p := d.NewPage()
+	p.OutputAt(100*pt, 500*pt, node.Vpack(node.Hpack(g)))
+	p.Shipout()
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	out := buf.String()
+	for _, x := range []string{"111", "117"} {
+		if !strings.Contains(out, "1 0 0 1 "+x+" ") {
+			t.Errorf("no rule at x = %s", x)
+		}
+	}
+}
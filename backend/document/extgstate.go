@@ -0,0 +1,205 @@
+package document
+
+import (
+	"fmt"
+	"strconv"
+
+	pdf "github.com/boxesandglue/baseline-pdf"
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// BlendMode is a PDF blend mode that determines how colors are combined with
+// the backdrop.
+type BlendMode string
+
+// The separable and non-separable blend modes of ISO 32000-1 §11.3.5.
+const (
+	BlendNormal     BlendMode = "Normal"
+	BlendMultiply   BlendMode = "Multiply"
+	BlendScreen     BlendMode = "Screen"
+	BlendOverlay    BlendMode = "Overlay"
+	BlendDarken     BlendMode = "Darken"
+	BlendLighten    BlendMode = "Lighten"
+	BlendColorDodge BlendMode = "ColorDodge"
+	BlendColorBurn  BlendMode = "ColorBurn"
+	BlendHardLight  BlendMode = "HardLight"
+	BlendSoftLight  BlendMode = "SoftLight"
+	BlendDifference BlendMode = "Difference"
+	BlendExclusion  BlendMode = "Exclusion"
+	BlendHue        BlendMode = "Hue"
+	BlendSaturation BlendMode = "Saturation"
+	BlendColor      BlendMode = "Color"
+	BlendLuminosity BlendMode = "Luminosity"
+)
+
+// A SoftMask takes the mask values from a transparency group XObject. With
+// Luminosity the mask is the luminosity of the group, otherwise it is the
+// group's alpha.
+type SoftMask struct {
+	Luminosity bool
+	// Group is the object number of a form XObject with a transparency
+	// group (/Group << /S /Transparency >>).
+	Group pdf.Objectnumber
+}
+
+// ExtGState holds the transparency parameters of a PDF graphics state
+// parameter dictionary. Alpha values are from 0 to 1; 0 means unset like the
+// A field of color.Color, 1 sets the alpha back to opaque.
+type ExtGState struct {
+	FillAlpha   float64
+	StrokeAlpha float64
+	BlendMode   BlendMode
+	SoftMask    *SoftMask
+}
+
+// IsOpaque reports whether gs has no effect on the output.
+func (gs ExtGState) IsOpaque() bool {
+	opaque := func(a float64) bool { return a <= 0 || a >= 1 }
+	return opaque(gs.FillAlpha) && opaque(gs.StrokeAlpha) &&
+		(gs.BlendMode == "" || gs.BlendMode == BlendNormal) && gs.SoftMask == nil
+}
+
+// Dict returns the graphics state parameter dictionary.
+func (gs ExtGState) Dict() pdf.Dict {
+	d := pdf.Dict{"Type": "/ExtGState"}
+	if a := gs.FillAlpha; a > 0 {
+		d["ca"] = strconv.FormatFloat(min(a, 1), 'f', -1, 64)
+	}
+	if a := gs.StrokeAlpha; a > 0 {
+		d["CA"] = strconv.FormatFloat(min(a, 1), 'f', -1, 64)
+	}
+	if gs.BlendMode != "" {
+		d["BM"] = "/" + string(gs.BlendMode)
+	}
+	if sm := gs.SoftMask; sm != nil {
+		s := "/Alpha"
+		if sm.Luminosity {
+			s = "/Luminosity"
+		}
+		d["SMask"] = pdf.Dict{"Type": "/Mask", "S": s, "G": sm.Group.Ref()}
+	}
+	return d
+}
+
+// AlphaExtGState returns the graphics state for the alpha value of the RGB
+// color col, for example from rgba(255,0,0,0.5). stroking selects the stroke
+// alpha instead of the fill alpha.
+func AlphaExtGState(col *color.Color, stroking bool) ExtGState {
+	var gs ExtGState
+	if col == nil || col.Space != color.ColorRGB {
+		return gs
+	}
+	if stroking {
+		gs.StrokeAlpha = col.A
+	} else {
+		gs.FillAlpha = col.A
+	}
+	return gs
+}
+
+// AllowsTransparency reports whether the format permits transparency. PDF/A-1
+// and PDF/X-3 are based on PDF 1.4 respectively PDF 1.3 and forbid it.
+func (f Format) AllowsTransparency() bool {
+	if f.PDFA != nil && f.PDFA.Part == 1 {
+		return false
+	}
+	return !f.IsPDFX3()
+}
+
+// CheckTransparency returns an error if the format does not permit
+// transparency.
+func (f Format) CheckTransparency() error {
+	if f.AllowsTransparency() {
+		return nil
+	}
+	return fmt.Errorf("%s does not allow transparency (opacity, blend modes or soft masks)", f)
+}
+
+// NewExtGState writes the graphics state parameter dictionary for gs to the
+// PDF and returns the object. Equal states share one object. The error is
+// non-nil if the document's Format does not allow transparency. Use
+// Page.ExtGState to get a resource name for the gs operator.
+func (d *PDFDocument) NewExtGState(gs ExtGState) (*pdf.Object, error) {
+	if !gs.IsOpaque() {
+		if err := d.Format.CheckTransparency(); err != nil {
+			return nil, err
+		}
+	}
+	dict := gs.Dict()
+	key := pdf.Serialize(dict)
+	if obj, ok := d.extGStates[key]; ok {
+		return obj, nil
+	}
+	obj := d.PDFWriter.NewObject()
+	obj.Dict(dict)
+	if err := obj.Save(); err != nil {
+		return nil, err
+	}
+	if d.extGStates == nil {
+		d.extGStates = make(map[string]*pdf.Object)
+	}
+	d.extGStates[key] = obj
+	return obj, nil
+}
+
+// ExtGState returns the resource name such as /GS12 of the graphics state gs
+// for the gs operator in the content stream of the page. The state is added
+// to the /ExtGState resources of the page.
+func (p *Page) ExtGState(gs ExtGState) (string, error) {
+	obj, err := p.document.NewExtGState(gs)
+	if err != nil {
+		return "", err
+	}
+	name := pdf.Name(fmt.Sprintf("GS%d", obj.ObjectNumber))
+	if p.extGStates == nil {
+		p.extGStates = make(map[pdf.Name]*pdf.Object)
+	}
+	p.extGStates[name] = obj
+	if !gs.IsOpaque() {
+		p.transparency = true
+	}
+	return name.String(), nil
+}
+
+// setAlpha writes a gs operator for the alpha value of the RGB color col, or
+// one that sets the fill alpha back to opaque if reset is true. Colors without
+// alpha write nothing.
+func (oc *objectContext) setAlpha(col *color.Color, reset bool) {
+	gs := AlphaExtGState(col, false)
+	if gs.IsOpaque() {
+		return
+	}
+	if reset {
+		gs.FillAlpha = 1
+	}
+	name, err := oc.p.ExtGState(gs)
+	if err != nil {
+		oc.setError(err)
+		return
+	}
+	oc.writef("%s gs ", name)
+}
+
+// outputGroup writes vlist with the given opacity (0 to 1). The opacity
+// applies to each part of the box, so overlapping parts inside the box shine
+// through each other.
+func (oc *objectContext) outputGroup(x, y bag.ScaledPoint, vlist *node.VList, opacity float64) {
+	saveGroup := oc.group
+	oc.group = vlist
+	defer func() { oc.group = saveGroup }()
+	gs, err := oc.p.ExtGState(ExtGState{FillAlpha: opacity, StrokeAlpha: opacity})
+	if err != nil {
+		oc.setError(err)
+		oc.outputVerticalItems(x, y, vlist)
+		return
+	}
+	oc.gotoTextMode(ScopePage)
+	saveFont := oc.currentFont
+	oc.writef("q %s gs\n", gs)
+	oc.outputVerticalItems(x, y, vlist)
+	oc.gotoTextMode(ScopePage)
+	oc.writef("Q\n")
+	oc.currentFont = saveFont
+}
@@ -0,0 +1,108 @@
+package document
+
+import (
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// clipRect is a rectangle in page coordinates.
+type clipRect struct {
+	minX, minY, maxX, maxY bag.ScaledPoint
+}
+
+// outputTransform writes the contents of the Transform node t. x and y are
+// the left end of the transform's baseline.
+func (oc *objectContext) outputTransform(x, y bag.ScaledPoint, t *node.Transform) {
+	oc.outputLocal(t.Matrix.Multiply(node.TranslateMatrix(x, y)), "", t.List)
+}
+
+// outputClip writes the contents of the Clip node c clipped to its path. x
+// and y are the left end of the clip's baseline.
+func (oc *objectContext) outputClip(x, y bag.ScaledPoint, c *node.Clip) {
+	saveClip := oc.clip
+	// Annotations are clipped to the bounding box of the clip rectangle.
+	r := clipRect{}
+	r.minX, r.minY, r.maxX, r.maxY = oc.pageBounds(x, y-c.Depth, x+c.Width, y+c.Height)
+	if oc.clip != nil {
+		r.minX, r.minY = max(r.minX, oc.clip.minX), max(r.minY, oc.clip.minY)
+		r.maxX, r.maxY = min(r.maxX, oc.clip.maxX), min(r.maxY, oc.clip.maxY)
+	}
+	oc.clip = &r
+	oc.outputLocal(node.TranslateMatrix(x, y), c.ClipPath(), c.List)
+	oc.clip = saveClip
+}
+
+// outputLocal writes the box in the coordinate system given by m, preceded
+// by the PDF instructions pre, surrounded by q ... Q. The box is an HList
+// (origin at the left end of the baseline) or a VList (origin at the bottom
+// left corner above the depth).
+func (oc *objectContext) outputLocal(m node.Matrix, pre string, box node.Node) {
+	if box == nil {
+		return
+	}
+	oc.gotoTextMode(ScopePage)
+	oc.writef("q %s cm\n", m)
+	if pre != "" {
+		oc.writef("%s\n", pre)
+	}
+
+	// Q restores the font and the text state of the graphics state.
+	saveCTM := oc.ctm
+	saveFont := oc.currentFont
+	saveExpand, saveVShift := oc.currentExpand, oc.currentVShift
+	ctm := m
+	if oc.ctm != nil {
+		ctm = m.Multiply(*oc.ctm)
+	}
+	oc.ctm = &ctm
+
+	switch v := box.(type) {
+	case *node.HList:
+		oc.outputHorizontalItems(0, 0, v)
+	case *node.VList:
+		oc.outputVerticalItems(0, v.Height, v)
+	default:
+		bag.Logger.Error("Shipout: a transform or clip can only contain an HList or a VList", "node", v.Type())
+	}
+
+	oc.gotoTextMode(ScopePage)
+	oc.writef("Q\n")
+	oc.ctm = saveCTM
+	oc.currentFont = saveFont
+	oc.currentExpand, oc.currentVShift = saveExpand, saveVShift
+}
+
+// pagePoint returns the position of x, y on the page in PDF points, taking
+// the enclosing transforms into account.
+func (oc *objectContext) pagePoint(x, y bag.ScaledPoint) (float64, float64) {
+	if oc.ctm != nil {
+		x, y = oc.ctm.Apply(x, y)
+	}
+	return x.ToPT(), y.ToPT()
+}
+
+// pageBounds returns the bounding box of the rectangle from x1, y1 to x2, y2
+// on the page, taking the enclosing transforms into account.
+func (oc *objectContext) pageBounds(x1, y1, x2, y2 bag.ScaledPoint) (minX, minY, maxX, maxY bag.ScaledPoint) {
+	m := node.IdentityMatrix()
+	if oc.ctm != nil {
+		m = *oc.ctm
+	}
+	return m.Bounds(x1, y1, x2, y2)
+}
+
+// pageRect returns the rectangle from x1, y1 to x2, y2 on the page in PDF
+// points, for example for an annotation. Inside a transform it is the
+// bounding box of the transformed rectangle, inside a clip it is cut to the
+// clip's bounding box. A rectangle outside of the clip has no area.
+func (oc *objectContext) pageRect(x1, y1, x2, y2 bag.ScaledPoint) [4]float64 {
+	if oc.ctm == nil && oc.clip == nil {
+		return [4]float64{x1.ToPT(), y1.ToPT(), x2.ToPT(), y2.ToPT()}
+	}
+	x1, y1, x2, y2 = oc.pageBounds(x1, y1, x2, y2)
+	if c := oc.clip; c != nil {
+		x1, y1 = min(max(x1, c.minX), c.maxX), min(max(y1, c.minY), c.maxY)
+		x2, y2 = max(min(x2, c.maxX), x1), max(min(y2, c.maxY), y1)
+	}
+	return [4]float64{x1.ToPT(), y1.ToPT(), x2.ToPT(), y2.ToPT()}
+}
@@ -0,0 +1,28 @@
+package document
+
+import (
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// outputUprightGlyph writes the upright glyph g of a vertical line. The line
+// is turned clockwise onto the page, so the glyph is turned counterclockwise
+// to stand upright. x and y are the pen position on the line's baseline.
+func (oc *objectContext) outputUprightGlyph(x, y bag.ScaledPoint, g *node.Glyph) {
+	g.Font.Face.RegisterGlyph(g.Codepoint, g.Components)
+	oc.gotoTextMode(ScopeText)
+	if oc.currentExpand != 0 {
+		oc.setExpansion(0)
+	}
+	if oc.currentVShift != 0 {
+		oc.writef("0 Ts ")
+		oc.currentVShift = 0
+	}
+	oc.newline()
+	oc.writef("0 1 -1 0 %s %s Tm ", x+g.XOffset, y+g.YOffset)
+	// The next horizontal glyph needs a new text matrix.
+	oc.currentTmYValid = false
+	oc.gotoTextMode(ScopeGlyph)
+	oc.writef("%04x", g.Codepoint)
+	oc.gotoTextMode(ScopeText)
+}
@@ -26,6 +26,16 @@ type Atom struct {
 	IsSpace    bool
 	NoBreak    bool // Space that must not be a breakpoint (e.g. NBSP U+00A0)
 	Hyphenate  bool
+	// Upright is set for glyphs shaped for vertical text. Advance is the
+	// vertical advance, XOffset and YOffset are the position of the glyph's
+	// horizontal origin relative to the pen position on the central
+	// baseline, measured along the line (downwards) and across the line
+	// (to the right).
+	Upright bool
+	// Kashida is set on the first glyph of an Arabic letter that is joined
+	// to the letter before it. The joining stroke between the two can be
+	// elongated for justification.
+	Kashida bool
 }
 
 // MissingGlyphFunc is called when a character cannot be found in the font.
@@ -85,6 +95,8 @@ func (f *Font) Shape(text string, features []ot.Feature, variations map[string]f
 // Pass ot.DirectionInvalid to fall back to script-based guessing.
 // For RTL scripts (Hebrew, Arabic) shaped with DirectionRTL, the returned
 // atoms are in visual order (i.e. ready for left-to-right placement).
+// ot.DirectionTTB shapes for vertical text with the vert feature and the
+// vertical metrics of the font, the atoms are Upright.
 func (f *Font) ShapeDir(text string, features []ot.Feature, variations map[string]float64, dir ot.Direction) []Atom {
 	// empty paragraphs have ZERO WIDTH SPACE as a marker
 	if text == "\u200B" {
@@ -117,6 +129,11 @@ func (f *Font) ShapeDir(text string, features []ot.Feature, variations map[strin
 	}
 	buf.GuessSegmentProperties()
 	f.Face.Shaper.Shape(buf, features)
+	if buf.Direction.IsVertical() {
+		glyphs := f.verticalAtoms(buf, runes)
+		bufPool.Put(buf)
+		return glyphs
+	}
 	glyphs := make([]Atom, 0, len(buf.Info))
 	space := f.Face.Codepoint(' ')
 	lenBufInfo := len(buf.Info)
@@ -187,6 +204,13 @@ func (f *Font) ShapeDir(text string, features []ot.Feature, variations map[strin
 				}
 			}
 			g.Components = string(runes[r.Cluster:endCluster])
+			// Only the first glyph of a cluster in logical order starts
+			// a letter.
+			first := i == 0 || buf.Info[i-1].Cluster != r.Cluster
+			if rtl {
+				first = i == lenBufInfo-1 || buf.Info[i+1].Cluster != r.Cluster
+			}
+			g.Kashida = first && isKashidaPoint(runes, int(r.Cluster))
 			glyphs = append(glyphs, g)
 		}
 	}
@@ -194,6 +218,49 @@ func (f *Font) ShapeDir(text string, features []ot.Feature, variations map[strin
 	return glyphs
 }
 
+// verticalAtoms converts the shaped glyphs of a vertical (top to bottom)
+// buffer to atoms. The glyphs are centered on the line, so height and depth
+// are half of the font size.
+func (f *Font) verticalAtoms(buf *ot.Buffer, runes []rune) []Atom {
+	glyphs := make([]Atom, 0, len(buf.Info))
+	for i, r := range buf.Info {
+		char := runes[r.Cluster]
+		adv := bag.ScaledPoint(-int32(buf.Pos[i].YAdvance) * int32(f.Mag))
+		if unicode.IsSpace(char) {
+			glyphs = append(glyphs, Atom{
+				IsSpace:    true,
+				NoBreak:    char == '\u00A0',
+				Advance:    adv,
+				Components: string(char),
+				Codepoint:  int(r.GlyphID),
+				Upright:    true,
+			})
+			continue
+		}
+		if r.GlyphID == 0 && f.MissingGlyphFunc != nil {
+			f.MissingGlyphFunc(f.Face, char)
+		}
+		endCluster := len(runes)
+		if i < len(buf.Info)-1 {
+			endCluster = int(buf.Info[i+1].Cluster)
+		}
+		if endCluster <= int(r.Cluster) {
+			endCluster = min(int(r.Cluster)+1, len(runes))
+		}
+		glyphs = append(glyphs, Atom{
+			Advance:    adv,
+			Height:     f.Size / 2,
+			Depth:      f.Size - f.Size/2,
+			XOffset:    bag.ScaledPoint(-int32(buf.Pos[i].YOffset) * int32(f.Mag)),
+			YOffset:    bag.ScaledPoint(int32(buf.Pos[i].XOffset) * int32(f.Mag)),
+			Codepoint:  int(r.GlyphID),
+			Components: string(runes[r.Cluster:endCluster]),
+			Upright:    true,
+		})
+	}
+	return glyphs
+}
+
 // --- OpenType MATH accessors ----------------------------------------------
 //
 // These three methods expose the bits of the MATH table that the math layout
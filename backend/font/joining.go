@@ -0,0 +1,69 @@
+package font
+
+import "unicode"
+
+// joining is the Unicode Joining_Type of a character.
+type joining int
+
+const (
+	joiningNone        joining = iota // U: does not join
+	joiningRight                      // R: joins to the preceding letter only
+	joiningDual                       // D: joins on both sides
+	joiningTransparent                // T: marks are skipped
+)
+
+// rightJoining are the Arabic letters that do not join to the following
+// letter (alef, dal, reh, waw and their variants).
+var rightJoining = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x0622, Hi: 0x0625, Stride: 1},
+		{Lo: 0x0627, Hi: 0x0629, Stride: 2},
+		{Lo: 0x062F, Hi: 0x0632, Stride: 1},
+		{Lo: 0x0648, Hi: 0x0648, Stride: 1},
+		{Lo: 0x0671, Hi: 0x0673, Stride: 1},
+		{Lo: 0x0675, Hi: 0x0677, Stride: 1},
+		{Lo: 0x0688, Hi: 0x0699, Stride: 1},
+		{Lo: 0x06C0, Hi: 0x06C0, Stride: 1},
+		{Lo: 0x06C3, Hi: 0x06CB, Stride: 1},
+		{Lo: 0x06CD, Hi: 0x06CF, Stride: 2},
+		{Lo: 0x06D2, Hi: 0x06D3, Stride: 1},
+		{Lo: 0x06D5, Hi: 0x06D5, Stride: 1},
+		{Lo: 0x06EE, Hi: 0x06EF, Stride: 1},
+	},
+}
+
+// joiningType returns the joining type of r. This covers the letters of the
+// Arabic block, which is what kashida justification needs; all other
+// letters are non-joining.
+func joiningType(r rune) joining {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return joiningTransparent
+	case r == 0x0640: // tatweel
+		return joiningDual
+	case r < 0x0620 || r > 0x06FF || !unicode.IsLetter(r) || r == 0x0621 || r == 0x0674:
+		return joiningNone
+	case unicode.Is(rightJoining, r):
+		return joiningRight
+	}
+	return joiningDual
+}
+
+// isKashidaPoint reports whether runes[pos] is joined to the character
+// before it, so that the joining stroke between them can be elongated.
+// Marks between the two characters are skipped.
+func isKashidaPoint(runes []rune, pos int) bool {
+	if jt := joiningType(runes[pos]); jt != joiningDual && jt != joiningRight {
+		return false
+	}
+	for i := pos - 1; i >= 0; i-- {
+		switch joiningType(runes[i]) {
+		case joiningTransparent:
+			continue
+		case joiningDual:
+			return true
+		}
+		return false
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/boxesandglue/boxesandglue/backend/text/segment"
 	"github.com/speedata/hyphenation"
 )
 
@@ -13,6 +14,10 @@ type Lang struct {
 	Name           string
 	Lefthyphenmin  int
 	Righthyphenmin int
+	// Segmenter finds the word boundaries in scripts without spaces between
+	// words (Thai, Lao, Khmer, Burmese). If nil, such text only breaks at
+	// spaces.
+	Segmenter *segment.Dictionary
 }
 
 // LoadPatternFile loads the hyphenation patterns with the given file name
@@ -46,8 +51,12 @@ func NewFromReader(r io.Reader) (*Lang, error) {
 	return l, nil
 }
 
-// Hyphenate returns a slice of hyphenation points
+// Hyphenate returns a slice of hyphenation points. A language without
+// patterns, such as one that only has a Segmenter, has none.
 func (l *Lang) Hyphenate(word string) []int {
+	if l.lang == nil {
+		return nil
+	}
 	l.lang.Leftmin = l.Lefthyphenmin
 	l.lang.Rightmin = l.Righthyphenmin
 
@@ -43,4 +43,8 @@ var (
 	startStopSlab slab[StartStop]
 	imageSlab     slab[Image]
 	hardBreakSlab slab[HardBreak]
+	markSlab      slab[Mark]
+	insertSlab    slab[Insert]
+	transformSlab slab[Transform]
+	clipSlab      slab[Clip]
 )
@@ -0,0 +1,126 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+)
+
+// circleKappa is the distance of the Bézier control points for a quarter
+// circle of radius 1.
+const circleKappa = 0.5523
+
+// A Clip shows only the part of a box (an HList or a VList) that is inside
+// the clipping path, for example for CSS overflow: hidden or for an image
+// with rounded corners. Without Path, the clipping path is the rectangle of
+// the box with corners rounded by Radius. The clip has the size of the box.
+type Clip struct {
+	basenode
+	Width  bag.ScaledPoint
+	Height bag.ScaledPoint
+	Depth  bag.ScaledPoint
+	// Radius rounds the corners of the clip rectangle.
+	Radius bag.ScaledPoint
+	// Path is an arbitrary clipping path made of path construction
+	// operators created with pdfdraw.New (Moveto, Lineto, Curveto, Rect,
+	// Circle, Close). The origin is the left end of the baseline of the
+	// box, y grows upwards.
+	Path *pdfdraw.Object
+	// EvenOdd uses the even-odd rule instead of the nonzero winding number
+	// rule to determine the inside of Path.
+	EvenOdd bool
+	List    Node
+}
+
+func (c *Clip) String() string {
+	return fmt.Sprintf("clip: %s %s %s", c.Width, c.Height, c.Depth)
+}
+
+// Sizes returns the size of the clipped box.
+func (c *Clip) Sizes(Direction) (w, h, d bag.ScaledPoint) {
+	return c.Width, c.Height, c.Depth
+}
+
+// DebugAttributes returns the geometry and the corner radius of the clip.
+func (c *Clip) DebugAttributes() ([]kv, H) {
+	return []kv{
+		{key: "id", value: c.ID},
+		{key: "wd", value: c.Width},
+		{key: "ht", value: c.Height},
+		{key: "dp", value: c.Depth},
+		{key: "radius", value: c.Radius},
+	}, c.Attributes
+}
+
+// Copy creates a deep copy of the node. The path is shared.
+func (c *Clip) Copy() Node {
+	n := NewClip()
+	n.Width = c.Width
+	n.Height = c.Height
+	n.Depth = c.Depth
+	n.Radius = c.Radius
+	n.Path = c.Path
+	n.EvenOdd = c.EvenOdd
+	if c.List != nil {
+		n.List = c.List.Copy()
+	}
+	return n
+}
+
+// NewClip creates an initialized Clip node.
+func NewClip() *Clip {
+	n := clipSlab.alloc()
+	n.ID = newID()
+	n.typ = TypeClip
+	return n
+}
+
+// ClipBox wraps the HList or VList box in a Clip node that clips the box to
+// its own rectangle.
+func ClipBox(box Node) (*Clip, error) {
+	c := NewClip()
+	switch v := box.(type) {
+	case *HList:
+		c.Width, c.Height, c.Depth = v.Width, v.Height, v.Depth
+	case *VList:
+		c.Width, c.Height, c.Depth = v.Width, v.Height, v.Depth
+	default:
+		return nil, fmt.Errorf("ClipBox: cannot clip a %s", box.Type())
+	}
+	box.SetPrev(nil)
+	box.SetNext(nil)
+	c.List = box
+	return c, nil
+}
+
+// ClipPath returns the PDF instructions for the clipping path including the
+// clip operator.
+func (c *Clip) ClipPath() string {
+	p := c.Path
+	if p == nil {
+		p = pdfdraw.New()
+		x1, y1, x2, y2 := bag.ScaledPoint(0), -c.Depth, c.Width, c.Height
+		r := min(c.Radius, (x2-x1)/2, (y2-y1)/2)
+		if r <= 0 {
+			p.Rect(x1, y1, x2-x1, y2-y1)
+		} else {
+			k := r - bag.MultiplyFloat(r, circleKappa)
+			p.Moveto(x1+r, y1).
+				Lineto(x2-r, y1).
+				Curveto(x2-k, y1, x2, y1+k, x2, y1+r).
+				Lineto(x2, y2-r).
+				Curveto(x2, y2-k, x2-k, y2, x2-r, y2).
+				Lineto(x1+r, y2).
+				Curveto(x1+k, y2, x1, y2-k, x1, y2-r).
+				Lineto(x1, y1+r).
+				Curveto(x1, y1+k, x1+k, y1, x1+r, y1).
+				Close()
+		}
+	}
+	op := "W"
+	if c.EvenOdd {
+		op = "W*"
+	}
+	return p.String() + " " + op + " n"
+}
@@ -0,0 +1,40 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+)
+
+func TestClipPath(t *testing.T) {
+	hl := NewHList()
+	hl.Width, hl.Height, hl.Depth = 100*bag.Factor, 8*bag.Factor, 2*bag.Factor
+	c, err := ClipBox(hl)
+	if err != nil {
+		t.Fatalf("ClipBox: %v", err)
+	}
+	if c.Width != hl.Width || c.Height != hl.Height || c.Depth != hl.Depth {
+		t.Errorf("clip %s x %s + %s, want the size of the box", c.Width, c.Height, c.Depth)
+	}
+	if got, want := c.ClipPath(), "0 -2 100 10 re W n"; got != want {
+		t.Errorf("ClipPath() = %q, want %q", got, want)
+	}
+
+	c.Radius = 3 * bag.Factor
+	got := c.ClipPath()
+	if !strings.HasPrefix(got, "3 -2 m 97 -2 l ") || !strings.HasSuffix(got, " h W n") || strings.Count(got, " c") != 4 {
+		t.Errorf("rounded ClipPath() = %q", got)
+	}
+
+	c.Path = pdfdraw.New().Circle(50*bag.Factor, 3*bag.Factor, 5*bag.Factor, 5*bag.Factor)
+	c.EvenOdd = true
+	if got := c.ClipPath(); !strings.HasSuffix(got, " c W* n") {
+		t.Errorf("path ClipPath() = %q", got)
+	}
+
+	if _, err = ClipBox(NewRule()); err == nil {
+		t.Error("ClipBox(rule): no error")
+	}
+}
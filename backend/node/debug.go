@@ -81,6 +81,10 @@ func debugNode(n Node, enc *xml.Encoder) {
 			debugNode(v.List, enc)
 		case *VList:
 			debugNode(v.List, enc)
+		case *Transform:
+			debugNode(v.List, enc)
+		case *Clip:
+			debugNode(v.List, enc)
 		}
 		if err := enc.EncodeToken(start.End()); err != nil {
 			panic(err)
@@ -1,5 +1,17 @@
 package node
 
+// DiscSubtype tells where the hyphenation point comes from.
+type DiscSubtype int
+
+const (
+	// DiscRegular is a hyphenation point inside a word (from hyphenation
+	// patterns or a soft hyphen).
+	DiscRegular DiscSubtype = iota
+	// DiscExplicit is a break opportunity after an explicit hyphen. The
+	// line breaker uses ExHyphenPenalty instead of Hyphenpenalty.
+	DiscExplicit
+)
+
 // A Disc represents a hyphenation point. Currently only the Penalty field is
 // used.
 type Disc struct {
@@ -8,6 +20,7 @@ type Disc struct {
 	Post    Node
 	Replace Node
 	Penalty int // Added to the hyphen penalty
+	Subtype DiscSubtype
 }
 
 func (d *Disc) String() string {
@@ -29,6 +42,7 @@ func (d *Disc) Copy() Node {
 	n.Post = CopyList(d.Post)
 	n.Replace = CopyList(d.Replace)
 	n.Penalty = d.Penalty
+	n.Subtype = d.Subtype
 	return n
 }
 
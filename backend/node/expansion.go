@@ -0,0 +1,123 @@
+package node
+
+import (
+	"math"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// FontExpansionSettings controls the expansion of glyphs (hz algorithm) like
+// pdfTeX's \pdffontexpand and \efcode. Each glyph may be widened or narrowed
+// by its expansion factor times Stretch or Shrink.
+type FontExpansionSettings struct {
+	// Stretch is the maximal expansion as a fraction of the glyph width,
+	// 0.02 allows glyphs to become 2% wider.
+	Stretch float64
+	// Shrink is the maximal compression as a fraction of the glyph width.
+	Shrink float64
+	// Step is the granularity of the expansion. The expansion of each glyph
+	// is rounded to a multiple of Step, 0 allows any amount.
+	Step float64
+	// Factors maps the components of a glyph (see Glyph.Components) to an
+	// expansion factor between 0 and 1. Glyphs not in the table use
+	// DefaultFactor.
+	Factors map[string]float64
+	// DefaultFactor is the expansion factor of glyphs not found in Factors.
+	DefaultFactor float64
+	// Demerits are added to a line that uses the full expansion budget. A
+	// line that uses a part p of the budget gets p² times Demerits.
+	Demerits int
+}
+
+// NewFontExpansionSettings returns expansion settings with the given limits
+// and a default table of expansion factors: round letters expand more than
+// narrow ones such as i and l, punctuation does not expand at all.
+func NewFontExpansionSettings(stretch, shrink, step float64) *FontExpansionSettings {
+	return &FontExpansionSettings{
+		Stretch:       stretch,
+		Shrink:        shrink,
+		Step:          step,
+		Factors:       DefaultExpansionFactors(),
+		DefaultFactor: 1,
+		Demerits:      1000,
+	}
+}
+
+// DefaultExpansionFactors returns a table of expansion factors for Latin
+// glyphs.
+func DefaultExpansionFactors() map[string]float64 {
+	f := map[string]float64{}
+	for _, c := range []string{"i", "j", "l", "I", "J", "!", "'", "|"} {
+		f[c] = 0.5
+	}
+	for _, c := range []string{"f", "r", "t", "1"} {
+		f[c] = 0.7
+	}
+	for _, c := range []string{".", ",", ":", ";", "-", "\"", "(", ")", "[", "]"} {
+		f[c] = 0
+	}
+	return f
+}
+
+// uniformExpansion returns settings that expand all glyphs by up to amount
+// in both directions.
+func uniformExpansion(amount float64) *FontExpansionSettings {
+	return &FontExpansionSettings{Stretch: amount, Shrink: amount, DefaultFactor: 1}
+}
+
+// factor returns the expansion factor of the glyph.
+func (fes *FontExpansionSettings) factor(g *Glyph) float64 {
+	if f, ok := fes.Factors[g.Components]; ok {
+		return f
+	}
+	return fes.DefaultFactor
+}
+
+// stretch returns the amount the glyph can be widened.
+func (fes *FontExpansionSettings) stretch(g *Glyph) bag.ScaledPoint {
+	return bag.MultiplyFloat(g.Width, fes.factor(g)*fes.Stretch)
+}
+
+// shrink returns the amount the glyph can be narrowed.
+func (fes *FontExpansionSettings) shrink(g *Glyph) bag.ScaledPoint {
+	return bag.MultiplyFloat(g.Width, fes.factor(g)*fes.Shrink)
+}
+
+// glyphExpansion returns the expansion of the glyph for the ratio r (-1 to
+// 1) of the expansion budget, rounded to the step size.
+func (fes *FontExpansionSettings) glyphExpansion(g *Glyph, r float64) float64 {
+	limit := fes.Stretch
+	if r < 0 {
+		limit = fes.Shrink
+	}
+	e := r * fes.factor(g) * limit
+	if fes.Step > 0 {
+		e = math.Round(e/fes.Step) * fes.Step
+	}
+	return e
+}
+
+// usedRatio returns the part of the expansion budget that a glyph with
+// factor 1 uses for the ratio r (-1 to 1) after rounding to the step size.
+func (fes *FontExpansionSettings) usedRatio(r float64) float64 {
+	limit := fes.Stretch
+	if r < 0 {
+		limit = fes.Shrink
+	}
+	if limit == 0 {
+		return 0
+	}
+	if fes.Step > 0 {
+		r = math.Round(r*limit/fes.Step) * fes.Step / limit
+	}
+	return max(-1, min(1, r))
+}
+
+// demerits returns the demerits for a line that uses the part r of the
+// expansion budget.
+func (fes *FontExpansionSettings) demerits(r float64) int {
+	if fes == nil || fes.Demerits == 0 {
+		return 0
+	}
+	return int(math.Round(r * r * float64(fes.Demerits)))
+}
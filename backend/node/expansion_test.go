@@ -0,0 +1,164 @@
+package node
+
+import (
+	"math"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// TestHpackExpansion packs "oooo iiii" (10pt per glyph, 5pt glue with 1.6pt
+// stretch) to 87pt. The glyphs have an expansion budget of 2.4pt, so they
+// take 60% of the 2pt difference, and the round letters expand twice as much
+// as the narrow ones.
+func TestHpackExpansion(t *testing.T) {
+	build := func() Node {
+		var head, cur Node
+		head, cur = glyphRun(head, cur, "oooo", 10*bag.Factor)
+		g := NewGlue()
+		g.Width = 5 * bag.Factor
+		g.Stretch = 16 * bag.Factor / 10
+		head = InsertAfter(head, cur, g)
+		head, _ = glyphRun(head, g, "iiii", 10*bag.Factor)
+		return head
+	}
+
+	fes := &FontExpansionSettings{
+		Stretch: 0.04,
+		Shrink:  0.04,
+		Step:    0.005,
+		Factors: map[string]float64{"o": 1, "i": 0.5},
+	}
+	hl := HpackTo(build(), 87*bag.Factor)
+	if hl.List.(*Glyph).Expansion != 0 {
+		t.Fatal("glyphs are expanded without expansion settings")
+	}
+	head := build()
+	hl = HpackToWithEnd(head, Tail(head), 87*bag.Factor, Expansion(fes))
+	var sum bag.ScaledPoint
+	for e := hl.List; e != nil; e = e.Next() {
+		wd, _, _ := e.Sizes(Horizontal)
+		sum += wd
+		gl, ok := e.(*Glyph)
+		if !ok {
+			continue
+		}
+		want := 0.02
+		if gl.Components == "i" {
+			want = 0.01
+		}
+		if math.Abs(gl.Expansion-want) > 1e-9 {
+			t.Errorf("glyph %s has expansion %v, want %v", gl.Components, gl.Expansion, want)
+		}
+	}
+	if diff := sum - 87*bag.Factor; diff < -10 || diff > 10 {
+		t.Errorf("box contents are %s wide, want 87pt", sum)
+	}
+}
+
+// TestLinebreakExpansion breaks "abcd abcd abcd" (5pt per glyph, 5pt glue
+// with 1pt shrink) on a line of 64pt. The line is 70pt wide and can only
+// shrink by 2pt, so it is overfull unless the glyphs are compressed.
+func TestLinebreakExpansion(t *testing.T) {
+	build := func() Node {
+		var head, cur Node
+		for i := range 3 {
+			if i > 0 {
+				g := NewGlue()
+				g.Width = 5 * bag.Factor
+				g.Shrink = 1 * bag.Factor
+				head = InsertAfter(head, cur, g)
+				cur = g
+			}
+			head, cur = glyphRun(head, cur, "abcd", 5*bag.Factor)
+		}
+		AppendLineEndAfter(head, cur)
+		return head
+	}
+	settings := NewLinebreakSettings()
+	settings.HSize = 64 * bag.Factor
+	vl, _ := Linebreak(build(), settings)
+	if hl := vl.List.(*HList); hl.Badness <= 10000 {
+		t.Errorf("without expansion the line has badness %d, want overfull", hl.Badness)
+	}
+
+	settings.Expansion = NewFontExpansionSettings(0.1, 0.1, 0.01)
+	vl, _ = Linebreak(build(), settings)
+	if got := countHLists(vl); got != 1 {
+		t.Fatalf("with expansion got %d lines, want 1", got)
+	}
+	hl := vl.List.(*HList)
+	if hl.Badness > 10000 {
+		t.Errorf("with expansion the line has badness %d", hl.Badness)
+	}
+	for e := hl.List; e != nil; e = e.Next() {
+		if g, ok := e.(*Glyph); ok && g.Expansion >= 0 {
+			t.Errorf("glyph %s has expansion %v, want compression", g.Components, g.Expansion)
+		}
+	}
+}
+
+// TestHpackExpandedGlyphs packs a glyph that is already expanded by 10%
+// without expansion settings. The glyph counts with its expanded width of
+// 11pt, so the glue stretches by 2pt to fill 18pt.
+func TestHpackExpandedGlyphs(t *testing.T) {
+	g := NewGlyph()
+	g.Width = 10 * bag.Factor
+	g.Expansion = 0.1
+	gl := NewGlue()
+	gl.Width = 5 * bag.Factor
+	gl.Stretch = 2 * bag.Factor
+	InsertAfter(g, g, gl)
+	HpackToWithEnd(g, gl, 18*bag.Factor)
+	if gl.Width != 7*bag.Factor {
+		t.Errorf("glue is %s wide, want 7pt", gl.Width)
+	}
+}
+
+// TestLinebreakExpansionDemerits breaks two lines of glyphs that must not expand
+// (the default factor of "." is 0). The demerits are the same as without
+// expansion.
+func TestLinebreakExpansionDemerits(t *testing.T) {
+	build := func() Node {
+		var head, cur Node
+		for i := range 6 {
+			if i > 0 {
+				g := NewGlue()
+				g.Width = 5 * bag.Factor
+				g.Stretch = 2 * bag.Factor
+				g.Shrink = 1 * bag.Factor
+				head = InsertAfter(head, cur, g)
+				cur = g
+			}
+			head, cur = glyphRun(head, cur, "....", 5*bag.Factor)
+		}
+		AppendLineEndAfter(head, cur)
+		return head
+	}
+	settings := NewLinebreakSettings()
+	settings.HSize = 72 * bag.Factor
+	_, bps := Linebreak(build(), settings)
+	want := bps[len(bps)-1].Demerits
+
+	settings.Expansion = NewFontExpansionSettings(0.1, 0.1, 0.01)
+	_, bps = Linebreak(build(), settings)
+	if got := bps[len(bps)-1].Demerits; got != want {
+		t.Errorf("with expansion the demerits are %d, want %d", got, want)
+	}
+}
+
+func TestExpansionUsedRatio(t *testing.T) {
+	fes := NewFontExpansionSettings(0.04, 0.02, 0.01)
+	for _, tc := range []struct{ r, want float64 }{
+		{0, 0},
+		{0.1, 0},   // 0.4% rounds to 0
+		{0.5, 0.5}, // 2%
+		{1, 1},
+		{-0.2, 0}, // -0.4% rounds to 0
+		{-0.5, -0.5},
+	} {
+		if got := fes.usedRatio(tc.r); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("usedRatio(%v) = %v, want %v", tc.r, got, tc.want)
+		}
+	}
+}
@@ -29,6 +29,9 @@ const (
 	// GlueLineEnd is added at the end of each line in a paragraph so that copy
 	// and paste works in PDF.
 	GlueLineEnd
+	// GlueKashida elongates the joining stroke between two Arabic letters.
+	// The Leader holds the tatweel glyph that fills the glue.
+	GlueKashida
 )
 
 // LeaderType determines how leader patterns are aligned.
@@ -93,6 +96,11 @@ func (g *Glue) Copy() Node {
 	n.Shrink = g.Shrink
 	n.StretchOrder = g.StretchOrder
 	n.ShrinkOrder = g.ShrinkOrder
+	n.Subtype = g.Subtype
+	if g.Leader != nil {
+		n.Leader = g.Leader.Copy().(*HList)
+	}
+	n.LeaderType = g.LeaderType
 	return n
 }
 
@@ -30,15 +30,27 @@ type Glyph struct {
 	YOffset bag.ScaledPoint
 	// This allows the glyph to be part of word hyphenation.
 	Hyphenate bool
+	// Expansion is the horizontal scaling of the glyph set by font
+	// expansion, 0.02 makes the glyph 2% wider. Width is the unexpanded
+	// width.
+	Expansion float64
+	// Upright glyphs belong to a vertical line that is set horizontally and
+	// turned clockwise onto the page (see the writing modes of the
+	// frontend). The glyph is drawn turned counterclockwise so that it
+	// stands upright. Width is the vertical advance, XOffset and YOffset
+	// are the position of the glyph's horizontal origin relative to the
+	// pen position on the line.
+	Upright bool
 }
 
 func (g *Glyph) String() string {
 	return String(g)
 }
 
-// Sizes returns the glyph's advance width, height and depth.
+// Sizes returns the glyph's advance width (including the expansion),
+// height and depth.
 func (g *Glyph) Sizes(Direction) (w, h, d bag.ScaledPoint) {
-	return g.Width, g.Height, g.Depth
+	return g.Width + bag.MultiplyFloat(g.Width, g.Expansion), g.Height, g.Depth
 }
 
 // DebugAttributes returns the glyph's full descriptive attribute set
@@ -69,8 +81,11 @@ func (g *Glyph) Copy() Node {
 	n.Height = g.Height
 	n.Depth = g.Depth
 	n.Hyphenate = g.Hyphenate
+	n.XOffset = g.XOffset
 	n.YOffset = g.YOffset
 	n.Hyphenate = g.Hyphenate
+	n.Expansion = g.Expansion
+	n.Upright = g.Upright
 	return n
 }
 
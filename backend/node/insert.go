@@ -0,0 +1,303 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// An Insert carries vertical material that is placed at the bottom of the
+// page on which the insert lands, such as a footnote (TeX's \insert). The
+// insert itself has no size and stays where it was put, usually inside a
+// line of a paragraph next to the footnote mark. Pagebreak collects the
+// inserts of each page and reserves room for their material (see
+// InsertSettings).
+type Insert struct {
+	basenode
+	// List is the material to be placed at the bottom of the page.
+	List *VList
+	// Number is the footnote number or 0 if the insert is not numbered.
+	Number int
+}
+
+func (ins *Insert) String() string {
+	return fmt.Sprintf("insert: %d", ins.Number)
+}
+
+// DebugAttributes returns the number and the height of the insert material.
+func (ins *Insert) DebugAttributes() ([]kv, H) {
+	var ht bag.ScaledPoint
+	if ins.List != nil {
+		ht = ins.List.Height + ins.List.Depth
+	}
+	return []kv{
+		{key: "id", value: ins.ID},
+		{key: "number", value: ins.Number},
+		{key: "height", value: ht},
+	}, ins.Attributes
+}
+
+// Copy creates a deep copy of the node.
+func (ins *Insert) Copy() Node {
+	n := NewInsert()
+	if ins.List != nil {
+		n.List = ins.List.Copy().(*VList)
+	}
+	n.Number = ins.Number
+	return n
+}
+
+// NewInsert creates an initialized Insert node.
+func NewInsert() *Insert {
+	n := insertSlab.alloc()
+	n.ID = newID()
+	n.typ = TypeInsert
+	return n
+}
+
+// FindInserts returns all inserts in the list starting at n, including the
+// inserts in nested lists (see Walk), in the order of the list.
+func FindInserts(n Node) []*Insert {
+	var inserts []*Insert
+	Walk(n, func(e Node) bool {
+		if ins, ok := e.(*Insert); ok {
+			inserts = append(inserts, ins)
+		}
+		return true
+	})
+	return inserts
+}
+
+// nodeInserts returns the inserts in n without looking at the nodes
+// following n.
+func nodeInserts(n Node) []*Insert {
+	switch v := n.(type) {
+	case *Insert:
+		return []*Insert{v}
+	case *HList:
+		return FindInserts(v.List)
+	case *VList:
+		return FindInserts(v.List)
+	case *Transform:
+		return FindInserts(v.List)
+	case *Clip:
+		return FindInserts(v.List)
+	}
+	return nil
+}
+
+// InsertSettings controls the placement of inserts on the page.
+type InsertSettings struct {
+	// Skip is the glue between the text and the separator (TeX's
+	// \skip\footins).
+	Skip *Glue
+	// Separator is vertical material placed between the text and the
+	// inserts, usually a short rule. It is copied for every page. nil
+	// places no separator.
+	Separator Node
+	// MaxHeight is the largest amount of insert material on a page (TeX's
+	// \dimen\footins), 0 allows the whole page.
+	MaxHeight bag.ScaledPoint
+	// SplitPenalty is the penalty for every insert that has to be split or
+	// moved to the next page (TeX's \floatingpenalty). Like the penalty at a
+	// page break, its square is added to the demerits of the page.
+	SplitPenalty int
+	// Renumber is called for every page with the page number and the
+	// inserts whose reference is on the page before the page is assembled.
+	// It can change the Number and the List of the inserts, for example to
+	// restart the footnote numbers on every page. nil keeps the inserts as
+	// they are.
+	Renumber func(page int, inserts []*Insert)
+}
+
+// NewInsertSettings returns insert settings like plain TeX's footnotes: 12pt
+// plus 4pt minus 4pt above a rule 2in wide and 0.4pt high and a split
+// penalty of 20000.
+func NewInsertSettings() *InsertSettings {
+	skip := NewGlue()
+	skip.Width = 12 * bag.Factor
+	skip.Stretch = 4 * bag.Factor
+	skip.Shrink = 4 * bag.Factor
+	skip.Attributes = H{"origin": "insert skip"}
+
+	above := NewKern()
+	above.Kern = -3 * bag.Factor
+	rule := NewRule()
+	rule.Width = 144 * bag.Factor
+	rule.Height = bag.Factor * 4 / 10
+	rule.Attributes = H{"origin": "insert separator"}
+	below := NewKern()
+	below.Kern = bag.Factor * 26 / 10
+	sep := InsertAfter(above, above, rule)
+	InsertAfter(sep, rule, below)
+
+	return &InsertSettings{
+		Skip:         skip,
+		Separator:    sep,
+		SplitPenalty: 20000,
+	}
+}
+
+// insertPart is the part of the material of an insert that starts at the
+// index from of the insert's items and ends before to.
+type insertPart struct {
+	ins      *Insert
+	from, to int
+}
+
+// insertItems returns the top level items of the insert material. The slice
+// is cached as long as the insert's list is not replaced.
+func (pb *pagebreaker) insertItems(ins *Insert) []Node {
+	if ins.List == nil {
+		return nil
+	}
+	if c, ok := pb.insertCache[ins]; ok && c.list == ins.List {
+		return c.items
+	}
+	var items []Node
+	for e := ins.List.List; e != nil; e = e.Next() {
+		items = append(items, e)
+	}
+	if pb.insertCache == nil {
+		pb.insertCache = make(map[*Insert]insertItemCache)
+	}
+	pb.insertCache[ins] = insertItemCache{list: ins.List, items: items}
+	return items
+}
+
+// insertItemCache holds the items of an insert's list.
+type insertItemCache struct {
+	list  *VList
+	items []Node
+}
+
+// separatorHeight returns the height of the skip and the separator.
+func (is *InsertSettings) separatorHeight() bag.ScaledPoint {
+	var ht bag.ScaledPoint
+	if is.Skip != nil {
+		ht += is.Skip.Width
+	}
+	for e := is.Separator; e != nil; e = e.Next() {
+		ht += verticalSize(e)
+	}
+	return ht
+}
+
+// placeInserts puts the parts one after another into the available height.
+// The first part that does not fit is split at the last legal breakpoint
+// that fits. The rest of it and all following parts are returned as carry.
+// height is the height of the placed parts without the separator.
+func (pb *pagebreaker) placeInserts(parts []insertPart, available bag.ScaledPoint) (placed, carry []insertPart, height bag.ScaledPoint) {
+	for i, p := range parts {
+		items := pb.insertItems(p.ins)
+		var partHeight bag.ScaledPoint
+		for _, itm := range items[p.from:p.to] {
+			partHeight += verticalSize(itm)
+		}
+		if height+partHeight <= available {
+			placed = append(placed, p)
+			height += partHeight
+			continue
+		}
+		// Split p at the last breakpoint that fits.
+		split := &pagebreaker{items: items}
+		best := -1
+		var h, bestHeight bag.ScaledPoint
+		for j := p.from; j < p.to; j++ {
+			if j > p.from && height+h <= available {
+				if _, ok := split.isPagebreakCandidate(j); ok && !onlyDiscardable(items[p.from:j]) {
+					best, bestHeight = j, h
+				}
+			}
+			h += verticalSize(items[j])
+			if height+h > available {
+				break
+			}
+		}
+		rest := p
+		if best > 0 {
+			placed = append(placed, insertPart{ins: p.ins, from: p.from, to: best})
+			height += bestHeight
+			rest.from = best
+			for rest.from < rest.to && isDiscardable(items[rest.from]) {
+				rest.from++
+			}
+		}
+		if rest.from < rest.to {
+			carry = append(carry, rest)
+		}
+		carry = append(carry, parts[i+1:]...)
+		break
+	}
+	return placed, carry, height
+}
+
+// pageInserts returns the carried parts followed by the inserts that are
+// referenced in the items from start up to b.
+func (pb *pagebreaker) pageInserts(carry []insertPart, start, b int) []insertPart {
+	parts := append([]insertPart(nil), carry...)
+	for _, ins := range pb.inserts[pb.insertIndex[start]:pb.insertIndex[b]] {
+		if items := pb.insertItems(ins); len(items) > 0 {
+			parts = append(parts, insertPart{ins: ins, to: len(items)})
+		}
+	}
+	return parts
+}
+
+// insertSums returns the sums of the insert area for the parts on a page
+// with the body sums s and the parts carried to the next page.
+func (pb *pagebreaker) insertSums(parts []insertPart, s vsums) (vsums, []insertPart, []insertPart) {
+	is := pb.settings.Inserts
+	if is == nil || len(parts) == 0 {
+		return vsums{}, nil, parts
+	}
+	sepHeight := is.separatorHeight()
+	available := pb.settings.PageHeight - s.height - sepHeight
+	if is.MaxHeight > 0 {
+		available = min(available, is.MaxHeight)
+	}
+	placed, carry, ht := pb.placeInserts(parts, available)
+	if len(placed) == 0 {
+		return vsums{}, nil, carry
+	}
+	ins := vsums{height: sepHeight + ht}
+	if is.Skip != nil {
+		ins.stretch[is.Skip.StretchOrder] += is.Skip.Stretch
+		ins.shrink += is.Skip.Shrink
+	}
+	return ins, placed, carry
+}
+
+// buildInsertArea returns the vertical list of the skip, the separator and
+// the placed parts. The items of the parts are moved into the new list.
+func (pb *pagebreaker) buildInsertArea(placed []insertPart) Node {
+	is := pb.settings.Inserts
+	var head, tail Node
+	add := func(n Node) {
+		head = InsertAfter(head, tail, n)
+		tail = Tail(n)
+	}
+	if is.Skip != nil {
+		g := is.Skip.Copy().(*Glue)
+		g.Attributes = H{"origin": "insert skip"}
+		add(g)
+	}
+	if is.Separator != nil {
+		add(CopyList(is.Separator))
+	}
+	for _, p := range placed {
+		items := pb.insertItems(p.ins)
+		if p.from == 0 && p.to == len(items) {
+			p.ins.List.SetPrev(nil)
+			p.ins.List.SetNext(nil)
+			add(p.ins.List)
+			continue
+		}
+		items[p.from].SetPrev(nil)
+		items[p.to-1].SetNext(nil)
+		vl := Vpack(items[p.from])
+		vl.Attributes = H{"origin": "split insert"}
+		add(vl)
+	}
+	return head
+}
@@ -0,0 +1,154 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// insertLines returns an insert with n lines of 8pt height separated by glue
+// of 2pt.
+func insertLines(n int) *Insert {
+	var head, cur Node
+	for i := range n {
+		if i > 0 {
+			g := NewGlue()
+			g.Width = 2 * bag.Factor
+			head = InsertAfter(head, cur, g)
+			cur = g
+		}
+		hl := lineBox(8 * bag.Factor)
+		head = InsertAfter(head, cur, hl)
+		cur = hl
+	}
+	ins := NewInsert()
+	ins.List = Vpack(head)
+	return ins
+}
+
+// linesWithInsert returns buildLines(n, 0) with ins in the line with the
+// index at.
+func linesWithInsert(n, at int, ins *Insert) *VList {
+	vl := buildLines(n, 0)
+	i := 0
+	for e := vl.List; e != nil; e = e.Next() {
+		if hl, ok := e.(*HList); ok {
+			if i == at {
+				hl.List = ins
+			}
+			i++
+		}
+	}
+	return vl
+}
+
+// insertSettings returns simple insert settings: a 4pt skip and no separator.
+func insertSettings() *InsertSettings {
+	is := NewInsertSettings()
+	is.Skip = NewGlue()
+	is.Skip.Width = 4 * bag.Factor
+	is.Separator = nil
+	return is
+}
+
+// footnoteLines returns the number of lines in the insert material of the
+// page.
+func footnoteLines(pg *VList) int {
+	n := 0
+	for e := pg.List; e != nil; e = e.Next() {
+		if vl, ok := e.(*VList); ok {
+			n += countHLists(vl)
+		}
+	}
+	return n
+}
+
+func TestFindInserts(t *testing.T) {
+	ins := insertLines(2)
+	vl := linesWithInsert(3, 1, ins)
+	found := FindInserts(vl.List)
+	if len(found) != 1 || found[0] != ins {
+		t.Errorf("FindInserts = %v, want the insert", found)
+	}
+}
+
+// TestPagebreakInsert puts a footnote of 28pt into the second line. With the
+// 4pt skip only two lines of 10pt fit on the first page of 60pt.
+func TestPagebreakInsert(t *testing.T) {
+	vl := linesWithInsert(10, 1, insertLines(3))
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 60 * bag.Factor
+	settings.Inserts = insertSettings()
+	pages, _ := Pagebreak(vl, settings)
+	if len(pages) != 3 {
+		t.Fatalf("got %d pages, want 3", len(pages))
+	}
+	wantLines := []int{2, 5, 3}
+	wantFootnotes := []int{3, 0, 0}
+	for i, pg := range pages {
+		if got := countHLists(pg); got != wantLines[i] {
+			t.Errorf("page %d has %d lines, want %d", i+1, got, wantLines[i])
+		}
+		if got := footnoteLines(pg); got != wantFootnotes[i] {
+			t.Errorf("page %d has %d footnote lines, want %d", i+1, got, wantFootnotes[i])
+		}
+		if pg.Height+pg.Depth > settings.PageHeight {
+			t.Errorf("page %d is %s high, exceeds %s", i+1, pg.Height+pg.Depth, settings.PageHeight)
+		}
+	}
+}
+
+// TestPagebreakInsertSplit limits the footnotes to 30pt per page, so a
+// footnote of ten lines is split over four pages. Renumber is called for
+// the page with the reference only.
+func TestPagebreakInsertSplit(t *testing.T) {
+	ins := insertLines(10)
+	ins.Number = 7
+	vl := linesWithInsert(4, 0, ins)
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 60 * bag.Factor
+	settings.Inserts = insertSettings()
+	settings.Inserts.MaxHeight = 30 * bag.Factor
+	renumbered := map[int]int{}
+	settings.Inserts.Renumber = func(page int, inserts []*Insert) {
+		for i, ins := range inserts {
+			ins.Number = i + 1
+		}
+		renumbered[page] = len(inserts)
+	}
+	pages, bps := Pagebreak(vl, settings)
+	if len(pages) != 4 {
+		t.Fatalf("got %d pages, want 4", len(pages))
+	}
+	if len(bps) != len(pages) {
+		t.Errorf("got %d breakpoints for %d pages", len(bps), len(pages))
+	}
+	total := 0
+	for i, pg := range pages {
+		n := footnoteLines(pg)
+		if n > 3 {
+			t.Errorf("page %d has %d footnote lines, want at most 3", i+1, n)
+		}
+		total += n
+	}
+	if total != 10 {
+		t.Errorf("got %d footnote lines, want 10", total)
+	}
+	if countHLists(pages[0]) != 4 {
+		t.Errorf("first page has %d lines, want 4", countHLists(pages[0]))
+	}
+	if renumbered[1] != 1 || ins.Number != 1 {
+		t.Errorf("renumbered %v, number %d, want one insert on page 1 with number 1", renumbered, ins.Number)
+	}
+}
+
+func TestPagebreakNoInsertSettings(t *testing.T) {
+	vl := linesWithInsert(3, 0, insertLines(3))
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 60 * bag.Factor
+	settings.Inserts = nil
+	pages, _ := Pagebreak(vl, settings)
+	if len(pages) != 1 || footnoteLines(pages[0]) != 0 {
+		t.Errorf("inserts should be ignored without settings")
+	}
+}
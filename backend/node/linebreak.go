@@ -46,11 +46,15 @@ type Breakpoint struct {
 	Fitness                               int
 	Width                                 bag.ScaledPoint
 	sumW, sumY, sumZ                      bag.ScaledPoint
-	sumExpand                             bag.ScaledPoint
-	calculatedExpand                      bag.ScaledPoint
+	sumExpandStretch, sumExpandShrink     bag.ScaledPoint
 	stretchFil, stretchFill, stretchFilll bag.ScaledPoint
 	R                                     float64
 	Demerits                              int
+	hyphens                               int
+	// Looseness is the difference between the number of lines of the
+	// chosen solution and the optimal one. Set by Linebreak when
+	// LinebreakSettings.Looseness is not zero.
+	Looseness int
 }
 
 func (bp *Breakpoint) String() string {
@@ -69,7 +73,9 @@ type linebreaker struct {
 	preva            *Breakpoint
 	settings         *LinebreakSettings
 	sumW, sumY, sumZ bag.ScaledPoint
-	sumExpand        bag.ScaledPoint
+	expansion        *FontExpansionSettings
+	sumExpandStretch bag.ScaledPoint
+	sumExpandShrink  bag.ScaledPoint
 	stretchFil       bag.ScaledPoint
 	stretchFill      bag.ScaledPoint
 	stretchFilll     bag.ScaledPoint
@@ -77,7 +83,11 @@ type linebreaker struct {
 
 func newLinebreaker(settings *LinebreakSettings) *linebreaker {
 	lb := &linebreaker{
-		settings: settings,
+		settings:  settings,
+		expansion: settings.Expansion,
+	}
+	if lb.expansion == nil && settings.FontExpansion != 0 {
+		lb.expansion = uniformExpansion(settings.FontExpansion)
 	}
 	return lb
 }
@@ -89,7 +99,7 @@ func newLinebreaker(settings *LinebreakSettings) *linebreaker {
 // available. The paper writes r := ∞ here, but the active-deactivation
 // criterion for this case is *not* simply r < -1; it has to be tested as a
 // separate condition on the (L > l_j, Z = 0) state, which this flag carries.
-func (lb *linebreaker) computeAdjustmentRatio(n Node, a *Breakpoint) (r float64, sumExpand bag.ScaledPoint, overfullNoShrink bool) {
+func (lb *linebreaker) computeAdjustmentRatio(n Node, a *Breakpoint) (r float64, overfullNoShrink bool) {
 	// compute the adjustment ratio r from a to n
 	thisLineWidth := lb.sumW - a.sumW
 	switch t := n.(type) {
@@ -109,9 +119,10 @@ func (lb *linebreaker) computeAdjustmentRatio(n Node, a *Breakpoint) (r float64,
 			}
 		}
 	}
-	// subtract left glue setting
-	maxwd := lb.settings.HSize - lb.getIndent(a.Line)
-	sumExpand = lb.sumExpand - a.sumExpand
+	if ps := lb.settings.Protrusion; ps != nil {
+		thisLineWidth -= lb.lineProtrusion(ps, a, n)
+	}
+	maxwd := lb.lineWidth(a.Line)
 	if thisLineWidth < maxwd {
 		// needs to stretch. EmergencyStretch (TeX \emergencystretch) is added
 		// to the per-line stretch capacity unconditionally — it acts as a
@@ -130,17 +141,18 @@ func (lb *linebreaker) computeAdjustmentRatio(n Node, a *Breakpoint) (r float64,
 		// line itself has no normal stretch reservoir.
 		hasFilStretch := (lb.stretchFil-a.stretchFil) > 0 || (lb.stretchFill-a.stretchFill) > 0 || (lb.stretchFilll-a.stretchFilll) > 0
 		if !hasFilStretch {
-			if g := lb.settings.LineEndGlue; g != nil && g.StretchOrder >= StretchFil && g.Stretch > 0 {
+			startGlue, endGlue := lb.lineGlues(n)
+			if g := endGlue; g != nil && g.StretchOrder >= StretchFil && g.Stretch > 0 {
 				hasFilStretch = true
 			}
-			if g := lb.settings.LineStartGlue; g != nil && g.StretchOrder >= StretchFil && g.Stretch > 0 {
+			if g := startGlue; g != nil && g.StretchOrder >= StretchFil && g.Stretch > 0 {
 				hasFilStretch = true
 			}
 		}
 		if hasFilStretch {
 			r = 0
 		} else {
-			y := lb.sumY - a.sumY + sumExpand + lb.settings.EmergencyStretch
+			y := lb.sumY - a.sumY + lb.sumExpandStretch - a.sumExpandStretch + lb.settings.EmergencyStretch
 			if y > 0 {
 				r = float64(maxwd-thisLineWidth) / float64(y)
 			} else {
@@ -149,7 +161,7 @@ func (lb *linebreaker) computeAdjustmentRatio(n Node, a *Breakpoint) (r float64,
 		}
 	} else if maxwd < thisLineWidth {
 		// needs to shrink
-		z := lb.sumZ - a.sumZ + sumExpand
+		z := lb.sumZ - a.sumZ + lb.sumExpandShrink - a.sumExpandShrink
 		if z > 0 {
 			r = float64(maxwd-thisLineWidth) / float64(z)
 		} else {
@@ -162,14 +174,56 @@ func (lb *linebreaker) computeAdjustmentRatio(n Node, a *Breakpoint) (r float64,
 			overfullNoShrink = true
 		}
 	}
-	return r, sumExpand, overfullNoShrink
+	return r, overfullNoShrink
+}
+
+// isParagraphEnd reports whether n is the forced break that ends the
+// paragraph.
+func isParagraphEnd(n Node) bool {
+	return n.Next() == nil && isForcedBreak(n)
+}
+
+// lineGlues returns the glue inserted at the start and at the end of the
+// line that ends at n. The last line of the paragraph uses LastLineStartGlue
+// and LastLineEndGlue if they are set.
+func (lb *linebreaker) lineGlues(n Node) (*Glue, *Glue) {
+	startGlue, endGlue := lb.settings.LineStartGlue, lb.settings.LineEndGlue
+	if isParagraphEnd(n) {
+		if lb.settings.LastLineStartGlue != nil {
+			startGlue = lb.settings.LastLineStartGlue
+		}
+		if lb.settings.LastLineEndGlue != nil {
+			endGlue = lb.settings.LastLineEndGlue
+		}
+	}
+	return startGlue, endGlue
+}
+
+// applyParFillSkip replaces the glue at the end of the paragraph (see
+// AppendLineEndAfter) by settings.ParFillSkip.
+func (lb *linebreaker) applyParFillSkip(n Node) {
+	pfs := lb.settings.ParFillSkip
+	if pfs == nil {
+		return
+	}
+	tail := Tail(n)
+	if !isForcedBreak(tail) || tail.Prev() == nil {
+		return
+	}
+	if g, ok := tail.Prev().(*Glue); ok && g.Attributes["origin"] == "lineend" {
+		g.Width = pfs.Width
+		g.Stretch = pfs.Stretch
+		g.Shrink = pfs.Shrink
+		g.StretchOrder = pfs.StretchOrder
+		g.ShrinkOrder = pfs.ShrinkOrder
+	}
 }
 
 // computeSum computes the sum of all glues from n
-func (lb *linebreaker) computeSum(n Node) (bag.ScaledPoint, bag.ScaledPoint, bag.ScaledPoint, bag.ScaledPoint) {
+func (lb *linebreaker) computeSum(n Node) (w, es, ez, y, z bag.ScaledPoint) {
 	// compute tw=(sum w)after(b), ty=(sum y)after(b), and tz=(sum z)after(b)
-	w, y, z := lb.sumW, lb.sumY, lb.sumZ
-	e := lb.sumExpand
+	w, y, z = lb.sumW, lb.sumY, lb.sumZ
+	es, ez = lb.sumExpandStretch, lb.sumExpandShrink
 	stretchFil, stretchFill, stretchFilll := lb.stretchFil, lb.stretchFill, lb.stretchFilll
 compute:
 	for e := n; e != nil; e = e.Next() {
@@ -199,7 +253,7 @@ compute:
 			break compute
 		}
 	}
-	return w, e, y, z
+	return w, es, ez, y, z
 }
 
 func (lb *linebreaker) removeActiveNode(active *Breakpoint) {
@@ -239,7 +293,11 @@ func (lb *linebreaker) calculateDemerits(active *Breakpoint, r float64, n Node)
 	case *HardBreak:
 		curpenalty = -10000
 	case *Disc:
-		curpenalty = lb.settings.Hyphenpenalty + t.Penalty
+		if t.Subtype == DiscExplicit {
+			curpenalty = lb.settings.ExHyphenPenalty + t.Penalty
+		} else {
+			curpenalty = lb.settings.Hyphenpenalty + t.Penalty
+		}
 		curflagged = true
 	}
 	switch {
@@ -257,6 +315,17 @@ func (lb *linebreaker) calculateDemerits(active *Breakpoint, r float64, n Node)
 		}
 	}
 
+	if isParagraphEnd(n) && isHyphenBreak(active.Position) {
+		demerits += lb.settings.FinalHyphenDemerits
+	}
+
+	if lb.settings.MinLastLineFill > 0 && isParagraphEnd(n) {
+		wd := lb.sumW - active.sumW
+		if float64(wd) < lb.settings.MinLastLineFill*float64(lb.lineWidth(active.Line)) {
+			demerits += lb.settings.ShortLastLineDemerits
+		}
+	}
+
 	// calculate fitness class
 	fitnessClass = calculateFitnessClass(r)
 	// if fitnessClass and active.Fitness differs by more then 1, add DemeritsFitness
@@ -289,7 +358,25 @@ func (lb *linebreaker) calculateDemerits(active *Breakpoint, r float64, n Node)
 	return
 }
 
+// parshapeLine returns the entry of the paragraph shape for row. Rows beyond
+// the end of the shape use the last entry.
+func (lb *linebreaker) parshapeLine(row int) ParshapeLine {
+	ps := lb.settings.Parshape
+	return ps[min(row, len(ps)-1)]
+}
+
+// lineWidth returns the width available for the text of row (starting at 0).
+func (lb *linebreaker) lineWidth(row int) bag.ScaledPoint {
+	if len(lb.settings.Parshape) > 0 {
+		return lb.parshapeLine(row).Width
+	}
+	return lb.settings.HSize - lb.getIndent(row)
+}
+
 func (lb *linebreaker) getIndent(row int) bag.ScaledPoint {
+	if len(lb.settings.Parshape) > 0 {
+		return lb.parshapeLine(row).Indent
+	}
 	rows := lb.settings.IndentRows
 	switch {
 	case rows == 0:
@@ -309,6 +396,75 @@ func (lb *linebreaker) getIndent(row int) bag.ScaledPoint {
 	return bag.ScaledPoint(0)
 }
 
+// interlinePenalty returns the penalty between line and the next line of a
+// paragraph with lines lines (TeX's \interlinepenalty, \clubpenalty,
+// \widowpenalty and \brokenpenalty).
+func (lb *linebreaker) interlinePenalty(line, lines int, hyphenated bool) int {
+	pen := lb.settings.InterLinePenalty
+	if line == 1 {
+		pen += lb.settings.ClubPenalty
+	}
+	if line == lines-1 {
+		pen += lb.settings.WidowPenalty
+	}
+	if hyphenated {
+		pen += lb.settings.BrokenPenalty
+	}
+	return pen
+}
+
+// lineProtrusion returns the amount the glyphs at the edges of the line from
+// the active node a to the break at n hang into the margins.
+func (lb *linebreaker) lineProtrusion(ps *ProtrusionSet, a *Breakpoint, n Node) bag.ScaledPoint {
+	start := a.Position
+	if start.Prev() != nil {
+		start = start.Next()
+	}
+	var last *Glyph
+	if d, ok := n.(*Disc); ok && isHyphenBreak(d) && d.Pre != nil {
+		last = rightMarginGlyph(Tail(d.Pre), nil)
+	} else {
+		last = rightMarginGlyph(n.Prev(), a.Position)
+	}
+	return ps.left(leftMarginGlyph(start, n)) + ps.right(last)
+}
+
+// isHyphenBreak reports whether n is a discretionary inside a word.
+func isHyphenBreak(n Node) bool {
+	if _, ok := n.(*Disc); !ok {
+		return false
+	}
+	_, isGlue := n.Next().(*Glue)
+	return !isGlue
+}
+
+// hyphensAfter returns the number of consecutive hyphenated lines when
+// breaking at n after active.
+func hyphensAfter(active *Breakpoint, n Node) int {
+	if isHyphenBreak(n) {
+		return active.hyphens + 1
+	}
+	return 0
+}
+
+// usedExpansion returns the part (-1 to 1) of the expansion budget that the
+// glyphs of the line from a use at the adjustment ratio r. It is 0 if the
+// line has no glyphs that can expand in that direction or if the expansion
+// rounds to zero.
+func (lb *linebreaker) usedExpansion(a *Breakpoint, r float64) float64 {
+	var budget bag.ScaledPoint
+	switch {
+	case r > 0:
+		budget = lb.sumExpandStretch - a.sumExpandStretch
+	case r < 0:
+		budget = lb.sumExpandShrink - a.sumExpandShrink
+	}
+	if budget <= 0 {
+		return 0
+	}
+	return lb.expansion.usedRatio(max(-1, min(1, r)))
+}
+
 func (lb *linebreaker) mainLoop(n Node) {
 	active := lb.activeNodesA
 	lb.preva = nil
@@ -330,7 +486,6 @@ func (lb *linebreaker) mainLoop(n Node) {
 		dc := [4]int{math.MaxInt, math.MaxInt, math.MaxInt, math.MaxInt}
 		ac := [4]*Breakpoint{}
 		rc := [4]float64{}
-		ec := [4]bag.ScaledPoint{}
 
 		// The inner loop deactivates all unreachable breakpoints and calculates
 		// demerits/dmin.
@@ -340,7 +495,7 @@ func (lb *linebreaker) mainLoop(n Node) {
 			// For each active breakpoint check if the breakpoint is still
 			// active (= reachable from the current position backward). If not,
 			// remove them from the current list of active nodes.
-			r, sumExpand, overfullNoShrink := lb.computeAdjustmentRatio(n, active)
+			r, overfullNoShrink := lb.computeAdjustmentRatio(n, active)
 
 			// Knuth-Plass 1981 §4: deactivate active a if the line a→b is
 			// definitively overfull, i.e. either r < -1 (Z > 0 but shrink
@@ -365,9 +520,17 @@ func (lb *linebreaker) mainLoop(n Node) {
 			// There might be active breakpoints (after cleanup), so all of them
 			// are a candidate for a final breakpoint. For each fitness class,
 			// we chose the best candidate (with the fewest total demerits)
-			if -1 <= r && r < lb.settings.Tolerance {
+			// MaxConsecutiveHyphens is a hard limit, so too many hyphenated
+			// lines in a row make the break infeasible.
+			tooManyHyphens := lb.settings.MaxConsecutiveHyphens > 0 && hyphensAfter(active, n) > lb.settings.MaxConsecutiveHyphens
+			if -1 <= r && r < lb.settings.Tolerance && !tooManyHyphens {
 				// That looks like a good breakpoint.
 				c, demerits := lb.calculateDemerits(active, r, n)
+				if lb.expansion != nil {
+					if d := lb.expansion.demerits(lb.usedExpansion(active, r)); demerits < math.MaxInt-d {
+						demerits += d
+					}
+				}
 
 				// Update candidate if (and only if) the total demerits are less
 				// than the previous total demerits for this fitness class.
@@ -377,7 +540,6 @@ func (lb *linebreaker) mainLoop(n Node) {
 					dc[c] = demerits
 					ac[c] = active
 					rc[c] = r
-					ec[c] = sumExpand
 					if demerits < dmin {
 						dmin = demerits
 					}
@@ -390,17 +552,21 @@ func (lb *linebreaker) mainLoop(n Node) {
 			}
 			// The next active node can be in the next line, so we quit the
 			// calculation of the best breakpoint. This works, because the list
-			// of active nodes are ordered ascending (wrt line number).
+			// of active nodes are ordered ascending (wrt line number). The
+			// new breakpoints are therefore kept per line number and fitness
+			// class (TeX §835 without easy_line), so a solution with more or
+			// fewer lines is not dominated by a better one with the same
+			// fitness class. Looseness depends on this.
 			if j <= active.Line {
 				// we omitted (j < j0) as j0 is difficult to know for complex cases
 				break
 			}
 		}
 		if dmin < math.MaxInt {
-			lb.appendBreakpointHere(n, dmin, dc, ac, rc, ec, active)
+			lb.appendBreakpointHere(n, dmin, dc, ac, rc, active)
 		}
 		if dmin == math.MaxInt && lb.activeNodesA == nil {
-			W, E, Y, Z := lb.computeSum(n)
+			W, ES, EZ, Y, Z := lb.computeSum(n)
 			// Anchor the forced overfull line. Prefer the best overfull
 			// breakpoint found this round (latest position, fewest demerits)
 			// so an unbreakable run wider than HSize — e.g. a long URL, or
@@ -435,12 +601,13 @@ func (lb *linebreaker) mainLoop(n Node) {
 				Fitness:          3,
 				Width:            lb.sumW - lastInactive.sumW,
 				sumW:             W,
-				sumExpand:        E,
+				sumExpandStretch: ES,
+				sumExpandShrink:  EZ,
 				sumY:             Y,
 				sumZ:             Z,
-				calculatedExpand: lb.sumExpand - lastInactive.sumExpand,
 				R:                0,
 				Demerits:         lastInactive.Demerits + 1000,
+				hyphens:          hyphensAfter(lastInactive, n),
 				stretchFil:       lb.stretchFil,
 				stretchFill:      lb.stretchFill,
 				stretchFilll:     lb.stretchFilll,
@@ -450,8 +617,8 @@ func (lb *linebreaker) mainLoop(n Node) {
 	}
 }
 
-func (lb *linebreaker) appendBreakpointHere(n Node, dmin int, dc [4]int, ac [4]*Breakpoint, rc [4]float64, ec [4]bag.ScaledPoint, active *Breakpoint) {
-	W, E, Y, Z := lb.computeSum(n)
+func (lb *linebreaker) appendBreakpointHere(n Node, dmin int, dc [4]int, ac [4]*Breakpoint, rc [4]float64, active *Breakpoint) {
+	W, ES, EZ, Y, Z := lb.computeSum(n)
 
 	width := lb.sumW
 	var pre Node
@@ -475,12 +642,13 @@ func (lb *linebreaker) appendBreakpointHere(n Node, dmin int, dc [4]int, ac [4]*
 				Fitness:          c,
 				Width:            width - ac[c].Width,
 				sumW:             W,
-				sumExpand:        E,
+				sumExpandStretch: ES,
+				sumExpandShrink:  EZ,
 				sumY:             Y,
 				sumZ:             Z,
-				calculatedExpand: ec[c],
 				R:                rc[c],
 				Demerits:         dc[c],
+				hyphens:          hyphensAfter(ac[c], n),
 				stretchFil:       lb.stretchFil,
 				stretchFill:      lb.stretchFill,
 				stretchFilll:     lb.stretchFilll,
@@ -501,12 +669,29 @@ func (lb *linebreaker) appendNewBreakpoint(bp *Breakpoint) {
 
 // Linebreak breaks the node list starting at n into lines. Returns a VList of
 // HLists and information about each line.
+//
+// If settings.Parshape is set, each line gets its own indent and width
+// instead of HSize, Indent and IndentRows. A Looseness other than zero asks
+// for a paragraph that is that many lines longer (or shorter) than the
+// optimum, if this is possible within the tolerance.
+//
+// The glue at the end of the paragraph can be changed with ParFillSkip and
+// the last line can get its own LastLineStartGlue and LastLineEndGlue, for
+// example to justify or center the last line. If MinLastLineFill is set, a
+// last line whose natural width is less than this fraction of the line width
+// gets ShortLastLineDemerits extra demerits.
+//
+// Between two lines Linebreak inserts a penalty made up of InterLinePenalty,
+// ClubPenalty (after the first line), WidowPenalty (before the last line) and
+// BrokenPenalty (after a hyphenated line), so a page breaker can avoid widows
+// and orphans. No penalty is inserted if the sum is zero.
 func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 	if n == nil {
 		return nil, nil
 	}
 	var prevItemBox bool
 	lb := newLinebreaker(settings)
+	lb.applyParFillSkip(n)
 	lb.activeNodesA = &Breakpoint{id: int(breakpointNextID.Add(1)), Fitness: 1, Position: n}
 	var endNode Node
 
@@ -549,9 +734,9 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 		case *Glyph:
 			prevItemBox = true
 			lb.sumW += t.Width
-			if lb.settings.FontExpansion != 0 {
-				extend := bag.MultiplyFloat(t.Width, settings.FontExpansion)
-				lb.sumExpand += extend
+			if lb.expansion != nil {
+				lb.sumExpandStretch += lb.expansion.stretch(t)
+				lb.sumExpandShrink += lb.expansion.shrink(t)
 			}
 		default:
 			prevItemBox = true
@@ -565,7 +750,7 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 
 	// There might be several nodes in here which end at the last glue with
 	// different numbers of lines. Let's pick the one with the fewest total
-	// demerits, as we do not specify a looseness parameter yet.
+	// demerits.
 	demerits := math.MaxInt
 	lastNode := lb.activeNodesA
 	if lastNode == nil {
@@ -579,9 +764,30 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 		}
 	}
 
+	// With a looseness other than zero we look for the active node whose
+	// line count is as close as possible to the optimum plus the looseness
+	// (TeX §875). The main loop keeps an active node for every line count
+	// that can end the paragraph.
+	actualLooseness := 0
+	if settings.Looseness != 0 {
+		bestLine := lastNode.Line
+		for e := lb.activeNodesA; e != nil; e = e.next {
+			lineDiff := e.Line - bestLine
+			if (lineDiff < actualLooseness && settings.Looseness <= lineDiff) || (lineDiff > actualLooseness && settings.Looseness >= lineDiff) {
+				lastNode = e
+				actualLooseness = lineDiff
+			} else if lineDiff == actualLooseness && e.Demerits < lastNode.Demerits {
+				lastNode = e
+			}
+		}
+	}
+
 	var curPre Node
 	// Now lastNode has the fewest total demerits.
 	var vert Node
+	// endBp is the breakpoint at the end of the line built in the current
+	// iteration, nil for the last line of the paragraph.
+	var endBp *Breakpoint
 	bps = append(bps, lastNode)
 	for e := lastNode; e != nil; e = e.from {
 		if settings.HangingPunctuationEnd {
@@ -619,8 +825,9 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 			}
 		}
 		if startPos != nil {
+			startGlue, endGlue := lb.lineGlues(endNode)
 			// if PDF/UA is written, the line end should have a space at the end.
-			lineEnd := settings.LineEndGlue.Copy().(*Glue)
+			lineEnd := endGlue.Copy().(*Glue)
 			// Forced-break suppression of justification: a line that
 			// ends in a HardBreak should not be justified, even when
 			// the surrounding paragraph is. In Justify mode
@@ -643,8 +850,8 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 			// fix. e.Position itself marks the START of this line and
 			// is therefore the wrong node to test.
 			if _, endsAtHB := endNode.(*HardBreak); endsAtHB {
-				if settings.LineEndGlue.StretchOrder < StretchFil &&
-					settings.LineStartGlue.StretchOrder < StretchFil {
+				if endGlue.StretchOrder < StretchFil &&
+					startGlue.StretchOrder < StretchFil {
 					lineEnd = NewGlue()
 					lineEnd.Stretch = bag.Factor
 					lineEnd.StretchOrder = StretchFill
@@ -655,35 +862,52 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 			InsertAfter(startPos, endNode.Prev(), lineEnd)
 
 			// indentation
-			leftskip := settings.LineStartGlue.Copy().(*Glue)
+			leftskip := startGlue.Copy().(*Glue)
 			leftskip.Attributes = H{"origin": "leftskip"}
-			leftskip.Width += lb.getIndent(e.Line)
+			indent := lb.getIndent(e.Line)
+			leftskip.Width += indent
 			startPos = InsertBefore(startPos, startPos, leftskip)
-			hl := HpackToWithEnd(startPos, endNode.Prev(), lb.settings.HSize, FontExpansion(lb.settings.FontExpansion), SqueezeOverfullBoxes(settings.SqueezeOverfullBoxes))
+			hl := HpackToWithEnd(startPos, endNode.Prev(), indent+lb.lineWidth(e.Line), Expansion(lb.expansion), SqueezeOverfullBoxes(settings.SqueezeOverfullBoxes), MarginProtrusion(settings.Protrusion))
 			if hl.Attributes == nil {
 				hl.Attributes = H{"origin": "line"}
 			} else {
 				hl.Attributes["origin"] = "line"
 			}
+			if endBp != nil {
+				if pen := lb.interlinePenalty(e.Line+1, lastNode.Line, isHyphenBreak(endBp.Position)); pen != 0 {
+					p := NewPenalty()
+					p.Penalty = pen
+					p.Attributes = H{"origin": "interlinepenalty"}
+					vert = InsertBefore(vert, vert, p)
+				}
+			}
 			vert = InsertBefore(vert, vert, hl)
 			// insert vertical glue if necessary
 			if e.next != nil {
-				lineskip := NewGlue()
-				lineskip.Attributes = H{"origin": "lineskip"}
-				if totalHeightHL := hl.Height + hl.Depth; totalHeightHL < settings.LineHeight {
-					lineskip.Width = settings.LineHeight - totalHeightHL
+				if settings.InterlineSpacing == InterlineLineHeight && settings.Grid == nil {
+					lineskip := NewGlue()
+					lineskip.Attributes = H{"origin": "lineskip"}
+					if totalHeightHL := hl.Height + hl.Depth; totalHeightHL < settings.LineHeight {
+						lineskip.Width = settings.LineHeight - totalHeightHL
+					}
+					vert = InsertBefore(vert, vert, lineskip)
 				}
-				vert = InsertBefore(vert, vert, lineskip)
 				endNode = e.Position
 				bps = append(bps, e)
 			}
+			endBp = e
 		}
 	}
 	// reverse the order
 	for i, j := 0, len(bps)-1; i < j; i, j = i+1, j-1 {
 		bps[i], bps[j] = bps[j], bps[i]
 	}
-	if !settings.OmitLastLeading {
+	for _, bp := range bps {
+		bp.Looseness = actualLooseness
+	}
+	if settings.InterlineSpacing != InterlineLineHeight || settings.Grid != nil {
+		vert = lb.addBaselineSkips(vert)
+	} else if !settings.OmitLastLeading {
 		lineskip := NewGlue()
 		lineskip.Attributes = H{"origin": "last lineskip"}
 		hl := Tail(vert).(*HList)
@@ -698,6 +922,28 @@ func Linebreak(n Node, settings *LinebreakSettings) (*VList, []*Breakpoint) {
 	return vl, bps
 }
 
+// addBaselineSkips inserts the interline glue between the lines in vert
+// with a VListBuilder and snaps the lines to the baseline grid if there is
+// one.
+func (lb *linebreaker) addBaselineSkips(vert Node) Node {
+	vb := NewVListBuilder(lb.settings.LineHeight)
+	vb.HalfLeading = lb.settings.InterlineSpacing == InterlineHalfLeading
+	vb.LineSkipLimit = lb.settings.LineSkipLimit
+	vb.Grid = lb.settings.Grid
+	vb.GridOffset = lb.settings.GridOffset
+	if lb.settings.LineSkip != nil {
+		vb.LineSkip = lb.settings.LineSkip
+	}
+	for e := vert; e != nil; {
+		next := e.Next()
+		e.SetPrev(nil)
+		e.SetNext(nil)
+		vb.Append(e)
+		e = next
+	}
+	return vb.List()
+}
+
 // AppendLineEndAfter adds a penalty 10000, glue 0pt plus 1fil, penalty -10000
 // after n (the node lists starting with head). It returns the new head (if head
 // is nil) and the penalty node (the tail of the list).
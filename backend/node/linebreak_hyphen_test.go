@@ -0,0 +1,60 @@
+package node
+
+import "testing"
+
+// hyphenWord returns a disc of the given subtype between two glyphs.
+func hyphenWord(subtype DiscSubtype) *Disc {
+	var head Node
+	a, d, b := NewGlyph(), NewDisc(), NewGlyph()
+	d.Subtype = subtype
+	head = InsertAfter(head, head, a)
+	InsertAfter(head, a, d)
+	InsertAfter(head, d, b)
+	return d
+}
+
+func TestLinebreakExHyphenPenalty(t *testing.T) {
+	ls := NewLinebreakSettings()
+	ls.Hyphenpenalty = 100
+	ls.ExHyphenPenalty = 10
+	lb := newLinebreaker(ls)
+	active := &Breakpoint{Fitness: 1}
+	_, regular := lb.calculateDemerits(active, 0, hyphenWord(DiscRegular))
+	_, explicit := lb.calculateDemerits(active, 0, hyphenWord(DiscExplicit))
+	if want := 1 + 100*100; regular != want {
+		t.Errorf("regular disc demerits = %d, want %d", regular, want)
+	}
+	if want := 1 + 10*10; explicit != want {
+		t.Errorf("explicit disc demerits = %d, want %d", explicit, want)
+	}
+}
+
+func TestLinebreakFinalHyphenDemerits(t *testing.T) {
+	ls := NewLinebreakSettings()
+	ls.FinalHyphenDemerits = 5000
+	lb := newLinebreaker(ls)
+	end := NewPenalty()
+	end.Penalty = -10000
+	active := &Breakpoint{Fitness: 1, Position: hyphenWord(DiscRegular)}
+	_, d := lb.calculateDemerits(active, 0, end)
+	if want := 1 + 5000; d != want {
+		t.Errorf("demerits after a hyphenated second last line = %d, want %d", d, want)
+	}
+	active.Position = NewGlue()
+	if _, d = lb.calculateDemerits(active, 0, end); d != 1 {
+		t.Errorf("demerits after an unhyphenated line = %d, want 1", d)
+	}
+}
+
+func TestHyphensAfter(t *testing.T) {
+	bp := &Breakpoint{}
+	for i := 1; i <= 3; i++ {
+		bp = &Breakpoint{hyphens: hyphensAfter(bp, hyphenWord(DiscRegular))}
+		if bp.hyphens != i {
+			t.Fatalf("got %d consecutive hyphens, want %d", bp.hyphens, i)
+		}
+	}
+	if got := hyphensAfter(bp, NewGlue()); got != 0 {
+		t.Errorf("break at glue counts %d hyphens, want 0", got)
+	}
+}
@@ -0,0 +1,78 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// lastLine returns the last HList of vl.
+func lastLine(vl *VList) *HList {
+	var hl *HList
+	for n := vl.List; n != nil; n = n.Next() {
+		if l, ok := n.(*HList); ok {
+			hl = l
+		}
+	}
+	return hl
+}
+
+// TestLinebreakMinLastLineFill breaks nine words on lines of 100pt. The
+// optimum is 4+4+1 words, leaving a last line of 20%. Asking for at least
+// 40% must give a longer last line.
+func TestLinebreakMinLastLineFill(t *testing.T) {
+	for _, tc := range []struct {
+		fill   float64
+		glyphs int
+	}{
+		{0, 4},
+		{0.4, 8},
+	} {
+		settings := NewLinebreakSettings()
+		settings.HSize = 100 * bag.Factor
+		settings.MinLastLineFill = tc.fill
+		vl, _ := Linebreak(wordParagraph(9), settings)
+		glyphs := 0
+		for e := lastLine(vl).List; e != nil; e = e.Next() {
+			if _, ok := e.(*Glyph); ok {
+				glyphs++
+			}
+		}
+		if glyphs != tc.glyphs {
+			t.Errorf("fill %.1f: last line has %d glyphs, want %d", tc.fill, glyphs, tc.glyphs)
+		}
+	}
+}
+
+// TestLinebreakCenteredLastLine justifies a paragraph and centers its last
+// line with fil glue at both ends of the last line.
+func TestLinebreakCenteredLastLine(t *testing.T) {
+	fil := func() *Glue {
+		g := NewGlue()
+		g.Stretch = bag.Factor
+		g.StretchOrder = StretchFil
+		return g
+	}
+	settings := NewLinebreakSettings()
+	settings.HSize = 100 * bag.Factor
+	settings.ParFillSkip = NewGlue()
+	settings.LastLineStartGlue = fil()
+	settings.LastLineEndGlue = fil()
+	vl, _ := Linebreak(wordParagraph(9), settings)
+
+	hl := lastLine(vl)
+	var leftskip, lineend bag.ScaledPoint
+	for e := hl.List; e != nil; e = e.Next() {
+		if g, ok := e.(*Glue); ok {
+			switch g.Attributes["origin"] {
+			case "leftskip":
+				leftskip = g.Width
+			case "lineend":
+				lineend += g.Width
+			}
+		}
+	}
+	if leftskip == 0 || leftskip != lineend {
+		t.Errorf("last line: leftskip %s, line end %s, want equal and not zero", leftskip, lineend)
+	}
+}
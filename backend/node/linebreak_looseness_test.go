@@ -0,0 +1,99 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// wordParagraph builds words of "abcd" (5pt per glyph) separated by
+// stretchable interword glue.
+func wordParagraph(words int) Node {
+	var head, cur Node
+	for i := range words {
+		if i > 0 {
+			g := NewGlue()
+			g.Width = 5 * bag.Factor
+			g.Stretch = 10 * bag.Factor
+			g.Shrink = 2 * bag.Factor
+			head = InsertAfter(head, cur, g)
+			cur = g
+		}
+		head, cur = glyphRun(head, cur, "abcd", 5*bag.Factor)
+	}
+	AppendLineEndAfter(head, cur)
+	return head
+}
+
+// TestLinebreakLooseness breaks 20 words on lines of 100pt. Four words
+// (95pt) make the optimal line, so the optimum has five lines. Looseness 1
+// must yield six lines, looseness -1 is impossible since five words don't
+// fit on a line.
+func TestLinebreakLooseness(t *testing.T) {
+	for _, tc := range []struct {
+		looseness int
+		lines     int
+		achieved  int
+	}{
+		{0, 5, 0},
+		{1, 6, 1},
+		{-1, 5, 0},
+	} {
+		settings := NewLinebreakSettings()
+		settings.HSize = 100 * bag.Factor
+		settings.Looseness = tc.looseness
+		vl, bps := Linebreak(wordParagraph(20), settings)
+		if got := countHLists(vl); got != tc.lines {
+			t.Errorf("looseness %d: got %d lines, want %d", tc.looseness, got, tc.lines)
+		}
+		for _, bp := range bps {
+			if bp.Looseness != tc.achieved {
+				t.Errorf("looseness %d: breakpoint reports %d, want %d", tc.looseness, bp.Looseness, tc.achieved)
+				break
+			}
+		}
+	}
+}
+
+// TestLinebreakLoosenessDominated breaks 20 words on lines of 110pt. Four
+// words per line (95pt, decent) make the optimum of five lines, five words
+// per line (120pt shrunk to 110pt, tight) make four lines with many more
+// demerits. Both end with a decent last line, so the final breakpoints share
+// a fitness class and the shorter paragraph would be dominated if the
+// active nodes were not kept per line number.
+func TestLinebreakLoosenessDominated(t *testing.T) {
+	para := func() Node {
+		var head, cur Node
+		for i := range 20 {
+			if i > 0 {
+				g := NewGlue()
+				g.Width = 5 * bag.Factor
+				g.Stretch = 10 * bag.Factor
+				g.Shrink = 3 * bag.Factor
+				head = InsertAfter(head, cur, g)
+				cur = g
+			}
+			head, cur = glyphRun(head, cur, "abcd", 5*bag.Factor)
+		}
+		AppendLineEndAfter(head, cur)
+		return head
+	}
+	for _, tc := range []struct {
+		looseness int
+		lines     int
+	}{
+		{0, 5},
+		{-1, 4},
+	} {
+		settings := NewLinebreakSettings()
+		settings.HSize = 110 * bag.Factor
+		settings.Looseness = tc.looseness
+		vl, bps := Linebreak(para(), settings)
+		if got := countHLists(vl); got != tc.lines {
+			t.Errorf("looseness %d: got %d lines, want %d", tc.looseness, got, tc.lines)
+		}
+		if bps[0].Looseness != tc.looseness {
+			t.Errorf("looseness %d: breakpoint reports %d", tc.looseness, bps[0].Looseness)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// TestLinebreakParshape sets a paragraph with a narrow first line and an
+// indented second line. Words are 20pt wide with 5pt interword glue, so the
+// first line (60pt) holds two words and the following lines (80pt at an
+// indent of 20pt) hold three words.
+func TestLinebreakParshape(t *testing.T) {
+	settings := NewLinebreakSettings()
+	settings.HSize = 500 * bag.Factor // must be ignored
+	settings.Parshape = []ParshapeLine{
+		{Indent: 0, Width: 60 * bag.Factor},
+		{Indent: 20 * bag.Factor, Width: 80 * bag.Factor},
+	}
+	vl, _ := Linebreak(wordParagraph(8), settings)
+
+	type line struct {
+		width, indent bag.ScaledPoint
+		glyphs        int
+	}
+	var lines []line
+	for n := vl.List; n != nil; n = n.Next() {
+		hl, ok := n.(*HList)
+		if !ok {
+			continue
+		}
+		l := line{width: hl.Width}
+		for e := hl.List; e != nil; e = e.Next() {
+			switch t := e.(type) {
+			case *Glyph:
+				l.glyphs++
+			case *Glue:
+				if t.Attributes["origin"] == "leftskip" {
+					l.indent = t.Width
+				}
+			}
+		}
+		lines = append(lines, l)
+	}
+	want := []line{
+		{60 * bag.Factor, 0, 8},
+		{100 * bag.Factor, 20 * bag.Factor, 12},
+		{100 * bag.Factor, 20 * bag.Factor, 12},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i, l := range lines {
+		if l != want[i] {
+			t.Errorf("line %d: got width %s, indent %s, %d glyphs; want width %s, indent %s, %d glyphs",
+				i+1, l.width, l.indent, l.glyphs, want[i].width, want[i].indent, want[i].glyphs)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// fourLineParagraph builds "AB|CD|EF|GH" with HardBreaks between the pairs,
+// so Linebreak creates exactly four lines.
+func fourLineParagraph() Node {
+	const charWidth = bag.ScaledPoint(10 * bag.Factor)
+	var head, cur Node
+	for i, s := range []string{"AB", "CD", "EF", "GH"} {
+		if i > 0 {
+			hb := NewHardBreak()
+			head = InsertAfter(head, cur, hb)
+			cur = hb
+		}
+		head, cur = glyphRun(head, cur, s, charWidth)
+	}
+	AppendLineEndAfter(head, cur)
+	return head
+}
+
+// interlinePenalties returns the penalties found between the lines of vl.
+func interlinePenalties(vl *VList) []int {
+	var ret []int
+	for n := vl.List; n != nil; n = n.Next() {
+		if p, ok := n.(*Penalty); ok {
+			ret = append(ret, p.Penalty)
+		}
+	}
+	return ret
+}
+
+// TestLinebreakInterlinePenalties checks that club, widow and interline
+// penalties are inserted between the lines.
+func TestLinebreakInterlinePenalties(t *testing.T) {
+	settings := NewLinebreakSettings()
+	settings.HSize = 200 * bag.Factor
+	settings.LineHeight = 12 * bag.Factor
+	settings.InterLinePenalty = 1
+	settings.ClubPenalty = 150
+	settings.WidowPenalty = 200
+
+	vl, _ := Linebreak(fourLineParagraph(), settings)
+	got := interlinePenalties(vl)
+	want := []int{151, 1, 201}
+	if len(got) != len(want) {
+		t.Fatalf("got penalties %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("penalty after line %d is %d, want %d", i+1, got[i], want[i])
+		}
+	}
+	// The penalty must come directly after the line, before the lineskip
+	// glue, so it becomes the page break candidate.
+	if _, ok := vl.List.Next().(*Penalty); !ok {
+		t.Errorf("node after the first line is %T, want *Penalty", vl.List.Next())
+	}
+
+	// Zero penalties are not inserted.
+	vl, _ = Linebreak(fourLineParagraph(), NewLinebreakSettings())
+	if got := interlinePenalties(vl); len(got) != 0 {
+		t.Errorf("got penalties %v for default settings, want none", got)
+	}
+}
+
+// TestPagebreakAvoidsWidow breaks a four line paragraph on pages that hold
+// three lines (the lines have no height, so only the 12pt lineskip glue
+// counts). Without a widow penalty the first page is filled and the last
+// line ends up alone on the second page. A widow penalty of 10000 forbids
+// that break.
+func TestPagebreakAvoidsWidow(t *testing.T) {
+	settings := NewLinebreakSettings()
+	settings.HSize = 200 * bag.Factor
+	settings.LineHeight = 12 * bag.Factor
+	settings.OmitLastLeading = true
+	pbs := NewPagebreakSettings()
+	pbs.PageHeight = 30 * bag.Factor
+
+	for _, tc := range []struct {
+		widowPenalty int
+		lastPage     int
+	}{
+		{0, 1},
+		{10000, 2},
+	} {
+		settings.WidowPenalty = tc.widowPenalty
+		vl, _ := Linebreak(fourLineParagraph(), settings)
+		pages, _ := Pagebreak(vl, pbs)
+		if got, want := len(pages), 2; got != want {
+			t.Fatalf("widowpenalty %d: got %d pages, want %d", tc.widowPenalty, got, want)
+		}
+		if got := countHLists(pages[1]); got != tc.lastPage {
+			t.Errorf("widowpenalty %d: second page has %d lines, want %d", tc.widowPenalty, got, tc.lastPage)
+		}
+	}
+}
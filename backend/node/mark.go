@@ -0,0 +1,73 @@
+package node
+
+import "fmt"
+
+// A Mark carries a value from the text flow to the page, for example the
+// current chapter title for a running header or the dictionary entry for
+// the head line. Marks are grouped by Class, so different kinds of marks
+// do not interfere. Marks have no size and are ignored by the line and
+// page breaking.
+type Mark struct {
+	basenode
+	Class string
+	Value any
+}
+
+func (m *Mark) String() string {
+	return fmt.Sprintf("mark: %s=%v", m.Class, m.Value)
+}
+
+// DebugAttributes returns the class and the value of the mark.
+func (m *Mark) DebugAttributes() ([]kv, H) {
+	return []kv{
+		{key: "id", value: m.ID},
+		{key: "class", value: m.Class},
+		{key: "value", value: fmt.Sprint(m.Value)},
+	}, m.Attributes
+}
+
+// Copy creates a deep copy of the node.
+func (m *Mark) Copy() Node {
+	return NewMark(m.Class, m.Value)
+}
+
+// NewMark creates an initialized Mark node with the given class and value.
+func NewMark(class string, value any) *Mark {
+	n := markSlab.alloc()
+	n.ID = newID()
+	n.typ = TypeMark
+	n.Class = class
+	n.Value = value
+	return n
+}
+
+// FindMarks returns all marks of the given class in the list starting at n,
+// including the marks in nested lists (see Walk), in the order of the list.
+func FindMarks(n Node, class string) []*Mark {
+	var marks []*Mark
+	Walk(n, func(e Node) bool {
+		if m, ok := e.(*Mark); ok && m.Class == class {
+			marks = append(marks, m)
+		}
+		return true
+	})
+	return marks
+}
+
+// FirstMark returns the first mark of the given class in the list, or nil if
+// there is none (TeX's \firstmark without the fallback to \topmark).
+func (v *VList) FirstMark(class string) *Mark {
+	if marks := FindMarks(v.List, class); len(marks) > 0 {
+		return marks[0]
+	}
+	return nil
+}
+
+// LastMark returns the last mark of the given class in the list, or nil if
+// there is none (TeX's \botmark without the fallback to \topmark).
+func (v *VList) LastMark(class string) *Mark {
+	if marks := FindMarks(v.List, class); len(marks) > 0 {
+		return marks[len(marks)-1]
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package node
+
+import "testing"
+
+func TestFindMarks(t *testing.T) {
+	var head Node
+	head = InsertAfter(head, Tail(head), NewMark("chapter", "a"))
+	inner := Hpack(NewMark("section", "x"))
+	InsertAfter(inner.List, Tail(inner.List), NewMark("chapter", "b"))
+	head = InsertAfter(head, Tail(head), inner)
+	head = InsertAfter(head, Tail(head), NewMark("chapter", "c"))
+	vl := Vpack(head)
+
+	marks := FindMarks(vl.List, "chapter")
+	if len(marks) != 3 {
+		t.Fatalf("got %d marks, want 3", len(marks))
+	}
+	for i, want := range []string{"a", "b", "c"} {
+		if marks[i].Value != want {
+			t.Errorf("mark %d = %v, want %s", i, marks[i].Value, want)
+		}
+	}
+	if m := vl.FirstMark("chapter"); m == nil || m.Value != "a" {
+		t.Errorf("FirstMark = %v, want a", m)
+	}
+	if m := vl.LastMark("chapter"); m == nil || m.Value != "c" {
+		t.Errorf("LastMark = %v, want c", m)
+	}
+	if m := vl.LastMark("section"); m == nil || m.Value != "x" {
+		t.Errorf("LastMark(section) = %v, want x", m)
+	}
+	if m := vl.FirstMark("index"); m != nil {
+		t.Errorf("FirstMark(index) = %v, want nil", m)
+	}
+	if cp := marks[0].Copy().(*Mark); cp.Class != "chapter" || cp.Value != "a" {
+		t.Errorf("Copy = %v", cp)
+	}
+}
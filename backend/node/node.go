@@ -40,6 +40,14 @@ const (
 	TypeVList
 	// TypeHardBreak is a forced line break (HTML <br>, source "\n").
 	TypeHardBreak
+	// TypeMark is a Mark node.
+	TypeMark
+	// TypeInsert is an Insert node.
+	TypeInsert
+	// TypeTransform is a Transform node.
+	TypeTransform
+	// TypeClip is a Clip node.
+	TypeClip
 )
 
 // typeMetadata is the single source of truth for a node Type's
@@ -63,6 +71,10 @@ var typeMetadata = [...]struct {
 	TypeStartStop: {"StartStop", "startstop"},
 	TypeVList:     {"Vlist", "vlist"},
 	TypeHardBreak: {"HardBreak", "hardbreak"},
+	TypeMark:      {"Mark", "mark"},
+	TypeInsert:    {"Insert", "insert"},
+	TypeTransform: {"Transform", "transform"},
+	TypeClip:      {"Clip", "clip"},
 }
 
 // String returns the mixed-case name used in log output.
@@ -102,7 +114,7 @@ type Node interface {
 	Copy() Node
 	// Sizes returns the natural width, height and depth of the node in the
 	// given progression direction. Nodes that do not contribute to box
-	// geometry (Disc, Lang, StartStop, HardBreak) return zeros.
+	// geometry (Disc, Lang, StartStop, HardBreak, Mark, Insert) return zeros.
 	Sizes(dir Direction) (w, h, d bag.ScaledPoint)
 	// GetAttribute reads a per-node attribute.
 	GetAttribute(attr string) (any, bool)
@@ -94,6 +94,104 @@ func TestHpack(t *testing.T) {
 	}
 }
 
+// kashidaGlue returns a glue with the subtype GlueKashida and a 4pt leader.
+func kashidaGlue(stretch bag.ScaledPoint) *Glue {
+	r := NewRule()
+	r.Width, r.Height = 4*bag.Factor, 2*bag.Factor
+	g := NewGlue()
+	g.Subtype = GlueKashida
+	g.Stretch = stretch
+	g.Leader = Hpack(r)
+	return g
+}
+
+// TestHpackToKashida widens a line with an interword space and a kashida.
+// Both take their part of the difference in proportion to their
+// stretchability.
+func TestHpackToKashida(t *testing.T) {
+	pt := bag.Factor
+	var head, cur Node
+	head, cur = glyphRun(head, cur, "ab", 10*pt)
+	p := NewPenalty()
+	p.Penalty = 10000
+	head = InsertAfter(head, cur, p)
+	kashida := kashidaGlue(6 * pt)
+	head = InsertAfter(head, p, kashida)
+	head, cur = glyphRun(head, kashida, "c", 10*pt)
+	space := NewGlue()
+	space.Width = 5 * pt
+	space.Stretch = 3 * pt
+	head = InsertAfter(head, cur, space)
+	head, _ = glyphRun(head, space, "d", 10*pt)
+
+	// 45pt of material and 9pt of stretch
+	hl := HpackTo(head, 51*pt)
+	if kashida.Width != 4*pt || space.Width != 7*pt {
+		t.Errorf("kashida %s, space %s, want 4pt and 7pt", kashida.Width, space.Width)
+	}
+	if hl.GlueSet != 2.0/3.0 {
+		t.Errorf("glue set %g, want 2/3", hl.GlueSet)
+	}
+}
+
+func TestGlueCopy(t *testing.T) {
+	for _, g := range []*Glue{kashidaGlue(bag.Factor), {Subtype: GlueLineEnd, LeaderType: LeaderCentered}} {
+		g.Width = 3 * bag.Factor
+		c := g.Copy().(*Glue)
+		if c.Width != g.Width || c.Subtype != g.Subtype || c.LeaderType != g.LeaderType {
+			t.Errorf("Copy() = %v, want %v", c, g)
+		}
+		if g.Leader == nil {
+			if c.Leader != nil {
+				t.Errorf("Copy() has leader %v, want none", c.Leader)
+			}
+			continue
+		}
+		if c.Leader == g.Leader || c.Leader.Width != g.Leader.Width || c.Leader.List == nil || c.Leader.List == g.Leader.List {
+			t.Errorf("Copy() does not copy the leader %v", g.Leader)
+		}
+	}
+}
+
+func TestVpackTo(t *testing.T) {
+	data := []testdata{
+		{100 * bag.Factor, 0, []gluTestData{{4, 6, 0, 0, 0}, {4, 65536, 0, 1, 0}}},
+		{8 * bag.Factor, 30, []gluTestData{{4, 6, 0, 0, 0}}},
+		{33 * bag.Factor, 10000, []gluTestData{{4, 6, 0, 0, 0}}},
+		{18 * bag.Factor, 338, []gluTestData{{12, 4, 0, 0, 0}}},
+		{20 * bag.Factor, 100, []gluTestData{{23, 6, 3, 0, 0}}},
+		{10 * bag.Factor, 1000000, []gluTestData{{20, 6, 3, 0, 0}}},
+	}
+	for i, d := range data {
+		var head, cur Node
+		for _, glue := range d.glues {
+			g := NewGlue()
+			g.Width = glue.wd * bag.Factor
+			g.Stretch = glue.stretch * bag.Factor
+			g.Shrink = glue.shrink * bag.Factor
+			g.ShrinkOrder = glue.shrinkOrder
+			g.StretchOrder = glue.stretchOrder
+			head = InsertAfter(head, cur, g)
+			cur = g
+		}
+		vl := VpackTo(head, d.desiredWidth)
+		if vl.Height != d.desiredWidth {
+			t.Errorf("vl.Height %spt want %s test case %d (%s)", vl.Height, d.desiredWidth, i, d)
+		}
+		if vl.Badness != d.badness {
+			t.Errorf("badness = %d, want %d test case %d (%s)", vl.Badness, d.badness, i, d)
+		}
+		// The glue widths are not changed, the renderer applies the ratio.
+		var sum bag.ScaledPoint
+		for e := vl.List; e != nil; e = e.Next() {
+			sum += vl.GlueWidth(e.(*Glue))
+		}
+		if d.badness < 10000 && (sum-d.desiredWidth > 2 || d.desiredWidth-sum > 2) {
+			t.Errorf("glue sums up to %s, want %s test case %d (%s)", sum, d.desiredWidth, i, d)
+		}
+	}
+}
+
 func TestLinebreak(t *testing.T) {
 	str := `In olden times when wish|ing still helped one, there lived a king whose daugh|ters
 were all beau|ti|ful; and the young|est was so beau|ti|ful that the sun it|self, which
@@ -17,20 +17,56 @@ const (
 	Vertical Direction = false
 )
 
-// LinebreakSettings controls the line breaking algorithm.
+// ParshapeLine is the left indent and the width of one line of a paragraph
+// shape (TeX's \parshape).
+type ParshapeLine struct {
+	Indent bag.ScaledPoint
+	Width  bag.ScaledPoint
+}
+
+// LinebreakSettings controls the line breaking algorithm. DemeritsFitness
+// is added when two adjacent lines have fitness classes that differ by more
+// than one (TeX's \adjdemerits). FinalHyphenDemerits are added when the
+// second last line ends with a hyphen; they are 0 by default, TeX uses 5000.
+// InterlineSpacing selects how the glue between the lines is computed,
+// LineSkip and LineSkipLimit are only used with InterlineBaselineSkip and
+// InterlineHalfLeading (see VListBuilder).
+// If Grid is set, the baselines of the lines snap to the grid, GridOffset is
+// the position of the paragraph relative to the grid.
 type LinebreakSettings struct {
 	LineEndGlue           *Glue
 	LineStartGlue         *Glue
+	LastLineEndGlue       *Glue
+	LastLineStartGlue     *Glue
+	ParFillSkip           *Glue
+	BrokenPenalty         int
+	ClubPenalty           int
 	DemeritsFitness       int
 	DoublehyphenDemerits  int
 	EmergencyStretch      bag.ScaledPoint
+	Expansion             *FontExpansionSettings
+	ExHyphenPenalty       int
+	FinalHyphenDemerits   int
 	FontExpansion         float64
+	Grid                  *BaselineGrid
+	GridOffset            bag.ScaledPoint
 	HSize                 bag.ScaledPoint
 	Hyphenpenalty         int
 	Indent                bag.ScaledPoint
 	IndentRows            int
+	InterLinePenalty      int
+	InterlineSpacing      InterlineSpacing
+	Looseness             int
 	LineHeight            bag.ScaledPoint
+	LineSkip              *Glue
+	LineSkipLimit         bag.ScaledPoint
+	MaxConsecutiveHyphens int
+	MinLastLineFill       float64
+	Parshape              []ParshapeLine
+	Protrusion            *ProtrusionSet
+	ShortLastLineDemerits int
 	Tolerance             float64
+	WidowPenalty          int
 	SqueezeOverfullBoxes  bool
 	HangingPunctuationEnd bool
 	OmitLastLeading       bool
@@ -39,12 +75,14 @@ type LinebreakSettings struct {
 // NewLinebreakSettings returns a settings struct with defaults initialized.
 func NewLinebreakSettings() *LinebreakSettings {
 	ls := &LinebreakSettings{
-		DoublehyphenDemerits: 3000,
-		DemeritsFitness:      100,
-		Hyphenpenalty:        50,
-		Tolerance:            4.0,
-		LineStartGlue:        NewGlue(),
-		LineEndGlue:          NewGlue(),
+		DoublehyphenDemerits:  3000,
+		DemeritsFitness:       100,
+		ExHyphenPenalty:       50,
+		Hyphenpenalty:         50,
+		ShortLastLineDemerits: 1000000,
+		Tolerance:             4.0,
+		LineStartGlue:         NewGlue(),
+		LineEndGlue:           NewGlue(),
 	}
 
 	return ls
@@ -112,10 +150,11 @@ func InsertBefore(head, cur, insert Node) Node {
 }
 
 // Walk visits every node reachable from start, descending into container
-// sub-lists: HList.List, VList.List, Disc.Pre/Post/Replace, and the list
-// inside Glue.Leader. The visitor receives each node in source order and
-// returns true to continue or false to abort the traversal. Walk itself
-// returns false if the visitor aborted, true otherwise.
+// sub-lists: HList.List, VList.List, Transform.List, Clip.List,
+// Disc.Pre/Post/Replace and the list inside Glue.Leader. The visitor
+// receives each node in source order and returns true to continue or false
+// to abort the traversal. Walk itself returns false if the visitor aborted,
+// true otherwise.
 func Walk(start Node, fn func(Node) bool) bool {
 	for e := start; e != nil; e = e.Next() {
 		if !fn(e) {
@@ -130,6 +169,14 @@ func Walk(start Node, fn func(Node) bool) bool {
 			if !Walk(v.List, fn) {
 				return false
 			}
+		case *Transform:
+			if !Walk(v.List, fn) {
+				return false
+			}
+		case *Clip:
+			if !Walk(v.List, fn) {
+				return false
+			}
 		case *Disc:
 			if !Walk(v.Pre, fn) {
 				return false
@@ -206,17 +253,31 @@ func Dimensions(start Node, stop Node, dir Direction) (bag.ScaledPoint, bag.Scal
 }
 
 type hpackSetting struct {
-	fontexpansion        float64
+	expansion            *FontExpansionSettings
 	squeezeOverfullBoxes bool
+	protrusion           *ProtrusionSet
 }
 
 // HpackOption controls the packaging of the box.
 type HpackOption func(*hpackSetting)
 
-// FontExpansion sets the allowed font expansion (0-1).
+// FontExpansion sets the allowed font expansion (0-1) for all glyphs. Use
+// Expansion for per-glyph expansion factors and steps.
 func FontExpansion(amount float64) HpackOption {
 	return func(p *hpackSetting) {
-		p.fontexpansion = amount
+		p.expansion = nil
+		if amount != 0 {
+			p.expansion = uniformExpansion(amount)
+		}
+	}
+}
+
+// Expansion lets the glyphs of the box expand or shrink according to the
+// settings before the glue is stretched or shrunk. nil disables font
+// expansion.
+func Expansion(fes *FontExpansionSettings) HpackOption {
+	return func(p *hpackSetting) {
+		p.expansion = fes
 	}
 }
 
@@ -227,6 +288,14 @@ func SqueezeOverfullBoxes(avoid bool) HpackOption {
 	}
 }
 
+// MarginProtrusion lets the first and the last glyph of the box hang into
+// the margins according to the protrusion set. nil disables protrusion.
+func MarginProtrusion(ps *ProtrusionSet) HpackOption {
+	return func(p *hpackSetting) {
+		p.protrusion = ps
+	}
+}
+
 // Hpack returns a HList node with the node list as its list
 func Hpack(firstNode Node) *HList {
 	sumwd := bag.ScaledPoint(0)
@@ -264,16 +333,19 @@ func HpackToWithEnd(firstNode Node, lastNode Node, width bag.ScaledPoint, opts .
 	for _, opt := range opts {
 		opt(hs)
 	}
+	if hs.protrusion != nil {
+		firstNode, lastNode = insertProtrusionKerns(hs.protrusion, firstNode, lastNode)
+	}
 	glues := []*Glue{}
+	var glyphs []*Glyph
 
 	sumwd := bag.ScaledPoint(0)
-	sumGlyph := bag.ScaledPoint(0)
 	maxht := bag.ScaledPoint(0)
 	maxdp := bag.ScaledPoint(0)
 
 	totalStretchability := [4]bag.ScaledPoint{0, 0, 0, 0}
 	totalShrinkability := [4]bag.ScaledPoint{0, 0, 0, 0}
-	totalExtend := bag.ScaledPoint(0)
+	var expandStretch, expandShrink bag.ScaledPoint
 
 	for e := firstNode; e != nil; e = e.Next() {
 		switch v := e.(type) {
@@ -283,18 +355,20 @@ func HpackToWithEnd(firstNode Node, lastNode Node, width bag.ScaledPoint, opts .
 			totalShrinkability[v.StretchOrder] += v.Shrink
 			glues = append(glues, v)
 		case *Glyph:
-			sumwd += v.Width
-			if v.Height > maxht {
-				maxht = v.Height
+			if hs.expansion != nil {
+				v.Expansion = 0
+				expandStretch += hs.expansion.stretch(v)
+				expandShrink += hs.expansion.shrink(v)
+				glyphs = append(glyphs, v)
 			}
-			if v.Depth > maxdp {
-				maxdp = v.Depth
+			wd, ht, dp := v.Sizes(Horizontal)
+			sumwd += wd
+			if ht > maxht {
+				maxht = ht
 			}
-			if hs.fontexpansion != 0 {
-				extend := bag.MultiplyFloat(v.Width, hs.fontexpansion)
-				totalExtend += extend
+			if dp > maxdp {
+				maxdp = dp
 			}
-			sumGlyph += v.Width
 		default:
 			wd, ht, dp := e.Sizes(Horizontal)
 			sumwd += wd
@@ -328,6 +402,21 @@ func HpackToWithEnd(firstNode Node, lastNode Node, width bag.ScaledPoint, opts .
 			shrinkability = totalShrinkability[i]
 		}
 	}
+	// The glyphs take their part of the difference in proportion to the
+	// expansion budget, the glue takes the rest (like pdfTeX).
+	var re float64
+	switch {
+	case sumwd < width && highestOrderStretch == StretchNormal && expandStretch > 0:
+		re = min(1, float64(width-sumwd)/float64(stretchability+expandStretch))
+	case sumwd > width && highestOrderShrink == StretchNormal && expandShrink > 0:
+		re = max(-1, float64(width-sumwd)/float64(shrinkability+expandShrink))
+	}
+	if re != 0 {
+		for _, g := range glyphs {
+			g.Expansion = hs.expansion.glyphExpansion(g, re)
+			sumwd += bag.MultiplyFloat(g.Width, g.Expansion)
+		}
+	}
 	var r float64
 	switch {
 	case width == sumwd:
@@ -346,13 +435,6 @@ func HpackToWithEnd(firstNode Node, lastNode Node, width bag.ScaledPoint, opts .
 	} else if r >= -1 {
 		badness = min(int(math.Round(math.Pow(math.Abs(r), 3)*100.0)), 10000)
 	}
-	useExpand := false
-	if hs.fontexpansion != 0 {
-		if r < -1 {
-			r = -1
-			useExpand = true
-		}
-	}
 	for _, g := range glues {
 		switch {
 		case r >= 0 && highestOrderStretch == g.StretchOrder:
@@ -372,20 +454,6 @@ func HpackToWithEnd(firstNode Node, lastNode Node, width bag.ScaledPoint, opts .
 	hl.Height = maxht
 	hl.GlueSet = r
 	hl.Badness = badness
-	if useExpand {
-		a := (sumwd - width - shrinkability).ToPT() / sumGlyph.ToPT()
-		// Clamp at the configured fontexpansion ceiling (microtype/hz
-		// limit). Beyond that, glyphs shrink visibly and the cell looks
-		// like it uses a smaller font size, which is exactly the
-		// "Quanti-ty rendered narrower than Unit Cost" symptom. The
-		// remaining overflow stays in the HList as box-overfull — much
-		// better than secretly squeezing the glyph widths beyond the
-		// hz limit.
-		if a > hs.fontexpansion {
-			a = hs.fontexpansion
-		}
-		hl.Attributes = H{"expand": int(-1 * a * 100)}
-	}
 	return hl
 }
 
@@ -414,6 +482,97 @@ func Vpack(firstNode Node) *VList {
 	return vl
 }
 
+// VpackTo returns a VList node with the node list as its list. The height
+// is the desired height.
+func VpackTo(firstNode Node, height bag.ScaledPoint) *VList {
+	return VpackToWithEnd(firstNode, Tail(firstNode), height)
+}
+
+// VpackToWithEnd returns a VList node of the desired height with the list
+// from firstNode to lastNode (including lastNode). Unlike HpackToWithEnd the
+// glue is not changed, the glue ratio is stored in GlueSet, GlueSign and
+// GlueOrder and applied when the list is output (see VList.GlueWidth). The
+// depth of the VList is the depth of the last node.
+func VpackToWithEnd(firstNode Node, lastNode Node, height bag.ScaledPoint) *VList {
+	var sumht, maxwd, lastDepth bag.ScaledPoint
+	var stretch, shrink [4]bag.ScaledPoint
+	for e := firstNode; e != nil; e = e.Next() {
+		switch v := e.(type) {
+		case *Glue:
+			sumht += v.Width
+			stretch[v.StretchOrder] += v.Stretch
+			shrink[v.ShrinkOrder] += v.Shrink
+			lastDepth = 0
+		case *Kern:
+			sumht += v.Kern
+			lastDepth = 0
+		default:
+			wd, ht, dp := e.Sizes(Vertical)
+			sumht += ht + dp
+			maxwd = max(maxwd, wd)
+			lastDepth = dp
+		}
+		if e == lastNode {
+			if e.Next() != nil {
+				e.Next().SetPrev(nil)
+				e.SetNext(nil)
+			}
+			break
+		}
+	}
+	vl := NewVList()
+	vl.List = firstNode
+	vl.Width = maxwd
+	vl.Height = height
+	vl.Depth = lastDepth
+	vl.GlueSet, vl.GlueSign, vl.GlueOrder, vl.Badness = glueSetting(height-(sumht-lastDepth), stretch, shrink)
+	return vl
+}
+
+// glueSetting returns the glue ratio, the glue sign (1 = stretching, 2 =
+// shrinking), the glue order and the badness of a box whose natural size
+// is diff smaller than the desired size. Shrinking is limited to the shrink
+// of the glue, an overfull box gets the badness 1000000.
+func glueSetting(diff bag.ScaledPoint, stretch, shrink [4]bag.ScaledPoint) (float64, uint8, GlueOrder, int) {
+	highest := func(amounts [4]bag.ScaledPoint) GlueOrder {
+		for i := GlueOrder(3); i > 0; i-- {
+			if amounts[i] != 0 {
+				return i
+			}
+		}
+		return StretchNormal
+	}
+	badness := func(r float64) int {
+		return min(int(math.Round(math.Pow(math.Abs(r), 3)*100.0)), 10000)
+	}
+	switch {
+	case diff > 0:
+		o := highest(stretch)
+		if stretch[o] <= 0 {
+			return 0, 0, StretchNormal, 10000
+		}
+		r := float64(diff) / float64(stretch[o])
+		if o != StretchNormal {
+			return r, 1, o, 0
+		}
+		return r, 1, o, badness(r)
+	case diff < 0:
+		o := highest(shrink)
+		if shrink[o] <= 0 {
+			return 0, 0, StretchNormal, 1000000
+		}
+		r := float64(diff) / float64(shrink[o])
+		if o != StretchNormal {
+			return r, 2, o, 0
+		}
+		if r < -1 {
+			return -1, 2, o, 1000000
+		}
+		return r, 2, o, badness(r)
+	}
+	return 0, 0, StretchNormal, 0
+}
+
 // Boxit draws a thin rectangle around the box.
 func Boxit(n Node) Node {
 	r := NewRule()
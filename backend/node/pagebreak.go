@@ -0,0 +1,394 @@
+package node
+
+import (
+	"math"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// PagebreakSettings controls the page breaking algorithm.
+type PagebreakSettings struct {
+	// TopSkip is inserted at the top of every page (TeX's \topskip). Its
+	// width is reduced by the height of the first box on the page, so the
+	// first baseline has a fixed distance from the top of the page. nil
+	// inserts nothing.
+	TopSkip *Glue
+	// PageHeight is the height of the text area of each page.
+	PageHeight bag.ScaledPoint
+	// Tolerance is the largest page badness (0–10000) that is still
+	// considered a feasible break. Forced breaks are always feasible unless
+	// the page is overfull.
+	Tolerance int
+	// Inserts controls the placement of the material of Insert nodes (such
+	// as footnotes) at the bottom of the pages. nil ignores inserts.
+	Inserts *InsertSettings
+}
+
+// NewPagebreakSettings returns a settings struct with defaults initialized.
+// The default tolerance accepts underfull pages, like TeX's page builder.
+func NewPagebreakSettings() *PagebreakSettings {
+	return &PagebreakSettings{
+		Tolerance: 10000,
+		Inserts:   NewInsertSettings(),
+	}
+}
+
+// vsums holds the accumulated vertical dimensions of a list prefix.
+type vsums struct {
+	height  bag.ScaledPoint
+	stretch [4]bag.ScaledPoint
+	shrink  bag.ScaledPoint
+}
+
+func (s vsums) sub(o vsums) vsums {
+	r := vsums{height: s.height - o.height, shrink: s.shrink - o.shrink}
+	for i := range s.stretch {
+		r.stretch[i] = s.stretch[i] - o.stretch[i]
+	}
+	return r
+}
+
+// isDiscardable reports whether n vanishes at a page break (glue, kern and
+// penalties).
+func isDiscardable(n Node) bool {
+	switch n.(type) {
+	case *Glue, *Kern, *Penalty:
+		return true
+	}
+	return false
+}
+
+// isVerticalBox reports whether n is box material in a vertical list.
+func isVerticalBox(n Node) bool {
+	switch n.(type) {
+	case *HList, *VList, *Rule, *Image, *Transform, *Clip:
+		return true
+	}
+	return false
+}
+
+// verticalSize returns the amount of vertical space n takes in a vertical
+// list.
+func verticalSize(n Node) bag.ScaledPoint {
+	if k, ok := n.(*Kern); ok {
+		return k.Kern
+	}
+	_, ht, dp := n.Sizes(Vertical)
+	return ht + dp
+}
+
+// verticalBadness computes the adjustment ratio and the badness for packing
+// material with the given sums into height. overfull is true if the material
+// can't be shrunk enough.
+func verticalBadness(s vsums, height bag.ScaledPoint) (r float64, badness int, overfull bool) {
+	diff := height - s.height
+	switch {
+	case diff > 0:
+		if s.stretch[StretchFil] > 0 || s.stretch[StretchFill] > 0 || s.stretch[StretchFilll] > 0 {
+			return 0, 0, false
+		}
+		if s.stretch[StretchNormal] <= 0 {
+			return positiveInf, 10000, false
+		}
+		r = float64(diff) / float64(s.stretch[StretchNormal])
+	case diff < 0:
+		if s.shrink <= 0 {
+			return math.Inf(-1), 10000, true
+		}
+		r = float64(diff) / float64(s.shrink)
+		if r < -1 {
+			return r, 10000, true
+		}
+	default:
+		return 0, 0, false
+	}
+	badness = int(math.Min(math.Round(math.Pow(math.Abs(r), 3)*100), 10000))
+	return r, badness, false
+}
+
+// pageNode is an active node of the page breaker.
+type pageNode struct {
+	from         *pageNode
+	index        int // position of the break in the item slice, -1 for the start
+	start        int // first item of the next page
+	firstBox     int // first box of the next page, or -1
+	page         int
+	r            float64
+	height       bag.ScaledPoint
+	demerits     int
+	topskipWidth bag.ScaledPoint
+	// carry is the insert material that did not fit on the previous page.
+	carry []insertPart
+}
+
+// pagebreaker holds the state of a Pagebreak run.
+type pagebreaker struct {
+	settings *PagebreakSettings
+	items    []Node
+	sums     []vsums
+	// inserts holds the inserts of all items, insertIndex[i] is the number
+	// of inserts in the items before i.
+	inserts     []*Insert
+	insertIndex []int
+	insertCache map[*Insert]insertItemCache
+}
+
+// newPageNode creates an active node for a break at index and looks ahead
+// for the start of the next page.
+func (pb *pagebreaker) newPageNode(index int) *pageNode {
+	pn := &pageNode{index: index, start: len(pb.items), firstBox: -1}
+	for i := index + 1; i < len(pb.items); i++ {
+		if !isDiscardable(pb.items[i]) {
+			pn.start = i
+			break
+		}
+	}
+	for i := pn.start; i < len(pb.items); i++ {
+		if isVerticalBox(pb.items[i]) {
+			pn.firstBox = i
+			break
+		}
+	}
+	if ts := pb.settings.TopSkip; ts != nil && pn.firstBox >= 0 {
+		_, ht, _ := pb.items[pn.firstBox].Sizes(Vertical)
+		pn.topskipWidth = max(0, ts.Width-ht)
+	}
+	return pn
+}
+
+// bodySums returns the sums of the page that starts after a and ends at the
+// item with the index b without the inserts.
+func (pb *pagebreaker) bodySums(a *pageNode, b int) vsums {
+	s := pb.sums[b].sub(pb.sums[a.start])
+	if ts := pb.settings.TopSkip; ts != nil && a.firstBox >= 0 && a.firstBox < b {
+		s.height += a.topskipWidth
+		s.stretch[ts.StretchOrder] += ts.Stretch
+		s.shrink += ts.Shrink
+	}
+	return s
+}
+
+// pageSums returns the sums of the page that starts after a and ends at
+// the item with the index b, including the inserts that fit on the page.
+// carry is the insert material that has to go to the next page.
+func (pb *pagebreaker) pageSums(a *pageNode, b int) (s vsums, carry []insertPart) {
+	s = pb.bodySums(a, b)
+	if pb.insertIndex == nil {
+		return s, nil
+	}
+	ins, _, carry := pb.insertSums(pb.pageInserts(a.carry, a.start, b), s)
+	s.height += ins.height
+	s.shrink += ins.shrink
+	for i := range s.stretch {
+		s.stretch[i] += ins.stretch[i]
+	}
+	return s, carry
+}
+
+// isPagebreakCandidate returns the penalty at item i and whether i is a
+// legal page break.
+func (pb *pagebreaker) isPagebreakCandidate(i int) (int, bool) {
+	switch t := pb.items[i].(type) {
+	case *Penalty:
+		return t.Penalty, t.Penalty < 10000
+	case *Glue:
+		return 0, i > 0 && !isDiscardable(pb.items[i-1])
+	case *Kern:
+		if i+1 < len(pb.items) {
+			_, ok := pb.items[i+1].(*Glue)
+			return 0, ok
+		}
+	}
+	return 0, false
+}
+
+func pageDemerits(badness, penalty int) int {
+	d := (1 + badness) * (1 + badness)
+	switch {
+	case penalty >= 0:
+		d += penalty * penalty
+	case penalty > -10000:
+		d -= penalty * penalty
+	}
+	return d
+}
+
+// Pagebreak breaks the vertical list into pages of settings.PageHeight
+// using a total-fit algorithm like the Knuth-Plass line breaker. Legal
+// breakpoints are glue that follows non-discardable material, kerns that
+// are followed by glue and penalties below 10000. Glue, kerns and penalties
+// at the top of a page are discarded. The nodes of vlist are moved into the
+// returned pages, which are packed to settings.PageHeight. The breakpoints
+// describe the chosen page breaks: Line is the page number, Width the
+// natural height of the page material and R the adjustment ratio needed to
+// fill the page.
+func Pagebreak(vlist *VList, settings *PagebreakSettings) ([]*VList, []*Breakpoint) {
+	if vlist == nil || vlist.List == nil {
+		return nil, nil
+	}
+	pb := &pagebreaker{settings: settings}
+	for e := vlist.List; e != nil; e = e.Next() {
+		pb.items = append(pb.items, e)
+	}
+	pb.sums = make([]vsums, len(pb.items)+1)
+	for i, itm := range pb.items {
+		s := pb.sums[i]
+		if g, ok := itm.(*Glue); ok {
+			s.stretch[g.StretchOrder] += g.Stretch
+			s.shrink += g.Shrink
+		}
+		s.height += verticalSize(itm)
+		pb.sums[i+1] = s
+	}
+	if settings.Inserts != nil {
+		pb.insertIndex = make([]int, len(pb.items)+1)
+		for i, itm := range pb.items {
+			pb.inserts = append(pb.inserts, nodeInserts(itm)...)
+			pb.insertIndex[i+1] = len(pb.inserts)
+		}
+	}
+
+	start := pb.newPageNode(-1)
+	active := []*pageNode{start}
+	var lastDeactivated *pageNode
+	var final *pageNode
+	for b := 0; b <= len(pb.items); b++ {
+		penalty, forced := -10000, true
+		if b < len(pb.items) {
+			var ok bool
+			if penalty, ok = pb.isPagebreakCandidate(b); !ok {
+				continue
+			}
+			forced = penalty <= -10000
+		}
+		var best *pageNode
+		stillActive := active[:0]
+		for _, a := range active {
+			if a.start >= b {
+				// Only discardable material between a and b, breaking here
+				// would create an empty page.
+				stillActive = append(stillActive, a)
+				if b == len(pb.items) && (final == nil || a.demerits <= final.demerits) {
+					final = a
+				}
+				continue
+			}
+			s, carry := pb.pageSums(a, b)
+			r, badness, overfull := verticalBadness(s, settings.PageHeight)
+			if overfull {
+				if lastDeactivated == nil || a.index > lastDeactivated.index {
+					lastDeactivated = a
+				}
+				continue
+			}
+			if !forced {
+				stillActive = append(stillActive, a)
+			}
+			if badness > settings.Tolerance && !forced {
+				continue
+			}
+			d := a.demerits + pageDemerits(badness, penalty)
+			if len(carry) > 0 {
+				d += settings.Inserts.SplitPenalty * settings.Inserts.SplitPenalty * len(carry)
+			}
+			// On a tie prefer the later predecessor, so earlier pages are
+			// filled as much as possible.
+			if best == nil {
+				best = pb.newPageNode(b)
+			} else if d > best.demerits {
+				continue
+			}
+			best.from, best.demerits, best.r, best.height, best.page = a, d, r, s.height, a.page+1
+			best.carry = carry
+		}
+		active = stillActive
+		if best == nil && len(active) == 0 && lastDeactivated != nil {
+			// Emergency: nothing fits, so we accept an overfull page that
+			// is as short as possible.
+			a := lastDeactivated
+			s, carry := pb.pageSums(a, b)
+			best = pb.newPageNode(b)
+			best.from, best.height, best.page, best.carry = a, s.height, a.page+1, carry
+			best.r, _, _ = verticalBadness(s, settings.PageHeight)
+			best.demerits = a.demerits + pageDemerits(10000, 10000)
+			lastDeactivated = nil
+		}
+		if best == nil {
+			continue
+		}
+		if b == len(pb.items) {
+			if final == nil || best.demerits <= final.demerits {
+				final = best
+			}
+			break
+		}
+		active = append(active, best)
+	}
+	if final == nil || final.page == 0 {
+		return nil, nil
+	}
+
+	var chain []*pageNode
+	for e := final; e.from != nil; e = e.from {
+		chain = append(chain, e)
+	}
+	pages := make([]*VList, 0, len(chain))
+	breakpoints := make([]*Breakpoint, 0, len(chain))
+	// The inserts are placed again because Renumber may change them.
+	var carry []insertPart
+	for i := len(chain) - 1; i >= 0; i-- {
+		e := chain[i]
+		a := e.from
+		first, last := pb.items[a.start], pb.items[e.index-1]
+		first.SetPrev(nil)
+		last.SetNext(nil)
+		head := first
+		if ts := settings.TopSkip; ts != nil && a.firstBox >= 0 && a.firstBox < e.index {
+			g := ts.Copy().(*Glue)
+			g.Width = a.topskipWidth
+			g.Attributes = H{"origin": "topskip"}
+			head = InsertBefore(head, head, g)
+		}
+		if pb.insertIndex != nil {
+			if rn := settings.Inserts.Renumber; rn != nil {
+				rn(e.page, pb.inserts[pb.insertIndex[a.start]:pb.insertIndex[e.index]])
+			}
+			var placed []insertPart
+			parts := pb.pageInserts(carry, a.start, e.index)
+			_, placed, carry = pb.insertSums(parts, pb.bodySums(a, e.index))
+			if len(placed) > 0 {
+				InsertAfter(head, Tail(head), pb.buildInsertArea(placed))
+			}
+		}
+		vl := VpackTo(head, settings.PageHeight)
+		vl.Attributes = H{"origin": "Pagebreak"}
+		pages = append(pages, vl)
+
+		pos := last
+		if e.index < len(pb.items) {
+			pos = pb.items[e.index]
+		}
+		breakpoints = append(breakpoints, &Breakpoint{
+			Position: pos,
+			Line:     e.page,
+			Width:    e.height,
+			R:        e.r,
+			Demerits: e.demerits,
+		})
+	}
+	// Insert material that did not fit on the last page gets pages of its
+	// own.
+	for len(carry) > 0 {
+		var placed []insertPart
+		_, placed, carry = pb.insertSums(carry, vsums{})
+		if len(placed) == 0 {
+			// Too high for a page, so it has to go unsplit.
+			placed, carry = carry[:1], carry[1:]
+		}
+		vl := VpackTo(pb.buildInsertArea(placed), settings.PageHeight)
+		vl.Attributes = H{"origin": "Pagebreak"}
+		pages = append(pages, vl)
+		breakpoints = append(breakpoints, &Breakpoint{Line: len(pages)})
+	}
+	return pages, breakpoints
+}
@@ -0,0 +1,176 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// lineBox returns an empty HList of the given height, standing in for a
+// typeset line.
+func lineBox(ht bag.ScaledPoint) *HList {
+	hl := NewHList()
+	hl.Width = 100 * bag.Factor
+	hl.Height = ht
+	return hl
+}
+
+// buildLines creates a vertical list of n lines of 10pt height separated by
+// glue of 2pt. The glue has the given stretch.
+func buildLines(n int, stretch bag.ScaledPoint) *VList {
+	var head, cur Node
+	for i := range n {
+		if i > 0 {
+			g := NewGlue()
+			g.Width = 2 * bag.Factor
+			g.Stretch = stretch
+			head = InsertAfter(head, cur, g)
+			cur = g
+		}
+		hl := lineBox(10 * bag.Factor)
+		head = InsertAfter(head, cur, hl)
+		cur = hl
+	}
+	return Vpack(head)
+}
+
+// TestPagebreakSplitsIntoPages breaks ten lines (118pt in total) into pages
+// of 60pt. Five lines (58pt) fit on a page, so we expect two pages, each
+// starting with a line and not with the discarded glue.
+func TestPagebreakSplitsIntoPages(t *testing.T) {
+	vl := buildLines(10, 0)
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 60 * bag.Factor
+	pages, bps := Pagebreak(vl, settings)
+	if got, want := len(pages), 2; got != want {
+		t.Fatalf("got %d pages, want %d", got, want)
+	}
+	if len(bps) != len(pages) {
+		t.Fatalf("got %d breakpoints for %d pages", len(bps), len(pages))
+	}
+	for i, pg := range pages {
+		if _, ok := pg.List.(*HList); !ok {
+			t.Errorf("page %d starts with %T, want *HList", i+1, pg.List)
+		}
+		if got, want := countHLists(pg), 5; got != want {
+			t.Errorf("page %d has %d lines, want %d", i+1, got, want)
+		}
+		if got, want := bps[i].Line, i+1; got != want {
+			t.Errorf("breakpoint %d reports page %d, want %d", i, got, want)
+		}
+		if pg.Height+pg.Depth > settings.PageHeight {
+			t.Errorf("page %d is %s high, exceeds %s", i+1, pg.Height+pg.Depth, settings.PageHeight)
+		}
+	}
+}
+
+// TestPagebreakForcedAndForbidden checks that a penalty of -10000 forces a
+// break and a penalty of 10000 keeps the material around it together.
+func TestPagebreakForcedAndForbidden(t *testing.T) {
+	vl := buildLines(4, 0)
+	// Force a page break after the first line.
+	p := NewPenalty()
+	p.Penalty = -10000
+	InsertAfter(vl.List, vl.List, p)
+
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 100 * bag.Factor
+	pages, _ := Pagebreak(vl, settings)
+	if got, want := len(pages), 2; got != want {
+		t.Fatalf("got %d pages, want %d", got, want)
+	}
+	if got, want := countHLists(pages[0]), 1; got != want {
+		t.Errorf("first page has %d lines, want %d", got, want)
+	}
+
+	// Two lines fit on a page, but the glue between the second and the
+	// third line is not a legal break: the second line has to move to the
+	// next page.
+	vl = buildLines(5, 0)
+	second := vl.List.Next().Next()
+	keep := NewPenalty()
+	keep.Penalty = 10000
+	InsertAfter(vl.List, second, keep)
+	settings.PageHeight = 24 * bag.Factor
+	pages, _ = Pagebreak(vl, settings)
+	if got, want := len(pages), 3; got != want {
+		t.Fatalf("got %d pages, want %d", got, want)
+	}
+	for i, want := range []int{1, 2, 2} {
+		if got := countHLists(pages[i]); got != want {
+			t.Errorf("page %d has %d lines, want %d", i+1, got, want)
+		}
+	}
+}
+
+// TestPagebreakTopSkip verifies that TopSkip is inserted at the top of each
+// page, reduced by the height of the first line.
+func TestPagebreakTopSkip(t *testing.T) {
+	vl := buildLines(4, 0)
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 30 * bag.Factor
+	settings.TopSkip = NewGlue()
+	settings.TopSkip.Width = 12 * bag.Factor
+	pages, _ := Pagebreak(vl, settings)
+	if got, want := len(pages), 2; got != want {
+		t.Fatalf("got %d pages, want %d", got, want)
+	}
+	for i, pg := range pages {
+		g, ok := pg.List.(*Glue)
+		if !ok {
+			t.Fatalf("page %d starts with %T, want *Glue", i+1, pg.List)
+		}
+		if got, want := g.Width, bag.ScaledPoint(2*bag.Factor); got != want {
+			t.Errorf("page %d topskip is %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+// TestPagebreakOverfullBox makes sure a box that is taller than the page
+// ends up on a page of its own instead of stalling the algorithm.
+func TestPagebreakOverfullBox(t *testing.T) {
+	var head, cur Node
+	for i, ht := range []bag.ScaledPoint{10, 200, 10} {
+		if i > 0 {
+			g := NewGlue()
+			g.Width = 2 * bag.Factor
+			head = InsertAfter(head, cur, g)
+			cur = g
+		}
+		hl := lineBox(ht * bag.Factor)
+		head = InsertAfter(head, cur, hl)
+		cur = hl
+	}
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 50 * bag.Factor
+	pages, _ := Pagebreak(Vpack(head), settings)
+	if got, want := len(pages), 3; got != want {
+		t.Fatalf("got %d pages, want %d", got, want)
+	}
+	if got, want := countHLists(pages[1]), 1; got != want {
+		t.Errorf("second page has %d boxes, want %d", got, want)
+	}
+	if got, want := pages[1].Badness, 1000000; got != want {
+		t.Errorf("second page has badness %d, want %d (overfull)", got, want)
+	}
+}
+
+// TestPagebreakTieFillsEarlierPages breaks twelve lines without stretch into
+// pages of 60pt. Every underfull page has the same badness, so the ways to
+// distribute the lines over three pages (5+5+2, 4+4+4, 2+5+5, ...) tie. The
+// tie goes to the later predecessor, which fills the earlier pages first.
+func TestPagebreakTieFillsEarlierPages(t *testing.T) {
+	vl := buildLines(12, 0)
+	settings := NewPagebreakSettings()
+	settings.PageHeight = 60 * bag.Factor
+	pages, _ := Pagebreak(vl, settings)
+	want := []int{5, 5, 2}
+	if len(pages) != len(want) {
+		t.Fatalf("got %d pages, want %d", len(pages), len(want))
+	}
+	for i, pg := range pages {
+		if got := countHLists(pg); got != want[i] {
+			t.Errorf("page %d has %d lines, want %d", i+1, got, want[i])
+		}
+	}
+}
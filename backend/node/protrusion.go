@@ -0,0 +1,165 @@
+package node
+
+import (
+	pdf "github.com/boxesandglue/baseline-pdf"
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// Protrusion holds the amount a glyph may hang into the left and the right
+// margin as a fraction of the glyph width. 0.5 lets half of the glyph
+// protrude.
+type Protrusion struct {
+	Left  float64
+	Right float64
+}
+
+// ProtrusionTable maps the components of a glyph (see Glyph.Components) to
+// its protrusion factors.
+type ProtrusionTable map[string]Protrusion
+
+// ProtrusionSet is a collection of protrusion tables (margin kerning). The
+// table for the font face of a glyph takes precedence over the default
+// table.
+type ProtrusionSet struct {
+	Name    string
+	Default ProtrusionTable
+	Faces   map[*pdf.Face]ProtrusionTable
+}
+
+// NewProtrusionSet returns an empty protrusion set with the given name.
+func NewProtrusionSet(name string) *ProtrusionSet {
+	return &ProtrusionSet{
+		Name:    name,
+		Default: ProtrusionTable{},
+		Faces:   make(map[*pdf.Face]ProtrusionTable),
+	}
+}
+
+// DefaultProtrusionSet returns a protrusion set named "default" with values
+// for Latin punctuation, dashes and quotes similar to the defaults of the
+// LaTeX microtype package.
+func DefaultProtrusionSet() *ProtrusionSet {
+	ps := NewProtrusionSet("default")
+	ps.Default = ProtrusionTable{
+		".":  {Right: 0.7},
+		",":  {Right: 0.5},
+		":":  {Right: 0.5},
+		";":  {Right: 0.3},
+		"!":  {Right: 0.2},
+		"?":  {Right: 0.2},
+		"-":  {Right: 0.7},
+		"‐":  {Right: 0.7}, // hyphen
+		"–":  {Left: 0.2, Right: 0.2},
+		"—":  {Left: 0.15, Right: 0.15},
+		"…":  {Right: 0.2},
+		"\"": {Left: 0.5, Right: 0.5},
+		"'":  {Left: 0.5, Right: 0.5},
+		"‘":  {Left: 0.5, Right: 0.3},
+		"’":  {Left: 0.3, Right: 0.5},
+		"‚":  {Left: 0.4, Right: 0.4},
+		"“":  {Left: 0.5, Right: 0.3},
+		"”":  {Left: 0.3, Right: 0.5},
+		"„":  {Left: 0.4, Right: 0.4},
+		"«":  {Left: 0.2, Right: 0.2},
+		"»":  {Left: 0.2, Right: 0.2},
+		"‹":  {Left: 0.2, Right: 0.2},
+		"›":  {Left: 0.2, Right: 0.2},
+	}
+	return ps
+}
+
+// Lookup returns the protrusion factors for the glyph.
+func (ps *ProtrusionSet) Lookup(g *Glyph) Protrusion {
+	if ps == nil || g == nil {
+		return Protrusion{}
+	}
+	if g.Font != nil && g.Font.Face != nil {
+		if tbl, ok := ps.Faces[g.Font.Face]; ok {
+			if p, ok := tbl[g.Components]; ok {
+				return p
+			}
+		}
+	}
+	return ps.Default[g.Components]
+}
+
+// left returns the amount the glyph protrudes into the left margin.
+func (ps *ProtrusionSet) left(g *Glyph) bag.ScaledPoint {
+	if g == nil {
+		return 0
+	}
+	return bag.MultiplyFloat(g.Width, ps.Lookup(g).Left)
+}
+
+// right returns the amount the glyph protrudes into the right margin.
+func (ps *ProtrusionSet) right(g *Glyph) bag.ScaledPoint {
+	if g == nil {
+		return 0
+	}
+	return bag.MultiplyFloat(g.Width, ps.Lookup(g).Right)
+}
+
+// isMarginSkippable reports whether n is ignored when looking for the glyph
+// at the edge of a line.
+func isMarginSkippable(n Node) bool {
+	switch n.(type) {
+	case *Glue, *Kern, *Penalty:
+		return true
+	}
+	return false
+}
+
+// leftMarginGlyph returns the first glyph from n up to stop, skipping glue,
+// kerns and penalties. It returns nil if the line starts with other
+// material. A nil stop searches to the end of the list.
+func leftMarginGlyph(n, stop Node) *Glyph {
+	for ; n != nil; n = n.Next() {
+		if g, ok := n.(*Glyph); ok {
+			return g
+		}
+		if !isMarginSkippable(n) || n == stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// rightMarginGlyph returns the last glyph from n backwards down to stop,
+// skipping glue, kerns and penalties.
+func rightMarginGlyph(n, stop Node) *Glyph {
+	for ; n != nil; n = n.Prev() {
+		if g, ok := n.(*Glyph); ok {
+			return g
+		}
+		if !isMarginSkippable(n) || n == stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// insertProtrusionKerns inserts negative kerns before the first and after
+// the last glyph of the list from first to last, so these glyphs hang into
+// the margins. It returns the new first and last node.
+func insertProtrusionKerns(ps *ProtrusionSet, first, last Node) (Node, Node) {
+	if g := leftMarginGlyph(first, last); g != nil {
+		if wd := ps.left(g); wd != 0 {
+			k := NewKern()
+			k.Kern = -wd
+			k.Attributes = H{"origin": "protrusion"}
+			first = InsertBefore(first, g, k)
+		}
+	}
+	if g := rightMarginGlyph(last, first); g != nil {
+		if wd := ps.right(g); wd != 0 {
+			k := NewKern()
+			k.Kern = -wd
+			k.Attributes = H{"origin": "protrusion"}
+			InsertAfter(first, g, k)
+			if g == last {
+				last = k
+			}
+		}
+	}
+	return first, last
+}
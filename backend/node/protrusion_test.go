@@ -0,0 +1,84 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// protrusionKerns returns the widths of the protrusion kerns in the list.
+func protrusionKerns(n Node) []bag.ScaledPoint {
+	var ret []bag.ScaledPoint
+	for ; n != nil; n = n.Next() {
+		if k, ok := n.(*Kern); ok && k.Attributes["origin"] == "protrusion" {
+			ret = append(ret, k.Kern)
+		}
+	}
+	return ret
+}
+
+func TestProtrusionLookup(t *testing.T) {
+	ps := DefaultProtrusionSet()
+	g := NewGlyph()
+	g.Components = "."
+	if got := ps.Lookup(g); got.Right != 0.7 {
+		t.Errorf("Lookup(.).Right = %v, want 0.7", got.Right)
+	}
+	g.Components = "a"
+	if got := ps.Lookup(g); got != (Protrusion{}) {
+		t.Errorf("Lookup(a) = %v, want no protrusion", got)
+	}
+	if got := (*ProtrusionSet)(nil).Lookup(g); got != (Protrusion{}) {
+		t.Errorf("nil set returns %v, want no protrusion", got)
+	}
+}
+
+// TestLinebreakProtrusion breaks “abcd abcd. abcd (5pt per glyph) into
+// lines of 49.5pt. The first two words are 55pt wide, so they only fit on a
+// line without being overfull if the quote and the period hang into the margins.
+func TestLinebreakProtrusion(t *testing.T) {
+	build := func() Node {
+		var head, cur Node
+		for i, w := range []string{"“abcd", "abcd.", "abcd"} {
+			if i > 0 {
+				g := NewGlue()
+				g.Width = 5 * bag.Factor
+				g.Stretch = 10 * bag.Factor
+				head = InsertAfter(head, cur, g)
+				cur = g
+			}
+			head, cur = glyphRun(head, cur, w, 5*bag.Factor)
+		}
+		AppendLineEndAfter(head, cur)
+		return head
+	}
+	settings := NewLinebreakSettings()
+	settings.HSize = 99 * bag.Factor / 2
+	settings.Protrusion = DefaultProtrusionSet()
+	vl, _ := Linebreak(build(), settings)
+	if got, want := countHLists(vl), 2; got != want {
+		t.Fatalf("got %d lines, want %d", got, want)
+	}
+	first := vl.List.(*HList)
+	kerns := protrusionKerns(first.List)
+	want := []bag.ScaledPoint{-bag.MultiplyFloat(5*bag.Factor, 0.5), -bag.MultiplyFloat(5*bag.Factor, 0.7)}
+	if len(kerns) != len(want) {
+		t.Fatalf("got protrusion kerns %v, want %v", kerns, want)
+	}
+	for i := range want {
+		if kerns[i] != want[i] {
+			t.Errorf("protrusion kern %d is %s, want %s", i, kerns[i], want[i])
+		}
+	}
+	if first.Badness > 100 {
+		t.Errorf("first line has badness %d", first.Badness)
+	}
+
+	settings.Protrusion = nil
+	vl, _ = Linebreak(build(), settings)
+	// Without protrusion the first line can't get the two words without
+	// being overfull.
+	if first := vl.List.(*HList); countHLists(vl) == 2 && first.Badness <= 10000 {
+		t.Errorf("without protrusion the first line has badness %d, want overfull", first.Badness)
+	}
+}
@@ -0,0 +1,178 @@
+package node
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// Matrix is an affine transformation like the operands of the PDF operator
+// cm. A point x, y is transformed to
+//
+//	x' = A*x + C*y + E
+//	y' = B*x + D*y + F
+//
+// y grows upwards as in PDF.
+type Matrix struct {
+	A, B, C, D float64
+	E, F       bag.ScaledPoint
+}
+
+// IdentityMatrix returns the matrix that leaves all points unchanged.
+func IdentityMatrix() Matrix {
+	return Matrix{A: 1, D: 1}
+}
+
+// RotateMatrix returns a counterclockwise rotation around the origin by the
+// angle in degrees.
+func RotateMatrix(degrees float64) Matrix {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	// Avoid tiny errors for multiples of 90 degrees.
+	sin, cos = math.Round(sin*1e12)/1e12, math.Round(cos*1e12)/1e12
+	return Matrix{A: cos, B: sin, C: -sin, D: cos}
+}
+
+// ScaleMatrix returns a scaling by sx horizontally and sy vertically.
+func ScaleMatrix(sx, sy float64) Matrix {
+	return Matrix{A: sx, D: sy}
+}
+
+// SkewMatrix returns a skew transformation. ax is the angle in degrees by
+// which the vertical axis is slanted to the right (a positive value gives a
+// faux oblique), ay the angle by which the horizontal axis is slanted
+// upwards.
+func SkewMatrix(ax, ay float64) Matrix {
+	return Matrix{A: 1, B: math.Tan(ay * math.Pi / 180), C: math.Tan(ax * math.Pi / 180), D: 1}
+}
+
+// TranslateMatrix returns a translation by x, y.
+func TranslateMatrix(x, y bag.ScaledPoint) Matrix {
+	return Matrix{A: 1, D: 1, E: x, F: y}
+}
+
+// Multiply returns the transformation that applies m first and then n.
+func (m Matrix) Multiply(n Matrix) Matrix {
+	return Matrix{
+		A: m.A*n.A + m.B*n.C,
+		B: m.A*n.B + m.B*n.D,
+		C: m.C*n.A + m.D*n.C,
+		D: m.C*n.B + m.D*n.D,
+		E: bag.MultiplyFloat(m.E, n.A) + bag.MultiplyFloat(m.F, n.C) + n.E,
+		F: bag.MultiplyFloat(m.E, n.B) + bag.MultiplyFloat(m.F, n.D) + n.F,
+	}
+}
+
+// Apply returns the transformed point.
+func (m Matrix) Apply(x, y bag.ScaledPoint) (bag.ScaledPoint, bag.ScaledPoint) {
+	return bag.MultiplyFloat(x, m.A) + bag.MultiplyFloat(y, m.C) + m.E,
+		bag.MultiplyFloat(x, m.B) + bag.MultiplyFloat(y, m.D) + m.F
+}
+
+// Bounds returns the bounding box of the transformed rectangle from x1, y1
+// to x2, y2.
+func (m Matrix) Bounds(x1, y1, x2, y2 bag.ScaledPoint) (minX, minY, maxX, maxY bag.ScaledPoint) {
+	for i, c := range [][2]bag.ScaledPoint{{x1, y1}, {x2, y1}, {x1, y2}, {x2, y2}} {
+		x, y := m.Apply(c[0], c[1])
+		if i == 0 {
+			minX, minY, maxX, maxY = x, y, x, y
+			continue
+		}
+		minX, minY = min(minX, x), min(minY, y)
+		maxX, maxY = max(maxX, x), max(maxY, y)
+	}
+	return
+}
+
+// String returns the six operands of the PDF operator cm.
+func (m Matrix) String() string {
+	return fmt.Sprintf("%s %s %s %s %s %s", fmtFloat(m.A), fmtFloat(m.B), fmtFloat(m.C), fmtFloat(m.D), m.E, m.F)
+}
+
+func fmtFloat(f float64) string {
+	return fmt.Sprintf("%.5g", f)
+}
+
+// A Transform shows a box (an HList or a VList) rotated, scaled, skewed or
+// otherwise transformed by Matrix. For the layout, the transform is a box
+// with the size of the bounding box of the transformed contents. Matrix maps
+// the coordinates of the contents (origin at the left end of the baseline
+// for an HList, at the bottom left corner minus the depth for a VList) to
+// the coordinates of the transform node.
+type Transform struct {
+	basenode
+	Width  bag.ScaledPoint
+	Height bag.ScaledPoint
+	Depth  bag.ScaledPoint
+	Matrix Matrix
+	List   Node
+}
+
+func (t *Transform) String() string {
+	return fmt.Sprintf("transform: %s", t.Matrix)
+}
+
+// Sizes returns the size of the transformed bounding box.
+func (t *Transform) Sizes(Direction) (w, h, d bag.ScaledPoint) {
+	return t.Width, t.Height, t.Depth
+}
+
+// DebugAttributes returns the geometry and the matrix of the transform.
+func (t *Transform) DebugAttributes() ([]kv, H) {
+	return []kv{
+		{key: "id", value: t.ID},
+		{key: "wd", value: t.Width},
+		{key: "ht", value: t.Height},
+		{key: "dp", value: t.Depth},
+		{key: "matrix", value: t.Matrix.String()},
+	}, t.Attributes
+}
+
+// Copy creates a deep copy of the node.
+func (t *Transform) Copy() Node {
+	n := NewTransform()
+	n.Width = t.Width
+	n.Height = t.Height
+	n.Depth = t.Depth
+	n.Matrix = t.Matrix
+	if t.List != nil {
+		n.List = t.List.Copy()
+	}
+	return n
+}
+
+// NewTransform creates an initialized Transform node with the identity
+// matrix.
+func NewTransform() *Transform {
+	n := transformSlab.alloc()
+	n.ID = newID()
+	n.typ = TypeTransform
+	n.Matrix = IdentityMatrix()
+	return n
+}
+
+// TransformBox wraps the HList or VList box in a Transform node with the
+// matrix m. The transform gets the size of the bounding box of the
+// transformed box. The contents are moved horizontally so that the bounding
+// box starts at the origin, the baseline stays at y = 0.
+func TransformBox(box Node, m Matrix) (*Transform, error) {
+	var wd, ht, dp bag.ScaledPoint
+	switch v := box.(type) {
+	case *HList:
+		wd, ht, dp = v.Width, v.Height, v.Depth
+	case *VList:
+		wd, ht, dp = v.Width, v.Height, v.Depth
+	default:
+		return nil, fmt.Errorf("TransformBox: cannot transform a %s", box.Type())
+	}
+	box.SetPrev(nil)
+	box.SetNext(nil)
+	minX, minY, maxX, maxY := m.Bounds(0, -dp, wd, ht)
+	t := NewTransform()
+	t.List = box
+	t.Matrix = m.Multiply(TranslateMatrix(-minX, 0))
+	t.Width = maxX - minX
+	t.Height = max(maxY, 0)
+	t.Depth = max(-minY, 0)
+	return t, nil
+}
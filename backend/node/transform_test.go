@@ -0,0 +1,45 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+func TestMatrix(t *testing.T) {
+	pt := bag.Factor
+	if x, y := RotateMatrix(90).Apply(10*pt, 0); x != 0 || y != 10*pt {
+		t.Errorf("rotate 90: (%s,%s), want (0,10)", x, y)
+	}
+	// Scale first, then move.
+	m := ScaleMatrix(2, 3).Multiply(TranslateMatrix(5*pt, 0))
+	if x, y := m.Apply(10*pt, 10*pt); x != 25*pt || y != 30*pt {
+		t.Errorf("scale and translate: (%s,%s), want (25,30)", x, y)
+	}
+	if x, y := SkewMatrix(45, 0).Apply(0, 10*pt); x != 10*pt || y != 10*pt {
+		t.Errorf("skew: (%s,%s), want (10,10)", x, y)
+	}
+	if got, want := IdentityMatrix().String(), "1 0 0 1 0 0"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestTransformBox(t *testing.T) {
+	pt := bag.Factor
+	hl := NewHList()
+	hl.Width, hl.Height, hl.Depth = 100*pt, 8*pt, 2*pt
+	tr, err := TransformBox(hl, RotateMatrix(90))
+	if err != nil {
+		t.Fatalf("TransformBox: %v", err)
+	}
+	if tr.Width != 10*pt || tr.Height != 100*pt || tr.Depth != 0 {
+		t.Errorf("rotated box %s x %s + %s, want 10 x 100 + 0", tr.Width, tr.Height, tr.Depth)
+	}
+	// The depth of the box is now on the left edge.
+	if x, y := tr.Matrix.Apply(0, -2*pt); x != 10*pt || y != 0 {
+		t.Errorf("bottom left corner at (%s,%s), want (10,0)", x, y)
+	}
+	if _, err = TransformBox(NewGlue(), IdentityMatrix()); err == nil {
+		t.Error("TransformBox(glue): no error")
+	}
+}
@@ -20,9 +20,11 @@ type VList struct {
 	// +Y). Symmetric with HList.Shift. Callers that need the parent box
 	// to "see" the shifted bounding box must pre-compute Height / Depth
 	// themselves — Shift is a pure rendering offset.
-	Shift    bag.ScaledPoint
-	GlueSet  float64
-	GlueSign uint8
+	Shift     bag.ScaledPoint
+	Badness   int
+	GlueSet   float64   // The ratio of the glue. Positive means stretching, negative shrinking.
+	GlueOrder GlueOrder // The level of infinity
+	GlueSign  uint8     // 0 = normal, 1 = stretching, 2 = shrinking
 }
 
 func (v *VList) String() string {
@@ -41,6 +43,7 @@ func (v *VList) DebugAttributes() ([]kv, H) {
 		{key: "wd", value: v.Width},
 		{key: "ht", value: v.Height},
 		{key: "dp", value: v.Depth},
+		{key: "r", value: v.GlueSet},
 	}, v.Attributes
 }
 
@@ -50,7 +53,9 @@ func (v *VList) Copy() Node {
 	n.Width = v.Width
 	n.Height = v.Height
 	n.Depth = v.Depth
+	n.Badness = v.Badness
 	n.GlueSet = v.GlueSet
+	n.GlueOrder = v.GlueOrder
 	n.GlueSign = v.GlueSign
 	n.ShiftX = v.ShiftX
 	n.Shift = v.Shift
@@ -58,6 +63,18 @@ func (v *VList) Copy() Node {
 	return n
 }
 
+// GlueWidth returns the size of the glue g in the list after the glue ratio
+// of the VList has been applied (see VpackTo).
+func (v *VList) GlueWidth(g *Glue) bag.ScaledPoint {
+	switch {
+	case v.GlueSign == 1 && g.StretchOrder == v.GlueOrder:
+		return g.Width + bag.MultiplyFloat(g.Stretch, v.GlueSet)
+	case v.GlueSign == 2 && g.ShrinkOrder == v.GlueOrder:
+		return g.Width + bag.MultiplyFloat(g.Shrink, v.GlueSet)
+	}
+	return g.Width
+}
+
 // NewVList creates an initialized VList node
 func NewVList() *VList {
 	n := vlistSlab.alloc()
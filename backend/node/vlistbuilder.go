@@ -0,0 +1,181 @@
+package node
+
+import (
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// InterlineSpacing selects how Linebreak inserts the glue between two
+// lines.
+type InterlineSpacing int
+
+const (
+	// InterlineLineHeight adds glue after each line so that the line and the
+	// glue are LineHeight high. Lines taller than LineHeight get no glue.
+	InterlineLineHeight InterlineSpacing = iota
+	// InterlineBaselineSkip keeps the baselines LineHeight apart like TeX's
+	// \baselineskip and inserts LineSkip if the lines would get closer than
+	// LineSkipLimit (see VListBuilder).
+	InterlineBaselineSkip
+	// InterlineHalfLeading distributes the leading half above and half
+	// below each line like CSS does (see VListBuilder.HalfLeading).
+	InterlineHalfLeading
+)
+
+// VListBuilder assembles a vertical list and inserts interline glue between
+// boxes like TeX's \baselineskip, \lineskip and \lineskiplimit. Boxes are
+// HLists, VLists and images. A rule suppresses the interline glue before
+// the next box.
+type VListBuilder struct {
+	// BaselineSkip is the desired distance between two baselines. Its
+	// stretch and shrink are kept in the inserted glue.
+	BaselineSkip *Glue
+	// LineSkip is inserted if the boxes would otherwise be closer than
+	// LineSkipLimit.
+	LineSkip      *Glue
+	LineSkipLimit bag.ScaledPoint
+	// HalfLeading measures the leading CSS style: the difference between
+	// the BaselineSkip width and the height plus depth of each box is
+	// split in half above and half below the box. With boxes of the same
+	// size this gives the same result as the TeX algorithm, a taller box
+	// pushes both neighbors away.
+	HalfLeading bool
+	// Grid snaps the baseline of every HList to the baseline grid. Other
+	// boxes (VLists and images) are padded at the bottom to the next grid
+	// line.
+	Grid *BaselineGrid
+	// GridOffset is the distance from the grid origin's reference point
+	// (usually the top of the page or column) to the top of the list.
+	GridOffset bag.ScaledPoint
+	head       Node
+	tail       Node
+	prevHeight bag.ScaledPoint
+	prevDepth  bag.ScaledPoint
+	hasPrev    bool
+	// cur is the distance from the top of the list to the bottom of the
+	// last node.
+	cur bag.ScaledPoint
+}
+
+// BaselineGrid is a grid of baselines with a fixed distance (Pitch). The
+// first baseline is at Origin, measured from the top of the page or
+// column.
+type BaselineGrid struct {
+	Pitch  bag.ScaledPoint
+	Origin bag.ScaledPoint
+}
+
+// Next returns the position of the first baseline at or below pos.
+func (bg *BaselineGrid) Next(pos bag.ScaledPoint) bag.ScaledPoint {
+	if pos <= bg.Origin || bg.Pitch <= 0 {
+		return bg.Origin
+	}
+	k := (pos - bg.Origin + bg.Pitch - 1) / bg.Pitch
+	return bg.Origin + k*bg.Pitch
+}
+
+// NewVListBuilder returns a builder for the given baseline distance. The
+// line skip is 1pt and the line skip limit 0pt like in plain TeX.
+func NewVListBuilder(baselineskip bag.ScaledPoint) *VListBuilder {
+	bs := NewGlue()
+	bs.Width = baselineskip
+	ls := NewGlue()
+	ls.Width = bag.Factor
+	return &VListBuilder{
+		BaselineSkip: bs,
+		LineSkip:     ls,
+	}
+}
+
+// interlineGlue returns the glue between the previous box and a box of the
+// given height and depth.
+func (vb *VListBuilder) interlineGlue(ht, dp bag.ScaledPoint) *Glue {
+	var d bag.ScaledPoint
+	if vb.HalfLeading {
+		d = vb.BaselineSkip.Width - (vb.prevHeight+vb.prevDepth+ht+dp)/2
+	} else {
+		d = vb.BaselineSkip.Width - vb.prevDepth - ht
+	}
+	var g *Glue
+	if d < vb.LineSkipLimit {
+		g = vb.LineSkip.Copy().(*Glue)
+		g.Attributes = H{"origin": "lineskip"}
+	} else {
+		g = vb.BaselineSkip.Copy().(*Glue)
+		g.Width = d
+		g.Attributes = H{"origin": "baselineskip"}
+	}
+	return g
+}
+
+// Append adds n to the end of the vertical list. If n is a box, the
+// interline glue is inserted before it.
+func (vb *VListBuilder) Append(n Node) {
+	switch n.(type) {
+	case *HList, *VList, *Image, *Transform, *Clip:
+		_, ht, dp := n.Sizes(Vertical)
+		var g *Glue
+		if vb.hasPrev {
+			g = vb.interlineGlue(ht, dp)
+		}
+		if _, ok := n.(*HList); ok && vb.Grid != nil {
+			pos := vb.GridOffset + vb.cur + ht
+			if g != nil {
+				pos += g.Width
+			}
+			if g != nil {
+				// Stretching or shrinking would move the line off the grid.
+				g.Stretch, g.Shrink = 0, 0
+			}
+			if d := vb.Grid.Next(pos) - pos; d > 0 {
+				if g == nil {
+					g = NewGlue()
+				}
+				g.Width += d
+				g.Attributes = H{"origin": "grid"}
+			}
+		}
+		if g != nil {
+			vb.add(g)
+		}
+		vb.prevHeight, vb.prevDepth, vb.hasPrev = ht, dp, true
+		vb.add(n)
+		if _, ok := n.(*HList); !ok && vb.Grid != nil {
+			vb.padToGrid()
+		}
+		return
+	case *Rule:
+		vb.hasPrev = false
+	}
+	vb.add(n)
+}
+
+// add appends n to the list.
+func (vb *VListBuilder) add(n Node) {
+	vb.head = InsertAfter(vb.head, vb.tail, n)
+	vb.tail = n
+	vb.cur += verticalSize(n)
+}
+
+// padToGrid adds glue so the list ends on a grid line. The following box
+// starts as if it was the first box on the grid.
+func (vb *VListBuilder) padToGrid() {
+	pos := vb.GridOffset + vb.cur
+	d := vb.Grid.Next(pos) - pos
+	if d <= 0 {
+		return
+	}
+	g := NewGlue()
+	g.Width = d
+	g.Attributes = H{"origin": "gridpadding"}
+	vb.add(g)
+}
+
+// List returns the head of the vertical list.
+func (vb *VListBuilder) List() Node {
+	return vb.head
+}
+
+// Vpack returns the vertical list packed to its natural height.
+func (vb *VListBuilder) Vpack() *VList {
+	return Vpack(vb.head)
+}
@@ -0,0 +1,171 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// boxWithDepth returns an empty HList with the given height and depth.
+func boxWithDepth(ht, dp bag.ScaledPoint) *HList {
+	hl := lineBox(ht)
+	hl.Depth = dp
+	return hl
+}
+
+// interlineGlues returns the widths of the glue nodes in the list.
+func interlineGlues(n Node) []bag.ScaledPoint {
+	var ret []bag.ScaledPoint
+	for ; n != nil; n = n.Next() {
+		if g, ok := n.(*Glue); ok {
+			ret = append(ret, g.Width)
+		}
+	}
+	return ret
+}
+
+func TestVListBuilder(t *testing.T) {
+	pt := func(f float64) bag.ScaledPoint { return bag.ScaledPoint(f * float64(bag.Factor)) }
+	for _, tc := range []struct {
+		name        string
+		halfLeading bool
+		want        []bag.ScaledPoint
+	}{
+		// 12 - 2 - 8, then the 20pt box: 12 - 2 - 20 < 0 uses lineskip.
+		{"baselineskip", false, []bag.ScaledPoint{pt(2), pt(1)}},
+		// 12 - (8+2+8+2)/2, then 12 - (8+2+20+2)/2 < 0 uses lineskip.
+		{"halfleading", true, []bag.ScaledPoint{pt(2), pt(1)}},
+	} {
+		vb := NewVListBuilder(pt(12))
+		vb.HalfLeading = tc.halfLeading
+		vb.Append(boxWithDepth(pt(8), pt(2)))
+		vb.Append(boxWithDepth(pt(8), pt(2)))
+		vb.Append(boxWithDepth(pt(20), pt(2)))
+		got := interlineGlues(vb.List())
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: got glues %v, want %v", tc.name, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: glue %d is %s, want %s", tc.name, i, got[i], tc.want[i])
+			}
+		}
+	}
+
+	// A rule suppresses the interline glue, penalties do not.
+	vb := NewVListBuilder(12 * bag.Factor)
+	vb.Append(boxWithDepth(8*bag.Factor, 0))
+	vb.Append(NewRule())
+	vb.Append(boxWithDepth(8*bag.Factor, 0))
+	vb.Append(NewPenalty())
+	vb.Append(boxWithDepth(8*bag.Factor, 0))
+	if got := interlineGlues(vb.List()); len(got) != 1 || got[0] != 4*bag.Factor {
+		t.Errorf("got glues %v, want [4pt]", got)
+	}
+}
+
+// TestLinebreakBaselineSkip checks that a tall line does not collide with
+// the line above: with InterlineBaselineSkip the baselines are LineHeight
+// apart unless the lines would overlap.
+func TestLinebreakBaselineSkip(t *testing.T) {
+	settings := NewLinebreakSettings()
+	settings.HSize = 200 * bag.Factor
+	settings.LineHeight = 12 * bag.Factor
+	settings.InterlineSpacing = InterlineBaselineSkip
+	vl, _ := Linebreak(fourLineParagraph(), settings)
+	var lines []*HList
+	for e := vl.List; e != nil; e = e.Next() {
+		if hl, ok := e.(*HList); ok {
+			lines = append(lines, hl)
+		}
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	// The lines have no height, so the glue is the full baseline skip.
+	for i, g := range interlineGlues(vl.List) {
+		if g != 12*bag.Factor {
+			t.Errorf("glue %d is %s, want 12pt", i, g)
+		}
+	}
+	if _, ok := Tail(vl.List).(*HList); !ok {
+		t.Errorf("list ends with %T, want the last line", Tail(vl.List))
+	}
+}
+
+// baselines returns the baseline positions of the HLists in the list,
+// measured from the top.
+func baselines(n Node) []bag.ScaledPoint {
+	var ret []bag.ScaledPoint
+	var y bag.ScaledPoint
+	for ; n != nil; n = n.Next() {
+		if hl, ok := n.(*HList); ok {
+			ret = append(ret, y+hl.Height)
+		}
+		y += verticalSize(n)
+	}
+	return ret
+}
+
+// TestVListBuilderGrid puts lines on a 12pt grid starting at 10pt. A 15pt
+// image between the lines is padded, so the following line lands on the
+// grid again.
+func TestVListBuilderGrid(t *testing.T) {
+	vb := NewVListBuilder(12 * bag.Factor)
+	vb.Grid = &BaselineGrid{Pitch: 12 * bag.Factor, Origin: 10 * bag.Factor}
+	vb.GridOffset = 3 * bag.Factor
+	vb.Append(boxWithDepth(8*bag.Factor, 2*bag.Factor))
+	img := NewImage()
+	img.Height = 15 * bag.Factor
+	vb.Append(img)
+	vb.Append(boxWithDepth(8*bag.Factor, 2*bag.Factor))
+	vb.Append(boxWithDepth(9*bag.Factor, 2*bag.Factor))
+	for i, bl := range baselines(vb.List()) {
+		pos := bl + vb.GridOffset
+		if (pos-vb.Grid.Origin)%vb.Grid.Pitch != 0 {
+			t.Errorf("baseline %d at %s is not on the grid", i, pos)
+		}
+	}
+	want := []bag.ScaledPoint{19, 55, 67}
+	for i, bl := range baselines(vb.List()) {
+		if bl != want[i]*bag.Factor {
+			t.Errorf("baseline %d at %s, want %dpt", i, bl, want[i])
+		}
+	}
+}
+
+func TestBaselineGridNext(t *testing.T) {
+	bg := &BaselineGrid{Pitch: 12 * bag.Factor, Origin: 10 * bag.Factor}
+	data := []struct {
+		pos, want bag.ScaledPoint
+	}{
+		{0, 10 * bag.Factor},
+		{10 * bag.Factor, 10 * bag.Factor},
+		{10*bag.Factor + 1, 22 * bag.Factor},
+		{34 * bag.Factor, 34 * bag.Factor},
+	}
+	for _, d := range data {
+		if got := bg.Next(d.pos); got != d.want {
+			t.Errorf("Next(%s) = %s, want %s", d.pos, got, d.want)
+		}
+	}
+}
+
+// TestLinebreakGrid snaps the lines of a paragraph with a 13pt line height
+// to a 12pt grid, so every baseline moves to the next multiple of 12pt.
+func TestLinebreakGrid(t *testing.T) {
+	settings := NewLinebreakSettings()
+	settings.HSize = 200 * bag.Factor
+	settings.LineHeight = 13 * bag.Factor
+	settings.Grid = &BaselineGrid{Pitch: 12 * bag.Factor}
+	vl, _ := Linebreak(fourLineParagraph(), settings)
+	bls := baselines(vl.List)
+	if len(bls) != 4 {
+		t.Fatalf("got %d lines, want 4", len(bls))
+	}
+	for i, bl := range bls {
+		if want := bag.ScaledPoint(24*i) * bag.Factor; bl != want {
+			t.Errorf("baseline %d at %s, want %s", i, bl, want)
+		}
+	}
+}
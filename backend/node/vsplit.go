@@ -0,0 +1,241 @@
+package node
+
+import (
+	"math"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// Vsplit splits the vertical list vl like TeX's \vsplit. The first part is
+// the material up to the best breakpoint that fits into height, the rest
+// is everything after the breakpoint. The best breakpoint is the one with
+// the least badness plus penalty, on a tie the later one wins. Legal
+// breakpoints are the same as in Pagebreak. Glue, kerns and penalties at the
+// split are discarded. The first part is packed to height, the rest to its
+// natural height. If nothing fits, vl is
+// split at the first legal breakpoint. rest is nil if all of vl fits into
+// height.
+//
+// Tables built by the frontend (VLists with the origin "table") can be
+// split between any two rows, except before a row with the attribute
+// _inRowspan, which continues a cell that spans rows. The header and footer
+// rows (the attributes _headerCount and _footerCount) are repeated at the
+// top of the rest and at the bottom of the first part.
+func Vsplit(vl *VList, height bag.ScaledPoint) (first, rest *VList) {
+	if vl == nil || vl.List == nil {
+		return vl, nil
+	}
+	var items []Node
+	for e := vl.List; e != nil; e = e.Next() {
+		items = append(items, e)
+	}
+	headerCount, _ := vl.Attributes["_headerCount"].(int)
+	footerCount, _ := vl.Attributes["_footerCount"].(int)
+	isTable := IsTable(vl)
+	if !isTable {
+		b := vsplitPosition(items, height, false)
+		if onlyDiscardable(items[b:]) {
+			return vl, nil
+		}
+		first, rest = splitItems(items, b)
+		first = VpackTo(first.List, height)
+		copyVsplitAttributes(vl, first, rest)
+		return first, rest
+	}
+	if headerCount+footerCount >= len(items) {
+		return vl, nil
+	}
+	headers := items[:headerCount]
+	footers := items[len(items)-footerCount:]
+	body := items[headerCount : len(items)-footerCount]
+	var repeated bag.ScaledPoint
+	for _, itm := range headers {
+		repeated += verticalSize(itm)
+	}
+	for _, itm := range footers {
+		repeated += verticalSize(itm)
+	}
+	b := vsplitPosition(body, height-repeated, true)
+	if onlyDiscardable(body[b:]) {
+		return vl, nil
+	}
+	for _, itm := range append(headers[:len(headers):len(headers)], footers...) {
+		itm.SetPrev(nil)
+		itm.SetNext(nil)
+	}
+	body[0].SetPrev(nil)
+	body[len(body)-1].SetNext(nil)
+	firstBody, restBody := splitItems(body, b)
+	var firstItems, restItems []Node
+	firstItems = append(firstItems, headers...)
+	firstItems = appendList(firstItems, firstBody.List)
+	firstItems = append(firstItems, repeatRows(vl, "_buildFooters", footers)...)
+	restItems = append(restItems, repeatRows(vl, "_buildHeaders", headers)...)
+	restItems = appendList(restItems, restBody.List)
+	restItems = append(restItems, footers...)
+	first, rest = VpackTo(linkItems(firstItems), height), Vpack(linkItems(restItems))
+	copyVsplitAttributes(vl, first, rest)
+	return first, rest
+}
+
+// IsTable reports whether vl is a table built by the frontend. The rows of
+// a table are adjacent boxes without glue, Vsplit may break between any
+// two of them.
+func IsTable(vl *VList) bool {
+	if vl == nil {
+		return false
+	}
+	if vl.Attributes["origin"] == "table" {
+		return true
+	}
+	headerCount, _ := vl.Attributes["_headerCount"].(int)
+	footerCount, _ := vl.Attributes["_footerCount"].(int)
+	return headerCount > 0 || footerCount > 0
+}
+
+// vsplitPosition returns the index of the best breakpoint in items for a
+// first part of the given height. len(items) means that everything fits.
+// If boxBreaks is true, the list can be broken between two boxes.
+func vsplitPosition(items []Node, height bag.ScaledPoint, boxBreaks bool) int {
+	pb := &pagebreaker{items: items}
+	var s vsums
+	best, leastCost := -1, math.MaxInt
+	for b := 0; b <= len(items); b++ {
+		penalty, ok := 0, false
+		switch {
+		case b == len(items):
+			penalty, ok = -10000, true
+		case boxBreaks && b > 0 && isVerticalBox(items[b]) && isVerticalBox(items[b-1]):
+			ok = !inRowspan(items[b])
+		default:
+			penalty, ok = pb.isPagebreakCandidate(b)
+		}
+		if ok && b > 0 {
+			_, badness, overfull := verticalBadness(s, height)
+			if overfull {
+				if best < 0 {
+					best = b
+				}
+				break
+			}
+			cost := 100000
+			switch {
+			case penalty <= -10000:
+				cost = penalty
+			case badness < 10000:
+				cost = badness + penalty
+			}
+			if cost <= leastCost {
+				best, leastCost = b, cost
+			}
+			if penalty <= -10000 {
+				break
+			}
+		}
+		if b < len(items) {
+			if g, ok := items[b].(*Glue); ok {
+				s.stretch[g.StretchOrder] += g.Stretch
+				s.shrink += g.Shrink
+			}
+			s.height += verticalSize(items[b])
+		}
+	}
+	if best < 0 {
+		best = len(items)
+	}
+	return best
+}
+
+// inRowspan reports whether n is a table row that continues a cell of an
+// earlier row.
+func inRowspan(n Node) bool {
+	hl, ok := n.(*HList)
+	return ok && hl.Attributes["_inRowspan"] == true
+}
+
+// onlyDiscardable reports whether items contains nothing but glue, kerns and
+// penalties.
+func onlyDiscardable(items []Node) bool {
+	for _, itm := range items {
+		if !isDiscardable(itm) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitItems splits the linked items before index b (b > 0). Discardable
+// items at the split are removed. rest is nil if there is no material after
+// the split.
+func splitItems(items []Node, b int) (first, rest *VList) {
+	start := b
+	for start < len(items) && isDiscardable(items[start]) {
+		start++
+	}
+	items[b-1].SetNext(nil)
+	items[0].SetPrev(nil)
+	first = Vpack(items[0])
+	if start < len(items) {
+		items[start].SetPrev(nil)
+		rest = Vpack(items[start])
+	}
+	return first, rest
+}
+
+// repeatRows returns new copies of the table rows built by the function
+// stored in the attribute key of vl. If there is no such function or it
+// fails, the rows are copied.
+func repeatRows(vl *VList, key string, rows []Node) []Node {
+	var ret []Node
+	if f, ok := vl.Attributes[key].(func() ([]*HList, error)); ok {
+		if hls, err := f(); err == nil && len(hls) == len(rows) {
+			for _, hl := range hls {
+				ret = append(ret, hl)
+			}
+			return ret
+		}
+	}
+	for _, r := range rows {
+		ret = append(ret, r.Copy())
+	}
+	return ret
+}
+
+// appendList appends the nodes of the linked list starting at n to items.
+func appendList(items []Node, n Node) []Node {
+	for n != nil {
+		next := n.Next()
+		n.SetPrev(nil)
+		n.SetNext(nil)
+		items = append(items, n)
+		n = next
+	}
+	return items
+}
+
+// linkItems links the (unlinked) items and returns the head of the list.
+func linkItems(items []Node) Node {
+	var head Node
+	for i, itm := range items {
+		if i == 0 {
+			head = itm
+			continue
+		}
+		InsertAfter(head, items[i-1], itm)
+	}
+	return head
+}
+
+// copyVsplitAttributes copies the attributes of vl to both parts of the
+// split.
+func copyVsplitAttributes(vl, first, rest *VList) {
+	for _, part := range []*VList{first, rest} {
+		if part == nil || vl.Attributes == nil {
+			continue
+		}
+		part.Attributes = H{}
+		for k, v := range vl.Attributes {
+			part.Attributes[k] = v
+		}
+	}
+}
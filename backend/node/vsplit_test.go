@@ -0,0 +1,163 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+)
+
+// TestVsplit takes the first 40pt of ten lines (10pt lines, 2pt glue). Three
+// lines (34pt) fit, the fourth line would need 46pt.
+func TestVsplit(t *testing.T) {
+	first, rest := Vsplit(buildLines(10, 0), 40*bag.Factor)
+	if got, want := countHLists(first), 3; got != want {
+		t.Errorf("first part has %d lines, want %d", got, want)
+	}
+	if got, want := countHLists(rest), 7; got != want {
+		t.Errorf("rest has %d lines, want %d", got, want)
+	}
+	if _, ok := rest.List.(*HList); !ok {
+		t.Errorf("rest starts with %T, want *HList", rest.List)
+	}
+	if _, ok := Tail(first.List).(*HList); !ok {
+		t.Errorf("first part ends with %T, want *HList", Tail(first.List))
+	}
+	if got, want := first.Height, bag.ScaledPoint(40*bag.Factor); got != want {
+		t.Errorf("first part is %s high, want %s", got, want)
+	}
+
+	vl := buildLines(2, 0)
+	if first, rest = Vsplit(vl, 40*bag.Factor); first != vl || rest != nil {
+		t.Errorf("Vsplit of a list that fits returns (%v, %v), want (vl, nil)", first, rest)
+	}
+}
+
+// TestVsplitPenalty checks that a penalty of 10000 keeps lines together and
+// that a negative penalty is preferred over a fuller first part.
+func TestVsplitPenalty(t *testing.T) {
+	vl := buildLines(5, 0)
+	third := vl.List.Next().Next().Next().Next()
+	keep := NewPenalty()
+	keep.Penalty = 10000
+	InsertAfter(vl.List, third, keep)
+	first, _ := Vsplit(vl, 40*bag.Factor)
+	if got, want := countHLists(first), 2; got != want {
+		t.Errorf("first part has %d lines, want %d", got, want)
+	}
+
+	vl = buildLines(5, 0)
+	second := vl.List.Next().Next()
+	p := NewPenalty()
+	p.Penalty = -10000
+	InsertAfter(vl.List, second, p)
+	first, rest := Vsplit(vl, 40*bag.Factor)
+	if got, want := countHLists(first), 2; got != want {
+		t.Errorf("first part has %d lines, want %d", got, want)
+	}
+	if got, want := countHLists(rest), 3; got != want {
+		t.Errorf("rest has %d lines, want %d", got, want)
+	}
+}
+
+// TestVsplitTable splits a table with one header and one footer row and
+// six body rows of 10pt on 50pt. Three body rows fit next to header and
+// footer.
+func TestVsplitTable(t *testing.T) {
+	var head, cur Node
+	for range 8 {
+		hl := lineBox(10 * bag.Factor)
+		head = InsertAfter(head, cur, hl)
+		cur = hl
+	}
+	vl := Vpack(head)
+	header, footer := vl.List.(*HList), Tail(vl.List).(*HList)
+	builds := 0
+	vl.Attributes = H{
+		"origin":       "table",
+		"_headerCount": 1,
+		"_footerCount": 1,
+		"_buildHeaders": func() ([]*HList, error) {
+			builds++
+			return []*HList{lineBox(10 * bag.Factor)}, nil
+		},
+	}
+	first, rest := Vsplit(vl, 50*bag.Factor)
+	if got, want := countHLists(first), 5; got != want {
+		t.Errorf("first part has %d rows, want %d", got, want)
+	}
+	if got, want := countHLists(rest), 5; got != want {
+		t.Errorf("rest has %d rows, want %d", got, want)
+	}
+	if first.List != header {
+		t.Error("first part does not start with the header")
+	}
+	if Tail(rest.List) != footer {
+		t.Error("rest does not end with the footer")
+	}
+	if builds != 1 {
+		t.Errorf("header built %d times, want 1", builds)
+	}
+	if rest.Attributes["_headerCount"] != 1 {
+		t.Error("rest lost the table attributes")
+	}
+	if first.Height != 50*bag.Factor {
+		t.Errorf("first part is %s high, want 50pt", first.Height)
+	}
+}
+
+// TestVsplitTableWithoutHeader splits a table of eight 10pt rows without
+// header or footer rows on 50pt. The rows have no glue between them, yet the
+// table breaks after the fifth row.
+func TestVsplitTableWithoutHeader(t *testing.T) {
+	var head, cur Node
+	for range 8 {
+		hl := lineBox(10 * bag.Factor)
+		head = InsertAfter(head, cur, hl)
+		cur = hl
+	}
+	vl := Vpack(head)
+	vl.Attributes = H{"origin": "table"}
+	first, rest := Vsplit(vl, 50*bag.Factor)
+	if rest == nil {
+		t.Fatal("table was not split")
+	}
+	if got, want := countHLists(first), 5; got != want {
+		t.Errorf("first part has %d rows, want %d", got, want)
+	}
+	if got, want := countHLists(rest), 3; got != want {
+		t.Errorf("rest has %d rows, want %d", got, want)
+	}
+	if !IsTable(rest) {
+		t.Error("rest is not a table")
+	}
+}
+
+// TestVsplitTableRowspan splits a table of eight 10pt rows on 50pt. The
+// fifth and sixth row continue a cell of the fourth row, so the table breaks
+// after the third row.
+func TestVsplitTableRowspan(t *testing.T) {
+	var head, cur Node
+	for i := range 8 {
+		hl := lineBox(10 * bag.Factor)
+		if i == 4 || i == 5 {
+			hl.Attributes = H{"_inRowspan": true}
+		}
+		head = InsertAfter(head, cur, hl)
+		cur = hl
+	}
+	vl := Vpack(head)
+	vl.Attributes = H{"origin": "table"}
+	first, rest := Vsplit(vl, 50*bag.Factor)
+	if rest == nil {
+		t.Fatal("table was not split")
+	}
+	if got, want := countHLists(first), 3; got != want {
+		t.Errorf("first part has %d rows, want %d", got, want)
+	}
+	if got, want := countHLists(rest), 5; got != want {
+		t.Errorf("rest has %d rows, want %d", got, want)
+	}
+	if first.Height != 50*bag.Factor {
+		t.Errorf("first part is %s high, want 50pt", first.Height)
+	}
+}
@@ -0,0 +1,158 @@
+//go:build ignore
+
+// gen.go creates tables.go from the files LineBreak.txt, EastAsianWidth.txt
+// and emoji-data.txt of the Unicode Character Database:
+//
+//	go run gen.go -ucd path/to/ucd -version 14.0.0
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type rng struct {
+	lo, hi rune
+	val    string
+}
+
+// readUCD reads a file with lines of the form "XXXX..YYYY ; value # comment".
+// If withCategory is true, the general category from the comment is
+// appended to the value with a slash.
+func readUCD(filename string, withCategory bool) []rng {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	var ret []rng
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, comment, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		cps := strings.Split(strings.TrimSpace(fields[0]), "..")
+		lo, err := strconv.ParseUint(cps[0], 16, 32)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hi := lo
+		if len(cps) > 1 {
+			if hi, err = strconv.ParseUint(cps[1], 16, 32); err != nil {
+				log.Fatal(err)
+			}
+		}
+		val := strings.TrimSpace(fields[1])
+		if withCategory {
+			gc, _, _ := strings.Cut(strings.TrimSpace(comment), " ")
+			val += "/" + gc
+		}
+		ret = append(ret, rng{rune(lo), rune(hi), val})
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return ret
+}
+
+// merge joins adjacent ranges with the same value.
+func merge(ranges []rng) []rng {
+	var ret []rng
+	for _, r := range ranges {
+		if n := len(ret); n > 0 && ret[n-1].hi+1 == r.lo && ret[n-1].val == r.val {
+			ret[n-1].hi = r.hi
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+func contains(ranges []rng, r rune) (string, bool) {
+	for _, rg := range ranges {
+		if rg.lo <= r && r <= rg.hi {
+			return rg.val, true
+		}
+	}
+	return "", false
+}
+
+func main() {
+	ucd := flag.String("ucd", ".", "directory with the UCD files")
+	version := flag.String("version", "", "Unicode version of the UCD files")
+	flag.Parse()
+
+	lb := readUCD(filepath.Join(*ucd, "LineBreak.txt"), true)
+	ea := readUCD(filepath.Join(*ucd, "EastAsianWidth.txt"), false)
+	var extPict []rng
+	for _, r := range readUCD(filepath.Join(*ucd, "emoji-data.txt"), false) {
+		if r.val == "Extended_Pictographic" {
+			extPict = append(extPict, r)
+		}
+	}
+
+	var classes, unassignedPict []rng
+	var wideBrackets []rune
+	for _, r := range lb {
+		class, gc, _ := strings.Cut(r.val, "/")
+		classes = append(classes, rng{r.lo, r.hi, class})
+		for cp := r.lo; cp <= r.hi; cp++ {
+			if class == "OP" || class == "CP" {
+				if w, _ := contains(ea, cp); w == "F" || w == "W" || w == "H" {
+					wideBrackets = append(wideBrackets, cp)
+				}
+			}
+			if _, ok := contains(extPict, cp); ok && gc == "Cn" {
+				unassignedPict = append(unassignedPict, rng{cp, cp, ""})
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gen.go from the Unicode Character Database %s. DO NOT EDIT.\n\n", *version)
+	fmt.Fprintf(&b, "package linebreak\n\n")
+	fmt.Fprintf(&b, "// UnicodeVersion is the Unicode version of the line break tables.\n")
+	fmt.Fprintf(&b, "const UnicodeVersion = %q\n\n", *version)
+	fmt.Fprintf(&b, "// classRanges holds the Line_Break property values. Code points that are\n")
+	fmt.Fprintf(&b, "// not in the table have the class XX.\n")
+	fmt.Fprintf(&b, "var classRanges = []classRange{\n")
+	for _, r := range merge(classes) {
+		if r.val == "XX" {
+			continue
+		}
+		fmt.Fprintf(&b, "{0x%04X, 0x%04X, %s},\n", r.lo, r.hi, r.val)
+	}
+	fmt.Fprintf(&b, "}\n\n")
+	fmt.Fprintf(&b, "// wideBrackets are the characters of class OP and CP with the East Asian\n")
+	fmt.Fprintf(&b, "// width F, W or H (rule LB30).\n")
+	fmt.Fprintf(&b, "var wideBrackets = []rune{\n")
+	for _, r := range wideBrackets {
+		fmt.Fprintf(&b, "0x%04X,\n", r)
+	}
+	fmt.Fprintf(&b, "}\n\n")
+	fmt.Fprintf(&b, "// unassignedPictographic are the unassigned code points with the property\n")
+	fmt.Fprintf(&b, "// Extended_Pictographic (rule LB30b).\n")
+	fmt.Fprintf(&b, "var unassignedPictographic = []classRange{\n")
+	for _, r := range merge(unassignedPict) {
+		fmt.Fprintf(&b, "{0x%04X, 0x%04X, ID},\n", r.lo, r.hi)
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("tables.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,273 @@
+// Package linebreak implements the Unicode Line Breaking Algorithm.
+//
+// See https://www.unicode.org/reports/tr14. The package implements the
+// default rules LB1 to LB31 without tailoring, with the simple form of rule
+// LB25 for numbers.
+package linebreak
+
+import (
+	"sort"
+	"unicode"
+)
+
+// Class is a value of the Unicode Line_Break property.
+type Class uint8
+
+// The line breaking classes of UAX #14.
+const (
+	XX  Class = iota // Unknown
+	AI               // Ambiguous (Alphabetic or Ideographic)
+	AL               // Alphabetic
+	B2               // Break Opportunity Before and After
+	BA               // Break After
+	BB               // Break Before
+	BK               // Mandatory Break
+	CB               // Contingent Break Opportunity
+	CJ               // Conditional Japanese Starter
+	CL               // Close Punctuation
+	CM               // Combining Mark
+	CP               // Close Parenthesis
+	CR               // Carriage Return
+	EB               // Emoji Base
+	EM               // Emoji Modifier
+	EX               // Exclamation/Interrogation
+	GL               // Non-breaking ("Glue")
+	H2               // Hangul LV Syllable
+	H3               // Hangul LVT Syllable
+	HL               // Hebrew Letter
+	HY               // Hyphen
+	ID               // Ideographic
+	IN               // Inseparable
+	IS               // Infix Numeric Separator
+	JL               // Hangul L Jamo
+	JT               // Hangul T Jamo
+	JV               // Hangul V Jamo
+	LF               // Line Feed
+	NL               // Next Line
+	NS               // Nonstarter
+	NU               // Numeric
+	OP               // Open Punctuation
+	PO               // Postfix Numeric
+	PR               // Prefix Numeric
+	QU               // Quotation
+	RI               // Regional Indicator
+	SA               // Complex Context Dependent (South East Asian)
+	SG               // Surrogate
+	SP               // Space
+	SY               // Symbols Allowing Break After
+	WJ               // Word Joiner
+	ZW               // Zero Width Space
+	ZWJ              // Zero Width Joiner
+)
+
+var classNames = [...]string{"XX", "AI", "AL", "B2", "BA", "BB", "BK", "CB", "CJ", "CL", "CM", "CP", "CR", "EB", "EM", "EX", "GL", "H2", "H3", "HL", "HY", "ID", "IN", "IS", "JL", "JT", "JV", "LF", "NL", "NS", "NU", "OP", "PO", "PR", "QU", "RI", "SA", "SG", "SP", "SY", "WJ", "ZW", "ZWJ"}
+
+func (c Class) String() string {
+	if int(c) < len(classNames) {
+		return classNames[c]
+	}
+	return "XX"
+}
+
+type classRange struct {
+	lo, hi rune
+	class  Class
+}
+
+func lookup(ranges []classRange, r rune) (Class, bool) {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].hi >= r })
+	if i < len(ranges) && ranges[i].lo <= r {
+		return ranges[i].class, true
+	}
+	return XX, false
+}
+
+// LookupClass returns the Line_Break property of r.
+func LookupClass(r rune) Class {
+	c, _ := lookup(classRanges, r)
+	return c
+}
+
+// Break is the kind of a line break opportunity.
+type Break uint8
+
+const (
+	// NoBreak means that the line must not be broken.
+	NoBreak Break = iota
+	// Allowed is a line break opportunity.
+	Allowed
+	// Mandatory is a forced line break, for example after a newline.
+	Mandatory
+)
+
+func (b Break) String() string {
+	switch b {
+	case NoBreak:
+		return "×"
+	case Allowed:
+		return "÷"
+	}
+	return "!"
+}
+
+// resolve implements rule LB1 with the default mapping of the classes that
+// need tailoring.
+func resolve(r rune) Class {
+	switch c := LookupClass(r); c {
+	case AI, SG, XX:
+		return AL
+	case SA:
+		if unicode.In(r, unicode.Mn, unicode.Mc) {
+			return CM
+		}
+		return AL
+	case CJ:
+		return NS
+	default:
+		return c
+	}
+}
+
+func isWideBracket(r rune) bool {
+	i := sort.Search(len(wideBrackets), func(i int) bool { return wideBrackets[i] >= r })
+	return i < len(wideBrackets) && wideBrackets[i] == r
+}
+
+func isUnassignedPictographic(r rune) bool {
+	_, ok := lookup(unassignedPictographic, r)
+	return ok
+}
+
+func in(c Class, classes ...Class) bool {
+	for _, x := range classes {
+		if c == x {
+			return true
+		}
+	}
+	return false
+}
+
+// Breaks returns the line break opportunities of text. Element i is the
+// opportunity between text[i] and text[i+1]; the last element is the end of
+// the text, which is always Mandatory (LB3).
+func Breaks(text []rune) []Break {
+	n := len(text)
+	ret := make([]Break, n)
+	if n == 0 {
+		return ret
+	}
+	ret[n-1] = Mandatory
+	// cls holds the class of each character after LB9 and LB10. A combining
+	// mark gets the class of its base, base holds the index of the base.
+	cls := make([]Class, n)
+	base := make([]int, n)
+	attached := make([]bool, n)
+	for i, r := range text {
+		cls[i] = resolve(r)
+		base[i] = i
+		if cls[i] == CM || cls[i] == ZWJ {
+			if i > 0 && !in(cls[i-1], BK, CR, LF, NL, SP, ZW) {
+				cls[i] = cls[i-1]
+				base[i] = base[i-1]
+				attached[i] = true
+			} else {
+				cls[i] = AL
+			}
+		}
+	}
+	// spBase is the class before the spaces that precede the current
+	// position, ri the number of regional indicators before it.
+	spBase := cls[0]
+	ri := 0
+	if cls[0] == RI {
+		ri = 1
+	}
+	for i := 1; i < n; i++ {
+		raw := resolve(text[i-1])
+		a, b := cls[i-1], cls[i]
+		if a != SP {
+			spBase = a
+		}
+		ret[i-1] = pair(text, base, raw, a, b, spBase, ri, attached[i], cls, i)
+		if b == RI && !attached[i] {
+			ri++
+		} else if b != RI {
+			ri = 0
+		}
+	}
+	return ret
+}
+
+// pair returns the break opportunity between text[i-1] (class a, class
+// before LB9 raw) and text[i] (class b).
+func pair(text []rune, base []int, raw, a, b, spBase Class, ri int, attached bool, cls []Class, i int) Break {
+	switch {
+	case raw == BK: // LB4
+		return Mandatory
+	case raw == CR && b == LF: // LB5
+		return NoBreak
+	case raw == CR, raw == LF, raw == NL:
+		return Mandatory
+	case in(b, BK, CR, LF, NL), b == SP, b == ZW: // LB6, LB7
+		return NoBreak
+	case spBase == ZW && (a == SP || a == ZW): // LB8
+		return Allowed
+	case raw == ZWJ: // LB8a
+		return NoBreak
+	case attached: // LB9
+		return NoBreak
+	case a == WJ, b == WJ: // LB11
+		return NoBreak
+	case a == GL: // LB12
+		return NoBreak
+	case b == GL && !in(a, SP, BA, HY): // LB12a
+		return NoBreak
+	case in(b, CL, CP, EX, IS, SY): // LB13
+		return NoBreak
+	case spBase == OP: // LB14
+		return NoBreak
+	case spBase == QU && b == OP: // LB15
+		return NoBreak
+	case in(spBase, CL, CP) && b == NS: // LB16
+		return NoBreak
+	case spBase == B2 && b == B2: // LB17
+		return NoBreak
+	case a == SP: // LB18
+		return Allowed
+	case a == QU, b == QU: // LB19
+		return NoBreak
+	case a == CB, b == CB: // LB20
+		return Allowed
+	case in(b, BA, HY, NS), a == BB: // LB21
+		return NoBreak
+	case in(a, HY, BA) && base[i-1] > 0 && cls[base[i-1]-1] == HL: // LB21a
+		return NoBreak
+	case a == SY && b == HL: // LB21b
+		return NoBreak
+	case b == IN: // LB22
+		return NoBreak
+	case in(a, AL, HL) && b == NU, a == NU && in(b, AL, HL): // LB23
+		return NoBreak
+	case a == PR && in(b, ID, EB, EM), in(a, ID, EB, EM) && b == PO: // LB23a
+		return NoBreak
+	case in(a, PR, PO) && in(b, AL, HL), in(a, AL, HL) && in(b, PR, PO): // LB24
+		return NoBreak
+	case in(a, CL, CP, NU) && in(b, PO, PR), in(a, PO, PR) && in(b, OP, NU), in(a, HY, IS, NU, SY) && b == NU: // LB25
+		return NoBreak
+	case a == JL && in(b, JL, JV, H2, H3), in(a, JV, H2) && in(b, JV, JT), in(a, JT, H3) && b == JT: // LB26
+		return NoBreak
+	case in(a, JL, JV, JT, H2, H3) && b == PO, a == PR && in(b, JL, JV, JT, H2, H3): // LB27
+		return NoBreak
+	case in(a, AL, HL) && in(b, AL, HL): // LB28
+		return NoBreak
+	case a == IS && in(b, AL, HL): // LB29
+		return NoBreak
+	case in(a, AL, HL, NU) && b == OP && !isWideBracket(text[i]), a == CP && !isWideBracket(text[base[i-1]]) && in(b, AL, HL, NU): // LB30
+		return NoBreak
+	case a == RI && b == RI && ri%2 == 1: // LB30a
+		return NoBreak
+	case b == EM && (a == EB || isUnassignedPictographic(text[base[i-1]])): // LB30b
+		return NoBreak
+	}
+	return Allowed // LB31
+}
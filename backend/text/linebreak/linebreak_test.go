@@ -0,0 +1,92 @@
+package linebreak
+
+import (
+	"strings"
+	"testing"
+)
+
+// format returns text with the opportunities marked: ÷ for a break, ! for
+// a mandatory break. The mandatory break at the end of the text is left out.
+func format(text string) string {
+	runes := []rune(text)
+	breaks := Breaks(runes)
+	var b strings.Builder
+	for i, r := range runes {
+		b.WriteRune(r)
+		if i < len(runes)-1 && breaks[i] != NoBreak {
+			b.WriteString(breaks[i].String())
+		}
+	}
+	return b.String()
+}
+
+func TestBreaks(t *testing.T) {
+	testdata := []struct {
+		text string
+		want string
+	}{
+		{"Hello world", "Hello ÷world"},
+		{"Hello  world", "Hello  ÷world"},
+		{"well-known", "well-÷known"},
+		{"(a) [b]", "(a) ÷[b]"},
+		{"( a", "( a"},
+		{"word !", "word !"},
+		{"Preis: $100.50 (10 %)", "Preis: ÷$100.50 ÷(10 ÷%)"},
+		{"漢字かな", "漢÷字÷か÷な"},
+		{"漢。「字」", "漢。÷「字」"},
+		{"ab\u200Bcd", "ab\u200B÷cd"},
+		{"a\r\nb", "a\r\n!b"},
+		{"a\nb", "a\n!b"},
+		{"éx y", "éx ÷y"},
+		{"http://x.org/a", "http://÷x.org/÷a"},
+		{"a—b——c", "a÷—÷b÷——÷c"},
+		{"🇩🇪🇫🇷", "🇩🇪÷🇫🇷"},
+		{"👍🏽x", "👍🏽÷x"},
+		{"\"a\" b", "\"a\" ÷b"},
+		{"a\u00A0b", "a\u00A0b"},
+		{"a\u2060b c", "a\u2060b ÷c"},
+		{"한국어", "한÷국÷어"},
+	}
+	for _, td := range testdata {
+		if got := format(td.text); got != td.want {
+			t.Errorf("Breaks(%q) = %q, want %q", td.text, got, td.want)
+		}
+	}
+}
+
+func TestBreaksEnd(t *testing.T) {
+	if got := Breaks(nil); len(got) != 0 {
+		t.Errorf("len(Breaks(nil)) = %d, want 0", len(got))
+	}
+	if got := Breaks([]rune("ab")); got[1] != Mandatory {
+		t.Errorf("the end of the text is %s, want !", got[1])
+	}
+}
+
+func TestLookupClass(t *testing.T) {
+	testdata := []struct {
+		r    rune
+		want Class
+	}{
+		{'a', AL},
+		{' ', SP},
+		{'(', OP},
+		{')', CP},
+		{'0', NU},
+		{'-', HY},
+		{'漢', ID},
+		{'ぁ', CJ},
+		{'。', CL},
+		{'\u200B', ZW},
+		{'\u00A0', GL},
+		{'\u0301', CM},
+		{'א', HL},
+		{0xE0020, CM},
+		{0x10FFFF, XX},
+	}
+	for _, td := range testdata {
+		if got := LookupClass(td.r); got != td.want {
+			t.Errorf("LookupClass(%U) = %s, want %s", td.r, got, td.want)
+		}
+	}
+}
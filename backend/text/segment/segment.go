@@ -0,0 +1,140 @@
+// Package segment finds the word boundaries in text that is written without
+// spaces between the words, such as Thai, Lao, Khmer and Burmese.
+//
+// The segmentation uses maximal matching: of all the ways to split the text
+// into words of a dictionary, the one with the fewest characters that are
+// not in the dictionary and then the fewest words wins.
+package segment
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// trie is a node of the prefix tree of the dictionary words.
+type trie struct {
+	children map[rune]*trie
+	word     bool
+}
+
+// Dictionary is a word list for the segmentation.
+type Dictionary struct {
+	root  trie
+	Words int
+}
+
+// LoadDictionaryFile loads the word list with the given file name.
+func LoadDictionaryFile(fn string) (*Dictionary, error) {
+	r, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewFromReader(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	if err = r.Close(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// NewFromReader returns a Dictionary with the words read from r. The words
+// are separated by line breaks. Empty lines and lines that start with # are
+// ignored.
+func NewFromReader(r io.Reader) (*Dictionary, error) {
+	d := &Dictionary{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		word := strings.TrimSpace(sc.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		d.Add(word)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Add adds the word to the dictionary.
+func (d *Dictionary) Add(word string) {
+	t := &d.root
+	for _, r := range word {
+		next, ok := t.children[r]
+		if !ok {
+			if t.children == nil {
+				t.children = make(map[rune]*trie)
+			}
+			next = &trie{}
+			t.children[r] = next
+		}
+		t = next
+	}
+	if !t.word {
+		t.word = true
+		d.Words++
+	}
+}
+
+// step is the best segmentation of the text up to a position.
+type step struct {
+	unknown, words int
+	// prev is the start of the last segment, known is true if the
+	// segment is a dictionary word.
+	prev    int
+	known   bool
+	reached bool
+}
+
+func (s step) better(unknown, words int) bool {
+	return !s.reached || unknown < s.unknown || unknown == s.unknown && words < s.words
+}
+
+// Segment returns the positions in text where a word starts, except the
+// position 0. Characters that are not part of a dictionary word form one
+// segment together with their unknown neighbours, so text in other scripts
+// is not split.
+func (d *Dictionary) Segment(text []rune) []int {
+	n := len(text)
+	best := make([]step, n+1)
+	best[0].reached = true
+	relax := func(from, to int, known bool) {
+		unknown, words := best[from].unknown, best[from].words+1
+		if !known {
+			unknown++
+		}
+		if best[to].better(unknown, words) {
+			best[to] = step{unknown: unknown, words: words, prev: from, known: known, reached: true}
+		}
+	}
+	for i := 0; i < n; i++ {
+		t := &d.root
+		for j := i; j < n; j++ {
+			if t = t.children[text[j]]; t == nil {
+				break
+			}
+			if t.word {
+				relax(i, j+1, true)
+			}
+		}
+		relax(i, i+1, false)
+	}
+	var starts []int
+	for pos := n; pos > 0; {
+		s := best[pos]
+		// Unknown characters stay together.
+		if s.prev > 0 && (s.known || best[s.prev].known) {
+			starts = append(starts, s.prev)
+		}
+		pos = s.prev
+	}
+	for i, j := 0, len(starts)-1; i < j; i, j = i+1, j-1 {
+		starts[i], starts[j] = starts[j], starts[i]
+	}
+	return starts
+}
@@ -0,0 +1,34 @@
+package segment
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSegment(t *testing.T) {
+	d, err := NewFromReader(strings.NewReader("# Thai\nภาษา\nภา\nษา\nไทย\n\nไท\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Words != 5 {
+		t.Errorf("got %d words, want 5", d.Words)
+	}
+	testdata := []struct {
+		text string
+		want []int
+	}{
+		// ภาษา|ไทย has fewer words than ภา|ษา|ไทย.
+		{"ภาษาไทย", []int{4}},
+		{"ภาษาไทยภาษา", []int{4, 7}},
+		// Unknown text is kept together.
+		{"ภาษาabcไทย", []int{4, 7}},
+		{"abc", nil},
+		{"", nil},
+	}
+	for _, td := range testdata {
+		if got := d.Segment([]rune(td.text)); !reflect.DeepEqual(got, td.want) {
+			t.Errorf("Segment(%q) = %v, want %v", td.text, got, td.want)
+		}
+	}
+}
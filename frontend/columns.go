@@ -0,0 +1,337 @@
+package frontend
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/color"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+)
+
+// ColumnSettings describes the layout of FlowColumns.
+type ColumnSettings struct {
+	// Columns is the number of columns.
+	Columns int
+	// Width is the width of all columns including the gutters.
+	Width bag.ScaledPoint
+	// Height is the height of the column area on each page.
+	Height bag.ScaledPoint
+	// Gutter is the distance between two columns.
+	Gutter bag.ScaledPoint
+	// RuleWidth is the width of the rule in the middle of the gutter. 0
+	// draws no rule.
+	RuleWidth bag.ScaledPoint
+	// RuleColor is the color of the column rule, nil is black.
+	RuleColor *color.Color
+	// Balance makes the columns equally high where the column material
+	// ends: on the last page and above a spanning element.
+	Balance bool
+}
+
+// ColumnWidth returns the width of a single column. The VLists passed to
+// FlowColumns should be formatted to this width.
+func (cs *ColumnSettings) ColumnWidth() bag.ScaledPoint {
+	if cs.Columns < 1 {
+		return cs.Width
+	}
+	return (cs.Width - bag.ScaledPoint(cs.Columns-1)*cs.Gutter) / bag.ScaledPoint(cs.Columns)
+}
+
+// SpanColumns marks vl as an element that spans all columns, such as a
+// heading. It should be formatted to the full width of the column area.
+func SpanColumns(vl *node.VList) *node.VList {
+	if vl.Attributes == nil {
+		vl.Attributes = node.H{}
+	}
+	vl.Attributes["_columnSpan"] = true
+	return vl
+}
+
+// isColumnSpan reports whether vl was marked with SpanColumns.
+func isColumnSpan(vl *node.VList) bool {
+	span, _ := vl.Attributes["_columnSpan"].(bool)
+	return span
+}
+
+// FlowColumns distributes the VLists into columns and returns one VList for
+// each page of the column area. The lines of consecutive VLists are split
+// between columns at the legal breakpoints of the vertical list (see
+// node.Vsplit), the VLists are separated by breakable glue. Tables are
+// split between their rows, with the header and footer rows repeated in
+// every column. VLists marked with SpanColumns interrupt the columns and
+// are placed across the full width. The nodes of the VLists are moved into
+// the pages.
+func FlowColumns(vls []*node.VList, cs *ColumnSettings) ([]*node.VList, error) {
+	if cs.Columns < 1 {
+		return nil, fmt.Errorf("FlowColumns: invalid number of columns %d", cs.Columns)
+	}
+	if cs.Height <= 0 {
+		return nil, fmt.Errorf("FlowColumns: the column height must be positive")
+	}
+	var pages []*node.VList
+	var head, tail node.Node
+	avail := cs.Height
+	add := func(n node.Node) {
+		head = node.InsertAfter(head, tail, n)
+		tail = n
+		_, ht, dp := n.Sizes(node.Vertical)
+		avail -= ht + dp
+	}
+	newPage := func() {
+		if head != nil {
+			vl := node.VpackTo(head, cs.Height)
+			vl.Width = cs.Width
+			vl.Attributes = node.H{"origin": "FlowColumns"}
+			pages = append(pages, vl)
+		}
+		head, tail, avail = nil, nil, cs.Height
+	}
+
+	for i := 0; i < len(vls); {
+		if isColumnSpan(vls[i]) {
+			if _, ht, dp := vls[i].Sizes(node.Vertical); ht+dp > avail && head != nil {
+				newPage()
+			}
+			add(vls[i])
+			i++
+			continue
+		}
+		var material node.Node
+		for ; i < len(vls) && !isColumnSpan(vls[i]); i++ {
+			material = appendColumnMaterial(material, vls[i])
+		}
+		if material == nil {
+			continue
+		}
+		vl := node.Vpack(material)
+		for vl != nil {
+			if head != nil && firstBoxHeight(vl) > avail {
+				newPage()
+			}
+			height := avail
+			if cs.Balance {
+				if ht, ok := balancedHeight(vl, cs.Columns, avail); ok {
+					height = ht
+				}
+			}
+			var cols []*node.VList
+			cols, vl = splitColumns(vl, cs.Columns, height)
+			add(columnRow(cols, cs))
+			if vl != nil {
+				newPage()
+			}
+		}
+	}
+	newPage()
+	return pages, nil
+}
+
+// appendColumnMaterial appends the items of vl to the list starting at
+// head, separated by glue, so the columns can be split between the two
+// lists. Tables are appended as a whole, splitColumn breaks them between
+// their rows.
+func appendColumnMaterial(head node.Node, vl *node.VList) node.Node {
+	if vl.List == nil {
+		return head
+	}
+	if head != nil {
+		g := node.NewGlue()
+		g.Attributes = node.H{"origin": "column material"}
+		head = node.InsertAfter(head, node.Tail(head), g)
+	}
+	if node.IsTable(vl) {
+		vl.SetPrev(nil)
+		vl.SetNext(nil)
+		return node.InsertAfter(head, node.Tail(head), vl)
+	}
+	list := vl.List
+	vl.List = nil
+	return node.InsertAfter(head, node.Tail(head), list)
+}
+
+// firstBoxHeight returns the height of the first box in vl. For a table it
+// is the height of the smallest part the table can be split into.
+func firstBoxHeight(vl *node.VList) bag.ScaledPoint {
+	for e := vl.List; e != nil; e = e.Next() {
+		if tbl, ok := e.(*node.VList); ok && node.IsTable(tbl) {
+			return minTableHeight(tbl)
+		}
+		switch e.(type) {
+		case *node.HList, *node.VList, *node.Rule, *node.Image, *node.Transform, *node.Clip:
+			_, ht, dp := e.Sizes(node.Vertical)
+			return ht + dp
+		}
+	}
+	return 0
+}
+
+// splitColumns splits vl into at most n columns of the given height. rest
+// is the material that does not fit.
+func splitColumns(vl *node.VList, n int, height bag.ScaledPoint) (cols []*node.VList, rest *node.VList) {
+	rest = vl
+	for c := 0; c < n && rest != nil; c++ {
+		var col *node.VList
+		col, rest = splitColumn(rest, height)
+		cols = append(cols, col)
+	}
+	return cols, rest
+}
+
+// splitColumn splits the column material vl at the given height like
+// node.Vsplit. A table that does not fit into the rest of the column is
+// split between its rows first; node.Vsplit repeats the header and footer
+// rows of the table in both parts. The table moves to the next column if
+// not even its first body row fits.
+func splitColumn(vl *node.VList, height bag.ScaledPoint) (col, rest *node.VList) {
+	var used bag.ScaledPoint
+	for e := vl.List; e != nil && used <= height; e = e.Next() {
+		_, ht, dp := e.Sizes(node.Vertical)
+		if k, ok := e.(*node.Kern); ok {
+			ht, dp = k.Kern, 0
+		}
+		tbl, ok := e.(*node.VList)
+		if !ok || !node.IsTable(tbl) || used+ht+dp <= height {
+			used += ht + dp
+			continue
+		}
+		if used > 0 && minTableHeight(tbl) > height-used {
+			break
+		}
+		first, trest := node.Vsplit(tbl, height-used)
+		if trest != nil {
+			// The forced break makes the column end after the first part
+			// of the table.
+			p := node.NewPenalty()
+			p.Penalty = -10000
+			vl.List = node.InsertBefore(vl.List, tbl, first)
+			vl.List = node.DeleteFromList(vl.List, tbl)
+			node.InsertAfter(vl.List, first, p)
+			node.InsertAfter(vl.List, p, trest)
+		}
+		break
+	}
+	return node.Vsplit(vl, height)
+}
+
+// minTableHeight returns the height of the header and footer rows and the
+// first body row of tbl, the least material a part of the table contains.
+// Rows that continue a rowspan of the first body row belong to it.
+func minTableHeight(tbl *node.VList) bag.ScaledPoint {
+	headerCount, _ := tbl.Attributes["_headerCount"].(int)
+	footerCount, _ := tbl.Attributes["_footerCount"].(int)
+	var rows []node.Node
+	for e := tbl.List; e != nil; e = e.Next() {
+		rows = append(rows, e)
+	}
+	if headerCount+footerCount >= len(rows) {
+		return tbl.Height + tbl.Depth
+	}
+	firstEnd := headerCount + 1
+	for firstEnd < len(rows)-footerCount {
+		if hl, ok := rows[firstEnd].(*node.HList); !ok || hl.Attributes["_inRowspan"] != true {
+			break
+		}
+		firstEnd++
+	}
+	var ht bag.ScaledPoint
+	for i, r := range rows {
+		if i < firstEnd || i >= len(rows)-footerCount {
+			_, h, d := r.Sizes(node.Vertical)
+			ht += h + d
+		}
+	}
+	return ht
+}
+
+// copyColumnMaterial copies vl for a trial split. VList.Copy drops the
+// attributes, the tables need them to be split like the originals.
+func copyColumnMaterial(vl *node.VList) *node.VList {
+	cp := vl.Copy().(*node.VList)
+	for e, c := vl.List, cp.List; e != nil && c != nil; e, c = e.Next(), c.Next() {
+		if tbl, ok := e.(*node.VList); ok && node.IsTable(tbl) {
+			c.(*node.VList).Attributes = tbl.Attributes
+		}
+	}
+	return cp
+}
+
+// balancedHeight returns the smallest column height up to maxHeight that
+// takes all of vl in n columns. ok is false if vl does not fit.
+func balancedHeight(vl *node.VList, n int, maxHeight bag.ScaledPoint) (bag.ScaledPoint, bool) {
+	fits := func(height bag.ScaledPoint) bool {
+		cols, rest := splitColumns(copyColumnMaterial(vl), n, height)
+		if rest != nil {
+			return false
+		}
+		for _, col := range cols {
+			if col.Badness >= 1000000 || col.Height+col.Depth > height {
+				return false
+			}
+		}
+		return true
+	}
+	if !fits(maxHeight) {
+		return 0, false
+	}
+	// Discarded glue at the column breaks makes the columns shorter than
+	// the n-th part of vl, so the search starts at 0.
+	var lo, hi bag.ScaledPoint = 0, maxHeight
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if fits(mid) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return hi, true
+}
+
+// columnRow places the columns next to each other with the gutter and the
+// column rule in between.
+func columnRow(cols []*node.VList, cs *ColumnSettings) *node.HList {
+	var ht bag.ScaledPoint
+	for _, col := range cols {
+		ht = max(ht, col.Height+col.Depth)
+	}
+	var head, tail node.Node
+	add := func(n node.Node) {
+		head = node.InsertAfter(head, tail, n)
+		tail = n
+	}
+	for i, col := range cols {
+		if i > 0 {
+			if cs.RuleWidth > 0 {
+				before := node.NewKern()
+				before.Kern = (cs.Gutter - cs.RuleWidth) / 2
+				add(before)
+				r := node.NewRule()
+				r.Width = cs.RuleWidth
+				r.Height = ht
+				r.Attributes = node.H{"origin": "column rule"}
+				if cs.RuleColor != nil {
+					r.Pre = pdfdraw.New().Save().ColorNonstroking(*cs.RuleColor).String()
+					r.Post = pdfdraw.New().Restore().String()
+				}
+				add(r)
+				after := node.NewKern()
+				after.Kern = cs.Gutter - cs.RuleWidth - before.Kern
+				add(after)
+			} else {
+				k := node.NewKern()
+				k.Kern = cs.Gutter
+				add(k)
+			}
+		}
+		col.Width = cs.ColumnWidth()
+		col.SetPrev(nil)
+		col.SetNext(nil)
+		add(col)
+	}
+	hl := node.Hpack(head)
+	// The columns hang from the top of the row.
+	hl.Height, hl.Depth = ht, 0
+	hl.Attributes = node.H{"origin": "column row"}
+	return hl
+}
@@ -0,0 +1,288 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// columnLines returns a VList of n lines of 10pt separated by 2pt glue.
+func columnLines(n int) *node.VList {
+	var head, tail node.Node
+	for i := range n {
+		if i > 0 {
+			g := node.NewGlue()
+			g.Width = 2 * bag.Factor
+			head = node.InsertAfter(head, tail, g)
+			tail = g
+		}
+		hl := node.NewHList()
+		hl.Width = 100 * bag.Factor
+		hl.Height = 10 * bag.Factor
+		head = node.InsertAfter(head, tail, hl)
+		tail = hl
+	}
+	return node.Vpack(head)
+}
+
+// columnRows returns the number of lines in each column of the rows on the
+// page.
+func columnRows(pg *node.VList) [][]int {
+	var rows [][]int
+	for e := pg.List; e != nil; e = e.Next() {
+		row, ok := e.(*node.HList)
+		if !ok || row.Attributes["origin"] != "column row" {
+			continue
+		}
+		var cols []int
+		for c := row.List; c != nil; c = c.Next() {
+			if vl, ok := c.(*node.VList); ok {
+				n := 0
+				for l := vl.List; l != nil; l = l.Next() {
+					if _, ok := l.(*node.HList); ok {
+						n++
+					}
+				}
+				cols = append(cols, n)
+			}
+		}
+		rows = append(rows, cols)
+	}
+	return rows
+}
+
+func sameRows(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestFlowColumns(t *testing.T) {
+	data := []struct {
+		name    string
+		lines   []int
+		balance bool
+		want    [][][]int
+	}{
+		{"fill", []int{14}, false, [][][]int{{{5, 5}}, {{4}}}},
+		{"balance", []int{14}, true, [][][]int{{{5, 5}}, {{2, 2}}}},
+		{"two paragraphs", []int{3, 3}, true, [][][]int{{{3, 3}}}},
+		{"odd", []int{5}, true, [][][]int{{{3, 2}}}},
+	}
+	for _, d := range data {
+		cs := &ColumnSettings{
+			Columns: 2,
+			Width:   210 * bag.Factor,
+			Gutter:  10 * bag.Factor,
+			Height:  60 * bag.Factor,
+			Balance: d.balance,
+		}
+		var vls []*node.VList
+		for _, n := range d.lines {
+			vls = append(vls, columnLines(n))
+		}
+		pages, err := FlowColumns(vls, cs)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		if len(pages) != len(d.want) {
+			t.Fatalf("%s: got %d pages, want %d", d.name, len(pages), len(d.want))
+		}
+		for i, pg := range pages {
+			if got := columnRows(pg); !sameRows(got, d.want[i]) {
+				t.Errorf("%s: page %d has columns %v, want %v", d.name, i+1, got, d.want[i])
+			}
+			if pg.Height > cs.Height {
+				t.Errorf("%s: page %d is %s high", d.name, i+1, pg.Height)
+			}
+		}
+	}
+}
+
+// TestFlowColumnsSpan puts a heading across both columns between two
+// paragraphs. The columns above the heading are balanced.
+func TestFlowColumnsSpan(t *testing.T) {
+	cs := &ColumnSettings{
+		Columns:   2,
+		Width:     210 * bag.Factor,
+		Gutter:    10 * bag.Factor,
+		Height:    100 * bag.Factor,
+		RuleWidth: bag.Factor,
+		Balance:   true,
+	}
+	if got, want := cs.ColumnWidth(), 100*bag.Factor; got != want {
+		t.Errorf("ColumnWidth() = %s, want %s", got, want)
+	}
+	heading := node.NewHList()
+	heading.Width = cs.Width
+	heading.Height = 20 * bag.Factor
+	pages, err := FlowColumns([]*node.VList{columnLines(4), SpanColumns(node.Vpack(heading)), columnLines(2)}, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+	if got := columnRows(pages[0]); !sameRows(got, [][]int{{2, 2}, {1, 1}}) {
+		t.Errorf("got columns %v, want [[2 2] [1 1]]", got)
+	}
+	var items []string
+	for e := pages[0].List; e != nil; e = e.Next() {
+		items = append(items, e.Name())
+	}
+	if len(items) != 3 || items[1] != "vlist" {
+		t.Errorf("page has %v, want column row, heading, column row", items)
+	}
+	row := pages[0].List.(*node.HList)
+	for e := row.List; e != nil; e = e.Next() {
+		if r, ok := e.(*node.Rule); ok {
+			if r.Height != 22*bag.Factor {
+				t.Errorf("column rule is %s high, want 22pt", r.Height)
+			}
+			return
+		}
+	}
+	t.Errorf("no column rule")
+}
+
+func TestFlowColumnsInvalid(t *testing.T) {
+	if _, err := FlowColumns(nil, &ColumnSettings{Height: bag.Factor}); err == nil {
+		t.Errorf("expected an error for zero columns")
+	}
+}
+
+// columnTable returns a table of n rows of 10pt as built by BuildTable. The
+// last footer rows are footer rows, rebuilt by _buildFooters.
+func columnTable(n, footer int) *node.VList {
+	row := func() *node.HList {
+		hl := node.NewHList()
+		hl.Width = 100 * bag.Factor
+		hl.Height = 10 * bag.Factor
+		hl.Attributes = node.H{"origin": "table row"}
+		return hl
+	}
+	var head, tail node.Node
+	for range n {
+		hl := row()
+		head = node.InsertAfter(head, tail, hl)
+		tail = hl
+	}
+	vl := node.Vpack(head)
+	vl.Attributes = node.H{"origin": "table"}
+	if footer > 0 {
+		vl.Attributes["_footerCount"] = footer
+		vl.Attributes["_buildFooters"] = func() ([]*node.HList, error) {
+			var footers []*node.HList
+			for range footer {
+				footers = append(footers, row())
+			}
+			return footers, nil
+		}
+	}
+	return vl
+}
+
+// tableRows returns the number of table rows in each column of the page.
+func tableRows(pg *node.VList) []int {
+	var cols []int
+	for e := pg.List; e != nil; e = e.Next() {
+		row, ok := e.(*node.HList)
+		if !ok || row.Attributes["origin"] != "column row" {
+			continue
+		}
+		for c := row.List; c != nil; c = c.Next() {
+			col, ok := c.(*node.VList)
+			if !ok {
+				continue
+			}
+			n := 0
+			for tbl := col.List; tbl != nil; tbl = tbl.Next() {
+				if vl, ok := tbl.(*node.VList); ok && node.IsTable(vl) {
+					for r := vl.List; r != nil; r = r.Next() {
+						n++
+					}
+				}
+			}
+			cols = append(cols, n)
+		}
+	}
+	return cols
+}
+
+// TestFlowColumnsTable splits tables across the columns of 50pt: a table
+// without header and footer rows, one with a footer row, which is repeated
+// at the bottom of the first column, and a balanced table.
+func TestFlowColumnsTable(t *testing.T) {
+	data := []struct {
+		name    string
+		footer  int
+		balance bool
+		want    []int
+	}{
+		{"plain", 0, false, []int{5, 3}},
+		{"footer", 1, false, []int{5, 4}},
+		{"balanced", 0, true, []int{4, 4}},
+	}
+	for _, d := range data {
+		cs := &ColumnSettings{
+			Columns: 2,
+			Width:   210 * bag.Factor,
+			Gutter:  10 * bag.Factor,
+			Height:  50 * bag.Factor,
+			Balance: d.balance,
+		}
+		pages, err := FlowColumns([]*node.VList{columnTable(8, d.footer)}, cs)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		if len(pages) != 1 {
+			t.Fatalf("%s: got %d pages, want 1", d.name, len(pages))
+		}
+		got := tableRows(pages[0])
+		if len(got) != len(d.want) || got[0] != d.want[0] || got[1] != d.want[1] {
+			t.Errorf("%s: columns have %v rows, want %v", d.name, got, d.want)
+		}
+	}
+}
+
+// TestFlowColumnsTableRowspan splits a table whose sixth row continues a
+// cell of the fifth row. The table can't break between them, so the first
+// column gets four rows.
+func TestFlowColumnsTableRowspan(t *testing.T) {
+	tbl := columnTable(8, 0)
+	i := 0
+	for e := tbl.List; e != nil; e = e.Next() {
+		if i == 5 {
+			e.(*node.HList).Attributes = node.H{"_inRowspan": true}
+		}
+		i++
+	}
+	cs := &ColumnSettings{
+		Columns: 2,
+		Width:   210 * bag.Factor,
+		Gutter:  10 * bag.Factor,
+		Height:  50 * bag.Factor,
+	}
+	pages, err := FlowColumns([]*node.VList{tbl}, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+	if got := tableRows(pages[0]); len(got) != 2 || got[0] != 4 || got[1] != 4 {
+		t.Errorf("columns have %v rows, want [4 4]", got)
+	}
+}
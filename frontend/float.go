@@ -0,0 +1,219 @@
+package frontend
+
+import (
+	"fmt"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// FloatSide is the edge of the text column a float is attached to.
+type FloatSide int
+
+const (
+	// FloatLeft places the float at the left edge of the text column.
+	FloatLeft FloatSide = 1 << iota
+	// FloatRight places the float at the right edge of the text column.
+	FloatRight
+	// FloatBoth is only used for FloatArea.Clear and clears floats on both
+	// sides.
+	FloatBoth = FloatLeft | FloatRight
+)
+
+func (fs FloatSide) String() string {
+	switch fs {
+	case FloatLeft:
+		return "left"
+	case FloatRight:
+		return "right"
+	case FloatBoth:
+		return "both"
+	}
+	return fmt.Sprintf("FloatSide(%d)", int(fs))
+}
+
+// Float is a box placed by FloatArea.PlaceFloat. X and Y are the position of
+// the top left corner of the box relative to the top left corner of the
+// float area.
+type Float struct {
+	Side FloatSide
+	List *node.VList
+	X    bag.ScaledPoint
+	Y    bag.ScaledPoint
+}
+
+// FloatArea is a text column with floating boxes the text flows around.
+// Paragraphs formatted with the WrapFloats option get a shape that leaves
+// room for the floats and move the current position of the area down by
+// their height. Everything else that takes vertical space in the column
+// must be reported with Advance.
+type FloatArea struct {
+	// Width is the width of the text column.
+	Width bag.ScaledPoint
+	// Distance is the space between a float and the text next to it or
+	// below it.
+	Distance bag.ScaledPoint
+	// MinLineWidth is the narrowest line next to the floats. A paragraph
+	// that would start with a narrower line moves down below the floats,
+	// narrower lines inside the paragraph get this width and overlap the
+	// floats.
+	MinLineWidth bag.ScaledPoint
+	pos          bag.ScaledPoint
+	floats       []*Float
+}
+
+// NewFloatArea creates a float area for a text column of the given width.
+// The minimum line width is a quarter of the width.
+func NewFloatArea(width bag.ScaledPoint) *FloatArea {
+	return &FloatArea{Width: width, MinLineWidth: width / 4}
+}
+
+// Position returns the distance between the top of the area and the top of
+// the next paragraph.
+func (fa *FloatArea) Position() bag.ScaledPoint {
+	return fa.pos
+}
+
+// Advance moves the current position down by ht, for example after
+// vertical space between two paragraphs.
+func (fa *FloatArea) Advance(ht bag.ScaledPoint) {
+	fa.pos += ht
+}
+
+// Floats returns the floats in the order they were placed. The caller is
+// responsible for shipping out their lists at the position of the float.
+func (fa *FloatArea) Floats() []*Float {
+	return fa.floats
+}
+
+// bottom returns the lowest position that the float keeps free of text.
+func (fa *FloatArea) bottom(f *Float) bag.ScaledPoint {
+	return f.Y + f.List.Height + f.List.Depth + fa.Distance
+}
+
+// edges returns the left and the right edge of the space between the floats
+// in the vertical range from top to bottom. next is the smallest bottom of
+// the floats in the range, 0 if there are none.
+func (fa *FloatArea) edges(top, bottom bag.ScaledPoint) (left, right, next bag.ScaledPoint) {
+	right = fa.Width
+	for _, f := range fa.floats {
+		fb := fa.bottom(f)
+		if fb <= top || f.Y >= bottom {
+			continue
+		}
+		if next == 0 || fb < next {
+			next = fb
+		}
+		if f.Side == FloatLeft {
+			left = max(left, f.X+f.List.Width+fa.Distance)
+		} else {
+			right = min(right, f.X-fa.Distance)
+		}
+	}
+	return left, right, next
+}
+
+// PlaceFloat attaches vl to the left or right edge of the text column at the
+// current position. Like CSS floats, a float is placed next to earlier
+// floats on the same side if there is room for it and never above an
+// earlier float, otherwise it moves down until it fits.
+func (fa *FloatArea) PlaceFloat(vl *node.VList, side FloatSide) (*Float, error) {
+	if side != FloatLeft && side != FloatRight {
+		return nil, fmt.Errorf("PlaceFloat: invalid side %s", side)
+	}
+	y := fa.pos
+	if n := len(fa.floats); n > 0 {
+		y = max(y, fa.floats[n-1].Y)
+	}
+	ht := vl.Height + vl.Depth
+	var x bag.ScaledPoint
+	for {
+		left, right, next := fa.edges(y, y+ht)
+		if side == FloatLeft {
+			x = left
+		} else {
+			x = right - vl.Width
+		}
+		if right-left >= vl.Width || next == 0 {
+			break
+		}
+		y = next
+	}
+	if x < 0 || x+vl.Width > fa.Width {
+		bag.Logger.Warn("PlaceFloat: float is wider than the text column", "width", vl.Width, "column", fa.Width)
+	}
+	f := &Float{Side: side, List: vl, X: x, Y: y}
+	fa.floats = append(fa.floats, f)
+	return f, nil
+}
+
+// Clear moves the current position below all floats on the given side (CSS
+// clear). It returns the vertical space the caller must insert before the
+// next paragraph.
+func (fa *FloatArea) Clear(side FloatSide) bag.ScaledPoint {
+	pos := fa.pos
+	for _, f := range fa.floats {
+		if f.Side&side != 0 {
+			pos = max(pos, fa.bottom(f))
+		}
+	}
+	skip := pos - fa.pos
+	fa.pos = pos
+	return skip
+}
+
+// parshape returns the shape of a paragraph with lines of the given height
+// that starts at the current position. indent and indentRows are the
+// paragraph's own indentation (see node.LinebreakSettings.IndentRows). The
+// shape is nil if no float is next to the paragraph. If the first line
+// would be narrower than MinLineWidth, the paragraph starts below the
+// floats and skip is the space to insert above it.
+func (fa *FloatArea) parshape(hsize, lineHeight, indent bag.ScaledPoint, indentRows int) (shape []node.ParshapeLine, skip bag.ScaledPoint) {
+	if lineHeight <= 0 {
+		return nil, 0
+	}
+	var last bag.ScaledPoint
+	for _, f := range fa.floats {
+		last = max(last, fa.bottom(f))
+	}
+	minWidth := max(fa.MinLineWidth, 1)
+	indentFor := func(row int) bag.ScaledPoint {
+		switch {
+		case indentRows == 0,
+			indentRows > 0 && row < indentRows,
+			indentRows < 0 && row >= -indentRows:
+			return indent
+		}
+		return 0
+	}
+	start := fa.pos
+	for start < last {
+		left, right, next := fa.edges(start, start+lineHeight)
+		if min(right, hsize)-left-indentFor(0) >= minWidth || next == 0 {
+			break
+		}
+		start = next
+	}
+	skip = start - fa.pos
+	if last <= start {
+		return nil, skip
+	}
+	rows := int((last-start+lineHeight-1)/lineHeight) + 1
+	rows = max(rows, indentRows+1, -indentRows+1)
+	shape = make([]node.ParshapeLine, rows)
+	for row := range shape {
+		top := start + bag.ScaledPoint(row)*lineHeight
+		left, right, _ := fa.edges(top, top+lineHeight)
+		right = min(right, hsize)
+		ind := indentFor(row)
+		width := right - left - ind
+		if width < minWidth {
+			// Overlapping floats or a float wider than the column: keep
+			// the line inside the column.
+			width = min(minWidth, hsize)
+			left = max(0, min(left, hsize-width-ind))
+		}
+		shape[row] = node.ParshapeLine{Indent: left + ind, Width: width}
+	}
+	return shape, skip
+}
@@ -0,0 +1,179 @@
+package frontend
+
+import (
+	"io"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// floatBox returns a VList of the given size.
+func floatBox(wd, ht bag.ScaledPoint) *node.VList {
+	vl := node.NewVList()
+	vl.Width = wd
+	vl.Height = ht
+	return vl
+}
+
+func TestPlaceFloat(t *testing.T) {
+	fa := NewFloatArea(200 * bag.Factor)
+	fa.Distance = 5 * bag.Factor
+	data := []struct {
+		side FloatSide
+		wd   bag.ScaledPoint
+		ht   bag.ScaledPoint
+		x    bag.ScaledPoint
+		y    bag.ScaledPoint
+	}{
+		{FloatLeft, 50 * bag.Factor, 30 * bag.Factor, 0, 0},
+		{FloatLeft, 50 * bag.Factor, 20 * bag.Factor, 55 * bag.Factor, 0},
+		{FloatRight, 60 * bag.Factor, 40 * bag.Factor, 140 * bag.Factor, 0},
+		// No room next to the other floats: below the second float, next
+		// to the first one.
+		{FloatLeft, 50 * bag.Factor, 10 * bag.Factor, 55 * bag.Factor, 25 * bag.Factor},
+	}
+	for i, d := range data {
+		f, err := fa.PlaceFloat(floatBox(d.wd, d.ht), d.side)
+		if err != nil {
+			t.Fatalf("%d: PlaceFloat: %v", i, err)
+		}
+		if f.X != d.x || f.Y != d.y {
+			t.Errorf("%d: float at (%s,%s), want (%s,%s)", i, f.X, f.Y, d.x, d.y)
+		}
+	}
+	if _, err := fa.PlaceFloat(floatBox(10, 10), FloatBoth); err == nil {
+		t.Error("PlaceFloat(FloatBoth) succeeded, want error")
+	}
+	if got, want := fa.Clear(FloatLeft), 40*bag.Factor; got != want {
+		t.Errorf("Clear(FloatLeft) = %s, want %s", got, want)
+	}
+	if got, want := fa.Clear(FloatBoth), 5*bag.Factor; got != want {
+		t.Errorf("Clear(FloatBoth) = %s, want %s", got, want)
+	}
+	if got := fa.Clear(FloatBoth); got != 0 {
+		t.Errorf("second Clear(FloatBoth) = %s, want 0", got)
+	}
+}
+
+func TestWrapFloats(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	fa := NewFloatArea(200 * bag.Factor)
+	fa.Distance = 5 * bag.Factor
+	if _, err = fa.PlaceFloat(floatBox(50*bag.Factor, 30*bag.Factor), FloatLeft); err != nil {
+		t.Fatalf("PlaceFloat: %v", err)
+	}
+	te := NewText()
+	for i := range 30 {
+		if i > 0 {
+			g := node.NewGlue()
+			g.Width = 5 * bag.Factor
+			g.Stretch = 5 * bag.Factor
+			te.Items = append(te.Items, g)
+		}
+		te.Items = append(te.Items, footnoteBox(20*bag.Factor))
+	}
+	vl, _, err := fe.FormatParagraph(te, 200*bag.Factor, Leading(12*bag.Factor), WrapFloats(fa))
+	if err != nil {
+		t.Fatalf("FormatParagraph: %v", err)
+	}
+	// The float with the distance reaches 35pt down, so the first three lines
+	// of 12pt start after the float.
+	var indents []bag.ScaledPoint
+	for e := vl.List; e != nil; e = e.Next() {
+		line, ok := e.(*node.HList)
+		if !ok {
+			continue
+		}
+		if g, ok := line.List.(*node.Glue); ok && g.Attributes["origin"] == "leftskip" {
+			indents = append(indents, g.Width)
+		}
+	}
+	if len(indents) < 4 {
+		t.Fatalf("got %d lines, want at least 4", len(indents))
+	}
+	for i, ind := range indents {
+		want := bag.ScaledPoint(0)
+		if i < 3 {
+			want = 55 * bag.Factor
+		}
+		if ind != want {
+			t.Errorf("line %d: indent %s, want %s", i, ind, want)
+		}
+	}
+	if got, want := fa.Position(), vl.Height+vl.Depth; got != want {
+		t.Errorf("position after the paragraph %s, want %s", got, want)
+	}
+}
+
+// TestWrapFloatsTooWide wraps a paragraph around a float that is wider than
+// the column. The paragraph starts below the float.
+func TestWrapFloatsTooWide(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	fa := NewFloatArea(200 * bag.Factor)
+	fa.Distance = 5 * bag.Factor
+	if _, err = fa.PlaceFloat(floatBox(250*bag.Factor, 30*bag.Factor), FloatLeft); err != nil {
+		t.Fatalf("PlaceFloat: %v", err)
+	}
+	te := NewText()
+	for i := range 10 {
+		if i > 0 {
+			g := node.NewGlue()
+			g.Width = 5 * bag.Factor
+			g.Stretch = 5 * bag.Factor
+			te.Items = append(te.Items, g)
+		}
+		te.Items = append(te.Items, footnoteBox(20*bag.Factor))
+	}
+	vl, _, err := fe.FormatParagraph(te, 200*bag.Factor, Leading(12*bag.Factor), WrapFloats(fa))
+	if err != nil {
+		t.Fatalf("FormatParagraph: %v", err)
+	}
+	k, ok := vl.List.(*node.Kern)
+	if !ok || k.Kern != 35*bag.Factor {
+		t.Fatalf("paragraph starts with %v, want a kern of 35pt", vl.List)
+	}
+	for e := k.Next(); e != nil; e = e.Next() {
+		line, ok := e.(*node.HList)
+		if !ok {
+			continue
+		}
+		if g, ok := line.List.(*node.Glue); ok && g.Attributes["origin"] == "leftskip" && g.Width != 0 {
+			t.Errorf("line below the float is indented by %s", g.Width)
+		}
+	}
+	if got, want := fa.Position(), vl.Height+vl.Depth; got != want {
+		t.Errorf("position after the paragraph %s, want %s", got, want)
+	}
+}
+
+// TestParshapeMinLineWidth checks that a float wider than the column next to
+// the middle of a paragraph does not make the lines narrower than
+// MinLineWidth or push them out of the column.
+func TestParshapeMinLineWidth(t *testing.T) {
+	fa := NewFloatArea(200 * bag.Factor)
+	fa.Distance = 5 * bag.Factor
+	fa.Advance(24 * bag.Factor)
+	if _, err := fa.PlaceFloat(floatBox(250*bag.Factor, 30*bag.Factor), FloatLeft); err != nil {
+		t.Fatalf("PlaceFloat: %v", err)
+	}
+	fa.pos = 0
+	shape, skip := fa.parshape(200*bag.Factor, 12*bag.Factor, 0, 0)
+	if skip != 0 {
+		t.Errorf("skip %s, want 0", skip)
+	}
+	if len(shape) < 3 || shape[0].Width != 200*bag.Factor || shape[1].Width != 200*bag.Factor {
+		t.Fatalf("the first two lines are not full width: %v", shape)
+	}
+	for i, l := range shape {
+		if l.Width < fa.MinLineWidth || l.Indent < 0 || l.Indent+l.Width > 200*bag.Factor {
+			t.Errorf("line %d: indent %s width %s", i, l.Indent, l.Width)
+		}
+	}
+}
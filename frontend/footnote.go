@@ -0,0 +1,290 @@
+package frontend
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// FootnoteNumbering determines when the footnote numbers start again at 1.
+type FootnoteNumbering int
+
+const (
+	// FootnoteNumberingDocument counts the footnotes through the whole
+	// document.
+	FootnoteNumberingDocument FootnoteNumbering = iota
+	// FootnoteNumberingChapter restarts the numbers with every call to
+	// StartChapter.
+	FootnoteNumberingChapter
+	// FootnoteNumberingPage restarts the numbers on every page. The page
+	// breaker must call RenumberFootnotes, see node.InsertSettings.Renumber.
+	FootnoteNumberingPage
+)
+
+// FootnoteSettings controls the footnotes created with SettingFootnote.
+type FootnoteSettings struct {
+	Numbering FootnoteNumbering
+	// Format returns the footnote mark for a number. nil uses arabic
+	// numbers.
+	Format func(int) string
+	// Options are used to format the footnote text, for example to set a
+	// smaller font size.
+	Options []TypesettingOption
+}
+
+// footnote holds everything to rebuild the reference and the text of a
+// footnote when it gets a new number.
+type footnote struct {
+	body      *Text
+	settings  TypesettingSettings
+	reference *node.HList
+	// line is the line of the paragraph that contains the reference.
+	line *node.HList
+	// mark is the custom footnote mark, nil for numbered footnotes.
+	mark  node.Node
+	hsize bag.ScaledPoint
+}
+
+// StartChapter restarts the footnote numbers if the numbering is
+// FootnoteNumberingChapter.
+func (fe *Document) StartChapter() {
+	if fe.Footnotes != nil && fe.Footnotes.Numbering == FootnoteNumberingChapter {
+		fe.footnoteCounter = 0
+	}
+}
+
+// footnoteNumber returns the number of the footnote with the given text. A
+// text that is formatted more than once (for example in a table cell) keeps
+// its number.
+func (fe *Document) footnoteNumber(body *Text) int {
+	if n, ok := fe.footnoteNumbers[body]; ok {
+		return n
+	}
+	fe.footnoteCounter++
+	if fe.footnoteNumbers == nil {
+		fe.footnoteNumbers = make(map[*Text]int)
+	}
+	fe.footnoteNumbers[body] = fe.footnoteCounter
+	return fe.footnoteCounter
+}
+
+// footnoteMark returns the superscript footnote mark for the number.
+func (fe *Document) footnoteMark(n int, settings TypesettingSettings) (node.Node, error) {
+	format := strconv.Itoa
+	if fe.Footnotes != nil && fe.Footnotes.Format != nil {
+		format = fe.Footnotes.Format
+	}
+	size := 12 * bag.Factor
+	if sz, ok := settings[SettingSize].(bag.ScaledPoint); ok {
+		size = sz
+	}
+	ts := TypesettingSettings{}
+	for k, v := range settings {
+		ts[k] = v
+	}
+	ts[SettingSize] = size * 7 / 10
+	ts[SettingYOffset] = size * 4 / 10
+	return fe.BuildNodelistFromString(ts, format(n))
+}
+
+// footnoteLabel returns the mark of the footnote with the number n.
+func (fe *Document) footnoteLabel(fn *footnote, n int, settings TypesettingSettings) (node.Node, error) {
+	if fn.mark != nil {
+		return node.CopyList(fn.mark), nil
+	}
+	return fe.footnoteMark(n, settings)
+}
+
+// buildFootnote returns the reference mark for the footnote text body
+// followed by an Insert node. The items of t are the mark; without items
+// the mark is the footnote number. The footnote text is formatted later
+// by FormatParagraph, when the width is known.
+func (fe *Document) buildFootnote(t *Text, body *Text) (node.Node, error) {
+	fn := &footnote{body: body, settings: TypesettingSettings{}}
+	for k, v := range t.Settings {
+		if k != SettingFootnote {
+			fn.settings[k] = v
+		}
+	}
+	n := fe.footnoteNumber(body)
+	var mark node.Node
+	var err error
+	if len(t.Items) > 0 {
+		delete(t.Settings, SettingFootnote)
+		mark, _, err = fe.Mknodes(t)
+		t.Settings[SettingFootnote] = body
+		fn.mark = node.CopyList(mark)
+	} else {
+		mark, err = fe.footnoteMark(n, fn.settings)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ref := node.Hpack(mark)
+	ref.Attributes = node.H{"origin": "footnote reference"}
+	fn.reference = ref
+	ins := node.NewInsert()
+	ins.Number = n
+	ins.Attributes = node.H{"_footnote": fn}
+	node.InsertAfter(ref, ref, ins)
+	return ref, nil
+}
+
+// formatFootnotes formats the text of the footnotes in the list starting at
+// head to the width hsize.
+func (fe *Document) formatFootnotes(head node.Node, hsize bag.ScaledPoint) error {
+	for _, ins := range node.FindInserts(head) {
+		fn, ok := ins.Attributes["_footnote"].(*footnote)
+		if !ok || ins.List != nil {
+			continue
+		}
+		fn.hsize = hsize
+		if err := fe.formatFootnote(ins, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFootnoteLines remembers the line of every footnote reference in the
+// lines of vl, so RenumberFootnotes can pack the line again.
+func setFootnoteLines(vl *node.VList) {
+	for e := vl.List; e != nil; e = e.Next() {
+		line, ok := e.(*node.HList)
+		if !ok {
+			continue
+		}
+		for _, ins := range node.FindInserts(line.List) {
+			if fn, ok := ins.Attributes["_footnote"].(*footnote); ok {
+				fn.line = line
+			}
+		}
+	}
+}
+
+// repackLine packs the line again to its width after the width of a
+// footnote reference in it has changed. The glue is set back to its natural
+// width first, as the line breaker set it with node.HpackToWithEnd.
+func repackLine(line *node.HList) {
+	var stretch, shrink [4]bag.ScaledPoint
+	for e := line.List; e != nil; e = e.Next() {
+		if g, ok := e.(*node.Glue); ok {
+			stretch[g.StretchOrder] += g.Stretch
+			shrink[g.ShrinkOrder] += g.Shrink
+		}
+	}
+	highest := func(sums [4]bag.ScaledPoint) node.GlueOrder {
+		for i := node.GlueOrder(3); i > 0; i-- {
+			if sums[i] != 0 {
+				return i
+			}
+		}
+		return node.StretchNormal
+	}
+	stretchOrder, shrinkOrder := highest(stretch), highest(shrink)
+	r := line.GlueSet
+	for e := line.List; e != nil; e = e.Next() {
+		g, ok := e.(*node.Glue)
+		if !ok {
+			continue
+		}
+		switch {
+		case r >= 0 && g.StretchOrder == stretchOrder:
+			g.Width -= bag.ScaledPoint(r * float64(g.Stretch))
+		case r >= -1 && r < 0 && g.ShrinkOrder == shrinkOrder:
+			g.Width -= bag.ScaledPoint(r * float64(g.Shrink))
+		}
+	}
+	hl := node.HpackToWithEnd(line.List, node.Tail(line.List), line.Width)
+	line.GlueSet = hl.GlueSet
+	line.Badness = hl.Badness
+}
+
+// formatFootnote formats the footnote text with the footnote mark at the
+// beginning and stores it in the insert.
+func (fe *Document) formatFootnote(ins *node.Insert, fn *footnote) error {
+	var opts []TypesettingOption
+	if fe.Footnotes != nil {
+		opts = fe.Footnotes.Options
+	}
+	p := &Options{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	te := NewText()
+	for _, k := range []SettingType{SettingFontFamily, SettingFontFamilyStack, SettingSize, SettingColor, SettingLanguage, SettingDirection} {
+		if v, ok := fn.settings[k]; ok {
+			te.Settings[k] = v
+		}
+	}
+	if p.Fontsize != 0 {
+		te.Settings[SettingSize] = p.Fontsize
+	}
+	if p.Fontfamily != nil {
+		te.Settings[SettingFontFamily] = p.Fontfamily
+	}
+	label, err := fe.footnoteLabel(fn, ins.Number, te.Settings)
+	if err != nil {
+		return err
+	}
+	size := 12 * bag.Factor
+	if sz, ok := te.Settings[SettingSize].(bag.ScaledPoint); ok {
+		size = sz
+	}
+	k := node.NewKern()
+	k.Kern = size / 4
+	k.Attributes = node.H{"origin": "footnote label"}
+	te.Items = append(te.Items, node.Hpack(label), k, fn.body)
+	vl, _, err := fe.FormatParagraph(te, fn.hsize, opts...)
+	if err != nil {
+		return fmt.Errorf("footnote %d: %w", ins.Number, err)
+	}
+	ins.List = vl
+	return nil
+}
+
+// RenumberFootnotes gives the footnotes on a page the numbers 1, 2, 3, …
+// if the numbering is FootnoteNumberingPage. It has the signature of
+// node.InsertSettings.Renumber. The reference marks are replaced and the
+// lines with the marks are packed again. The page breaker places the
+// reformatted footnote texts afterwards.
+func (fe *Document) RenumberFootnotes(page int, inserts []*node.Insert) {
+	if fe.Footnotes == nil || fe.Footnotes.Numbering != FootnoteNumberingPage {
+		return
+	}
+	n := 0
+	for _, ins := range inserts {
+		fn, ok := ins.Attributes["_footnote"].(*footnote)
+		if !ok {
+			continue
+		}
+		n++
+		if ins.Number == n {
+			continue
+		}
+		ins.Number = n
+		fe.footnoteNumbers[fn.body] = n
+		if fn.mark == nil {
+			mark, err := fe.footnoteMark(n, fn.settings)
+			if err != nil {
+				bag.Logger.Error("RenumberFootnotes", "page", page, "error", err)
+				continue
+			}
+			ref := node.Hpack(mark)
+			fn.reference.List = ref.List
+			fn.reference.Width = ref.Width
+			fn.reference.Height = ref.Height
+			fn.reference.Depth = ref.Depth
+			if fn.line != nil {
+				repackLine(fn.line)
+			}
+		}
+		if fn.hsize > 0 {
+			if err := fe.formatFootnote(ins, fn); err != nil {
+				bag.Logger.Error("RenumberFootnotes", "page", page, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package frontend
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// footnoteBox returns an empty box that stands in for text.
+func footnoteBox(wd bag.ScaledPoint) *node.HList {
+	hl := node.NewHList()
+	hl.Width = wd
+	hl.Height = 8 * bag.Factor
+	return hl
+}
+
+// footnoteParagraph returns a paragraph with a footnote with the mark "*"
+// (a box of 3pt) and the given body.
+func footnoteParagraph(body *Text) *Text {
+	ref := NewText()
+	ref.Settings[SettingFootnote] = body
+	ref.Items = append(ref.Items, footnoteBox(3*bag.Factor))
+	te := NewText()
+	te.Items = append(te.Items, footnoteBox(20*bag.Factor), ref, footnoteBox(20*bag.Factor))
+	return te
+}
+
+func footnoteBody() *Text {
+	body := NewText()
+	body.Items = append(body.Items, footnoteBox(50*bag.Factor))
+	return body
+}
+
+func formatFootnoteParagraph(t *testing.T, fe *Document, te *Text) *node.Insert {
+	t.Helper()
+	vl, _, err := fe.FormatParagraph(te, 200*bag.Factor)
+	if err != nil {
+		t.Fatalf("FormatParagraph: %v", err)
+	}
+	inserts := node.FindInserts(vl.List)
+	if len(inserts) != 1 {
+		t.Fatalf("got %d inserts, want 1", len(inserts))
+	}
+	return inserts[0]
+}
+
+func TestFootnote(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	body := footnoteBody()
+	te := footnoteParagraph(body)
+	ins := formatFootnoteParagraph(t, fe, te)
+	if ins.Number != 1 {
+		t.Errorf("footnote number %d, want 1", ins.Number)
+	}
+	if ins.List == nil || ins.List.Height != 8*bag.Factor {
+		t.Fatalf("footnote text is not formatted: %v", ins.List)
+	}
+	// The footnote text starts with the mark.
+	line, ok := ins.List.List.(*node.HList)
+	if !ok {
+		t.Fatalf("footnote starts with %T, want a line", ins.List.List)
+	}
+	var first *node.HList
+	for e := line.List; e != nil && first == nil; e = e.Next() {
+		first, _ = e.(*node.HList)
+	}
+	if first == nil || first.Width != 3*bag.Factor {
+		t.Errorf("first box in the footnote is %v, want the mark", first)
+	}
+
+	// Formatting the same text again keeps the number.
+	if n := fe.footnoteNumber(body); n != 1 {
+		t.Errorf("footnote number %d after reformatting, want 1", n)
+	}
+	if ins = formatFootnoteParagraph(t, fe, footnoteParagraph(footnoteBody())); ins.Number != 2 {
+		t.Errorf("footnote number %d, want 2", ins.Number)
+	}
+	// Document numbering ignores chapters.
+	fe.StartChapter()
+	if ins = formatFootnoteParagraph(t, fe, footnoteParagraph(footnoteBody())); ins.Number != 3 {
+		t.Errorf("footnote number %d, want 3", ins.Number)
+	}
+	fe.Footnotes.Numbering = FootnoteNumberingChapter
+	fe.StartChapter()
+	if ins = formatFootnoteParagraph(t, fe, footnoteParagraph(footnoteBody())); ins.Number != 1 {
+		t.Errorf("footnote number %d in new chapter, want 1", ins.Number)
+	}
+}
+
+func TestRenumberFootnotes(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	var inserts []*node.Insert
+	for range 3 {
+		inserts = append(inserts, formatFootnoteParagraph(t, fe, footnoteParagraph(footnoteBody())))
+	}
+	// Numbering is not per page, nothing changes.
+	fe.RenumberFootnotes(2, inserts[1:])
+	if inserts[1].Number != 2 {
+		t.Errorf("footnote number %d, want 2", inserts[1].Number)
+	}
+	fe.Footnotes.Numbering = FootnoteNumberingPage
+	oldList := inserts[1].List
+	fe.RenumberFootnotes(2, inserts[1:])
+	if inserts[1].Number != 1 || inserts[2].Number != 2 {
+		t.Errorf("footnote numbers %d, %d, want 1, 2", inserts[1].Number, inserts[2].Number)
+	}
+	if inserts[1].List == oldList {
+		t.Errorf("footnote text was not formatted again")
+	}
+}
+
+// TestPagebreakFootnote places the footnote of a paragraph at the bottom of
+// the page.
+func TestPagebreakFootnote(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	vl, _, err := fe.FormatParagraph(footnoteParagraph(footnoteBody()), 200*bag.Factor)
+	if err != nil {
+		t.Fatalf("FormatParagraph: %v", err)
+	}
+	settings := node.NewPagebreakSettings()
+	settings.PageHeight = 100 * bag.Factor
+	settings.Inserts.Renumber = fe.RenumberFootnotes
+	pages, _ := node.Pagebreak(node.Vpack(vl), settings)
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+	var rules int
+	var last node.Node
+	for e := pages[0].List; e != nil; e = e.Next() {
+		if _, ok := e.(*node.Rule); ok {
+			rules++
+		}
+		last = e
+	}
+	if rules != 1 {
+		t.Errorf("got %d separator rules, want 1", rules)
+	}
+	if vl, ok := last.(*node.VList); !ok || vl.Height != 8*bag.Factor {
+		t.Errorf("page ends with %v, want the footnote", last)
+	}
+}
+
+// TestRenumberFootnotesRepack renumbers the tenth footnote to 1 on its page.
+// The line with the narrower mark is packed again, so its contents fill the
+// line.
+func TestRenumberFootnotesRepack(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	ff := fe.NewFontFamily("text")
+	fs := &FontSource{Location: filepath.Join("..", "qa", "fonts", "upem", "fonts", "texgyreheros-regular.otf")}
+	if err = ff.AddMember(fs, FontWeight400, FontStyleNormal); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	for range 9 {
+		fe.footnoteNumber(NewText())
+	}
+	ref := NewText()
+	ref.Settings[SettingFootnote] = footnoteBody()
+	te := NewText()
+	te.Settings[SettingFontFamily] = ff
+	te.Settings[SettingSize] = 10 * bag.Factor
+	te.Items = append(te.Items, footnoteBox(20*bag.Factor), ref, " ", footnoteBox(20*bag.Factor))
+	vl, _, err := fe.FormatParagraph(te, 200*bag.Factor)
+	if err != nil {
+		t.Fatalf("FormatParagraph: %v", err)
+	}
+	inserts := node.FindInserts(vl.List)
+	if len(inserts) != 1 || inserts[0].Number != 10 {
+		t.Fatalf("got inserts %v, want footnote 10", inserts)
+	}
+	fe.Footnotes.Numbering = FootnoteNumberingPage
+	fe.RenumberFootnotes(1, inserts)
+	if inserts[0].Number != 1 {
+		t.Errorf("footnote number %d, want 1", inserts[0].Number)
+	}
+	line := vl.List.(*node.HList)
+	var sum bag.ScaledPoint
+	for e := line.List; e != nil; e = e.Next() {
+		wd, _, _ := e.Sizes(node.Horizontal)
+		sum += wd
+	}
+	if sum != line.Width {
+		t.Errorf("line contents are %s wide, want %s", sum, line.Width)
+	}
+}
@@ -29,6 +29,11 @@ type Document struct {
 	coverageCache         fontCoverageCache     // per-FontSource cmap probe cache for per-glyph fallback; zero-value is valid
 	dirstack              []string
 	postLinebreakCallback []PostLinebreakCallbackFunc
+	protrusionSets        map[string]*node.ProtrusionSet
+	BaselineGrid          *node.BaselineGrid // Used by paragraphs formatted with AlignToGrid.
+	Footnotes             *FootnoteSettings
+	footnoteCounter       int
+	footnoteNumbers       map[*Text]int
 	suppressInfo          bool
 }
 
@@ -41,7 +46,10 @@ func initDocument(w io.Writer) (*Document, error) {
 		FontFamilies:   make(map[string]*FontFamily),
 		fontlocal:      make(map[string]*FontSource),
 		Doc:            document.NewDocument(w),
+		protrusionSets: make(map[string]*node.ProtrusionSet),
+		Footnotes:      &FootnoteSettings{},
 	}
+	d.RegisterProtrusionSet(node.DefaultProtrusionSet())
 	// Honour the reproducible-builds.org SOURCE_DATE_EPOCH convention
 	// at library level so every consumer (bagme, glu/markdown,
 	// glu/.lua entry, ad-hoc callers) gets deterministic timestamps
@@ -127,6 +135,13 @@ const (
 	HangingPunctuationAllowEnd = 1
 )
 
+// RegisterProtrusionSet makes the protrusion set available under its name,
+// so SettingHangingPunctuation can select it. The set "default" is always
+// registered and can be replaced.
+func (fe *Document) RegisterProtrusionSet(ps *node.ProtrusionSet) {
+	fe.protrusionSets[ps.Name] = ps
+}
+
 // HorizontalAlignment is the horizontal alignment.
 type HorizontalAlignment int
 
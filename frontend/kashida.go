@@ -0,0 +1,66 @@
+package frontend
+
+import (
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/font"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// tatweel is U+0640 ARABIC TATWEEL, the glyph that fills a kashida.
+const tatweel = 'ـ'
+
+// kashidaPoints returns for each atom whether a kashida is inserted before
+// it. Each word gets at most one kashida, at the last of the joining points
+// marked by the shaper, which is where Arabic calligraphy prefers to
+// elongate (before the final letter). It returns nil if there are no
+// kashida points.
+func kashidaPoints(atoms []font.Atom) []bool {
+	var ret []bool
+	last := -1
+	flush := func() {
+		if last > 0 {
+			if ret == nil {
+				ret = make([]bool, len(atoms))
+			}
+			ret[last] = true
+		}
+		last = -1
+	}
+	for i, a := range atoms {
+		if a.IsSpace {
+			flush()
+		} else if a.Kashida {
+			last = i
+		}
+	}
+	flush()
+	return ret
+}
+
+// kashidaGlue returns a penalty that forbids a line break and a glue with
+// the subtype GlueKashida that is filled with tatweel glyphs of fnt. The
+// glue has no natural width and the given stretchability. It returns nil if
+// the font has no tatweel.
+func kashidaGlue(fnt *font.Font, stretch bag.ScaledPoint) node.Node {
+	atoms := fnt.Shape(string(tatweel), nil, nil)
+	if len(atoms) != 1 || atoms[0].Codepoint == 0 || atoms[0].Advance <= 0 {
+		return nil
+	}
+	g := node.NewGlyph()
+	g.Codepoint = atoms[0].Codepoint
+	g.Components = atoms[0].Components
+	g.Font = fnt
+	g.Width = atoms[0].Advance
+	g.Height = atoms[0].Height
+	g.Depth = atoms[0].Depth
+
+	p := node.NewPenalty()
+	p.Penalty = 10000
+	glue := node.NewGlue()
+	glue.Subtype = node.GlueKashida
+	glue.Stretch = stretch
+	glue.Leader = node.Hpack(g)
+	glue.Attributes = node.H{"origin": "kashida"}
+	node.InsertAfter(p, p, glue)
+	return p
+}
@@ -0,0 +1,34 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/font"
+)
+
+func TestKashidaPoints(t *testing.T) {
+	// "بسم الله": the shaper marks the joins س←ب, م←س, ل←ل and ه←ل.
+	atoms := []font.Atom{
+		{Components: "ب"},
+		{Components: "س", Kashida: true},
+		{Components: "م", Kashida: true},
+		{Components: " ", IsSpace: true},
+		{Components: "ا"},
+		{Components: "ل"},
+		{Components: "ل", Kashida: true},
+		{Components: "ه", Kashida: true},
+	}
+	got := kashidaPoints(atoms)
+	want := []bool{false, false, true, false, false, false, false, true}
+	if len(got) != len(want) {
+		t.Fatalf("got %d kashida points, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("kashida before atom %d (%s): %t, want %t", i, atoms[i].Components, got[i], want[i])
+		}
+	}
+	if got := kashidaPoints(atoms[4:6]); got != nil {
+		t.Errorf("kashidaPoints without joins = %v, want nil", got)
+	}
+}
@@ -220,8 +220,28 @@ func Hyphenate(nodelist node.Node, defaultLang *lang.Lang) {
 			wordstart = nil
 			wordboundary = false
 		}
+		if isExplicitHyphen(e) {
+			d := node.NewDisc()
+			d.Subtype = node.DiscExplicit
+			node.InsertAfter(nodelist, e, d)
+			e = d
+		}
 	}
 	if wordstart != nil {
 		insertBreakpoints(curlang, &b, wordstart, curfont)
 	}
 }
+
+// isExplicitHyphen reports whether n is a hyphen glyph inside a word, such as
+// in "well-known". The line may be broken after such a hyphen.
+func isExplicitHyphen(n node.Node) bool {
+	g, ok := n.(*node.Glyph)
+	if !ok || (g.Components != "-" && g.Components != "\u2010") {
+		return false
+	}
+	if _, ok := n.Prev().(*node.Glyph); !ok {
+		return false
+	}
+	next, ok := n.Next().(*node.Glyph)
+	return ok && next.Hyphenate
+}
@@ -114,3 +114,43 @@ func TestHyphenate(t *testing.T) {
 		head = head.Next()
 	}
 }
+
+func TestHyphenateExplicitHyphen(t *testing.T) {
+	var head, cur node.Node
+	for _, r := range "ab-cd -x" {
+		if r == ' ' {
+			n := node.NewGlue()
+			head = node.InsertAfter(head, cur, n)
+			cur = n
+			continue
+		}
+		n := node.NewGlyph()
+		n.Hyphenate = unicode.IsLetter(r)
+		n.Components = string(r)
+		head = node.InsertAfter(head, cur, n)
+		cur = n
+	}
+	var dummy bytes.Buffer
+	doc := document.NewDocument(&dummy)
+	l, err := doc.LoadPatternFile(filepath.Join("testdata", "hyph-en-us.pat.txt"), "dummylang")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	Hyphenate(head, l)
+	var discs []*node.Disc
+	for e := head; e != nil; e = e.Next() {
+		if d, ok := e.(*node.Disc); ok {
+			discs = append(discs, d)
+			if g, ok := e.Prev().(*node.Glyph); !ok || g.Components != "-" {
+				t.Errorf("explicit hyphen break does not follow the hyphen")
+			}
+		}
+	}
+	// The hyphen at the start of "-x" is not inside a word.
+	if len(discs) != 1 {
+		t.Fatalf("got %d discretionaries, want 1", len(discs))
+	}
+	if discs[0].Subtype != node.DiscExplicit {
+		t.Errorf("disc subtype is %d, want DiscExplicit", discs[0].Subtype)
+	}
+}
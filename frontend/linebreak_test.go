@@ -0,0 +1,115 @@
+package frontend
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/font"
+	"github.com/boxesandglue/boxesandglue/backend/lang"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/backend/text/linebreak"
+	"github.com/boxesandglue/boxesandglue/backend/text/segment"
+)
+
+func TestAtomBreaks(t *testing.T) {
+	atoms := func(components ...string) []font.Atom {
+		ret := make([]font.Atom, len(components))
+		for i, c := range components {
+			ret[i] = font.Atom{Components: c, IsSpace: c == " "}
+		}
+		return ret
+	}
+	got := atomBreaks("fi a/b 漢字", atoms("fi", " ", "a", "/", "b", " ", "漢", "字"), nil)
+	want := []linebreak.Break{linebreak.NoBreak, linebreak.NoBreak, linebreak.Allowed, linebreak.NoBreak, linebreak.Allowed, linebreak.NoBreak, linebreak.Allowed, linebreak.Allowed}
+	if len(got) != len(want) {
+		t.Fatalf("got %d breaks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("break before atom %d: %s, want %s", i, got[i], want[i])
+		}
+	}
+	// The shaper dropped a character.
+	if got := atomBreaks("a\u200Bb", atoms("a", "b"), nil); got != nil {
+		t.Errorf("atomBreaks returned %v for atoms that do not cover the text, want nil", got)
+	}
+}
+
+func TestAtomBreaksSegmenter(t *testing.T) {
+	seg, err := segment.NewFromReader(strings.NewReader("ภาษา\nไทย\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var atoms []font.Atom
+	for _, r := range "ภาษาไทย" {
+		atoms = append(atoms, font.Atom{Components: string(r)})
+	}
+	if got := atomBreaks("ภาษาไทย", atoms, nil); got[4] != linebreak.NoBreak {
+		t.Errorf("break before ไ without a segmenter: %s, want ×", got[4])
+	}
+	got := atomBreaks("ภาษาไทย", atoms, seg)
+	for i, b := range got {
+		want := linebreak.NoBreak
+		if i == 4 {
+			want = linebreak.Allowed
+		}
+		if b != want {
+			t.Errorf("break before atom %d: %s, want %s", i, b, want)
+		}
+	}
+}
+
+// TestFormatParagraphSegmenter sets Thai text in a narrow paragraph. The
+// word segmenter of the language from the Language option splits it into two
+// lines.
+func TestFormatParagraphSegmenter(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	ff := fe.NewFontFamily("text")
+	fs := &FontSource{Location: filepath.Join("..", "qa", "fonts", "upem", "fonts", "texgyreheros-regular.otf")}
+	if err = ff.AddMember(fs, FontWeight400, FontStyleNormal); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	seg, err := segment.NewFromReader(strings.NewReader("ภาษา\nไทย\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	thai := &lang.Lang{Name: "th", Segmenter: seg}
+	for _, tc := range []struct {
+		opts  []TypesettingOption
+		lines int
+	}{
+		{nil, 1},
+		{[]TypesettingOption{Language(thai)}, 2},
+	} {
+		te := NewText()
+		te.Settings[SettingFontFamily] = ff
+		te.Settings[SettingSize] = 10 * bag.Factor
+		child := NewText()
+		child.Items = append(child.Items, "ภาษาไทย")
+		te.Items = append(te.Items, child)
+		vl, _, err := fe.FormatParagraph(te, 10*bag.Factor, tc.opts...)
+		if err != nil {
+			t.Fatalf("FormatParagraph: %v", err)
+		}
+		lines := 0
+		for e := vl.List; e != nil; e = e.Next() {
+			if _, ok := e.(*node.HList); ok {
+				lines++
+			}
+		}
+		if lines != tc.lines {
+			t.Errorf("%d options: got %d lines, want %d", len(tc.opts), lines, tc.lines)
+		}
+		for _, x := range []*Text{te, child} {
+			if _, ok := x.Settings[SettingLanguage]; ok {
+				t.Error("FormatParagraph left SettingLanguage on the text")
+			}
+		}
+	}
+}
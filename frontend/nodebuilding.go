@@ -9,6 +9,8 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/boxesandglue/boxesandglue/backend/bag"
 	"github.com/boxesandglue/boxesandglue/backend/color"
@@ -17,6 +19,8 @@ import (
 	"github.com/boxesandglue/boxesandglue/backend/lang"
 	"github.com/boxesandglue/boxesandglue/backend/node"
 	"github.com/boxesandglue/boxesandglue/backend/text/bidi"
+	"github.com/boxesandglue/boxesandglue/backend/text/linebreak"
+	"github.com/boxesandglue/boxesandglue/backend/text/segment"
 	"github.com/boxesandglue/textshape/ot"
 )
 
@@ -174,7 +178,7 @@ const (
 	SettingDebug
 	// SettingDest defines a named PDF destination (anchor) for internal links.
 	SettingDest
-	// SettingFontExpansion is the amount of expansion / shrinkage allowed. Value is a float between 0 (no expansion) and 1 (100% of the glyph width).
+	// SettingFontExpansion is the amount of expansion / shrinkage allowed. Value is a float between 0 (no expansion) and 1 (100% of the glyph width) or a *node.FontExpansionSettings for per-glyph expansion factors and steps.
 	SettingFontExpansion
 	// SettingFontFamily selects a font family.
 	SettingFontFamily
@@ -191,7 +195,9 @@ const (
 	SettingFontVariationSettings
 	// SettingHAlign sets the horizontal alignment of the paragraph.
 	SettingHAlign
-	// SettingHangingPunctuation sets the margin protrusion.
+	// SettingHangingPunctuation sets the margin protrusion. The value is
+	// either a HangingPunctuation or the name of a protrusion set (see
+	// RegisterProtrusionSet).
 	SettingHangingPunctuation
 	// SettingHeight sets the height of a box if it should be vertically aligned.
 	SettingHeight
@@ -268,7 +274,9 @@ const (
 	// from the parent, Mknodes emits node.Lang markers around the sub-Text so
 	// the Hyphenate walker switches patterns for that run. CSS-level
 	// `hyphens: none` is encoded by setting SettingLanguage to a no-op
-	// language (see frontend.GetLanguage for unknown tags).
+	// language (see frontend.GetLanguage for unknown tags). The Segmenter of
+	// the language inserts break opportunities between the words of Thai,
+	// Lao, Khmer and Burmese text.
 	SettingLanguage
 	// SettingHyphens carries the CSS Text 3 `hyphens` keyword (string:
 	// "auto", "manual", or "none"). It controls only the soft-hyphen
@@ -295,6 +303,34 @@ const (
 	// long words in narrow columns). Default 0 disables it. Typical values
 	// are 1–3em of the body font size.
 	SettingLinebreakEmergencyStretch
+	// SettingTextAlignLast carries the alignment of the last line of a
+	// paragraph as HorizontalAlignment (CSS `text-align-last`).
+	// HAlignJustified justifies the last line, HAlignDefault (or no
+	// setting) aligns it like the other lines of a ragged paragraph and
+	// flush left in a justified one.
+	SettingTextAlignLast
+	// SettingFootnote attaches a footnote to a Text element. The value is a
+	// *Text with the footnote text. The items of the element are the
+	// footnote mark; without items the mark is the footnote number (see
+	// Document.Footnotes).
+	SettingFootnote
+	// SettingWritingMode sets the WritingMode of a paragraph. In the
+	// vertical writing modes the lines run from top to bottom.
+	SettingWritingMode
+	// SettingTextOrientation sets the TextOrientation of the glyphs in
+	// vertical writing modes.
+	SettingTextOrientation
+	// SettingRuby sets a ruby annotation (furigana) over the items of a
+	// Text element. The value is a string or a *Text with the ruby text.
+	SettingRuby
+	// SettingRubyAlign sets the RubyAlign of ruby annotations.
+	SettingRubyAlign
+	// SettingKashida enables kashida justification for Arabic text: the
+	// joining stroke before the last joined letter of each word stretches
+	// together with the inter-word glue and is filled with tatweel glyphs.
+	// The value is a bool (true stretches the kashida twice as much as an
+	// inter-word space) or the stretchability as bag.ScaledPoint.
+	SettingKashida
 )
 
 // Direction describes the writing direction of a paragraph.
@@ -455,6 +491,20 @@ func (st SettingType) String() string {
 		settingName = "SettingLinebreakTolerance"
 	case SettingLinebreakEmergencyStretch:
 		settingName = "SettingLinebreakEmergencyStretch"
+	case SettingTextAlignLast:
+		settingName = "SettingTextAlignLast"
+	case SettingFootnote:
+		settingName = "SettingFootnote"
+	case SettingWritingMode:
+		settingName = "SettingWritingMode"
+	case SettingTextOrientation:
+		settingName = "SettingTextOrientation"
+	case SettingRuby:
+		settingName = "SettingRuby"
+	case SettingRubyAlign:
+		settingName = "SettingRubyAlign"
+	case SettingKashida:
+		settingName = "SettingKashida"
 	default:
 		settingName = fmt.Sprintf("%d", st)
 	}
@@ -662,6 +712,35 @@ type Options struct {
 	Leading          bag.ScaledPoint
 	Tolerance        float64
 	EmergencyStretch bag.ScaledPoint
+	TextAlignLast    HorizontalAlignment
+	MinLastLineFill  float64
+
+	MaxConsecutiveHyphens int
+	// FinalHyphenDemerits, AdjDemerits and ExHyphenPenalty are nil unless
+	// set, so that 0 can switch them off.
+	FinalHyphenDemerits *int
+	AdjDemerits         *int
+	ExHyphenPenalty     *int
+	InterlineSpacing    node.InterlineSpacing
+	LineSkipLimit       bag.ScaledPoint
+	AlignToGrid         bool
+	GridOffset          bag.ScaledPoint
+	Floats              *FloatArea
+	parshape            []node.ParshapeLine
+}
+
+// applyDemerits copies the hyphenation demerits and penalties that are set
+// in p to ls.
+func (p *Options) applyDemerits(ls *node.LinebreakSettings) {
+	if p.ExHyphenPenalty != nil {
+		ls.ExHyphenPenalty = *p.ExHyphenPenalty
+	}
+	if p.FinalHyphenDemerits != nil {
+		ls.FinalHyphenDemerits = *p.FinalHyphenDemerits
+	}
+	if p.AdjDemerits != nil {
+		ls.DemeritsFitness = *p.AdjDemerits
+	}
 }
 
 // TypesettingOption controls the formatting of the paragraph.
@@ -715,6 +794,97 @@ func EmergencyStretch(es bag.ScaledPoint) TypesettingOption {
 	}
 }
 
+// TextAlignLast sets the alignment of the last line of the paragraph (CSS
+// `text-align-last`). Use HAlignJustified to justify the last line.
+func TextAlignLast(a HorizontalAlignment) TypesettingOption {
+	return func(p *Options) {
+		p.TextAlignLast = a
+	}
+}
+
+// MinLastLineFill sets the minimum length of the last line as a fraction of
+// the line width. The line breaker avoids shorter last lines if possible, a
+// value of 0.2 keeps the last line at 20% of hsize or more.
+func MinLastLineFill(ratio float64) TypesettingOption {
+	return func(p *Options) {
+		p.MinLastLineFill = ratio
+	}
+}
+
+// MaxConsecutiveHyphens limits the number of consecutive lines that end
+// with a hyphen (TeX's \doublehyphendemerits taken to the extreme). 0 means
+// no limit.
+func MaxConsecutiveHyphens(n int) TypesettingOption {
+	return func(p *Options) {
+		p.MaxConsecutiveHyphens = n
+	}
+}
+
+// FinalHyphenDemerits sets the demerits for hyphenating the second last line
+// of a paragraph (TeX's \finalhyphendemerits). Default is 0 (off), TeX uses
+// 5000.
+func FinalHyphenDemerits(d int) TypesettingOption {
+	return func(p *Options) {
+		p.FinalHyphenDemerits = &d
+	}
+}
+
+// AdjDemerits sets the demerits for adjacent lines with visually
+// incompatible spacing (TeX's \adjdemerits). Default is 100, 0 switches
+// them off.
+func AdjDemerits(d int) TypesettingOption {
+	return func(p *Options) {
+		p.AdjDemerits = &d
+	}
+}
+
+// ExHyphenPenalty sets the penalty for breaking after an explicit hyphen
+// (TeX's \exhyphenpenalty). Default is 50.
+func ExHyphenPenalty(penalty int) TypesettingOption {
+	return func(p *Options) {
+		p.ExHyphenPenalty = &penalty
+	}
+}
+
+// InterlineSpacing selects how the distance between the lines of the
+// paragraph is computed. node.InterlineBaselineSkip and
+// node.InterlineHalfLeading keep tall lines from colliding with the line
+// above.
+func InterlineSpacing(mode node.InterlineSpacing) TypesettingOption {
+	return func(p *Options) {
+		p.InterlineSpacing = mode
+	}
+}
+
+// LineSkipLimit sets the minimal distance between the bottom of a line and
+// the top of the next line (TeX's \lineskiplimit). It is only used with
+// node.InterlineBaselineSkip and node.InterlineHalfLeading.
+func LineSkipLimit(limit bag.ScaledPoint) TypesettingOption {
+	return func(p *Options) {
+		p.LineSkipLimit = limit
+	}
+}
+
+// AlignToGrid puts the baselines of the paragraph on the document's
+// BaselineGrid. offset is the distance from the grid origin's reference point
+// (usually the top of the page) to the top of the paragraph. Without a
+// BaselineGrid the option has no effect.
+func AlignToGrid(offset bag.ScaledPoint) TypesettingOption {
+	return func(p *Options) {
+		p.AlignToGrid = true
+		p.GridOffset = offset
+	}
+}
+
+// WrapFloats makes the paragraph flow around the floats of fa. The
+// paragraph starts at the current position of fa, which moves below the
+// paragraph. The lines are assumed to be as high as the leading.
+func WrapFloats(fa *FloatArea) TypesettingOption {
+	return func(p *Options) {
+		p.Floats = fa
+	}
+}
+
 // FontSize sets the font size for the paragraph.
 func FontSize(size bag.ScaledPoint) TypesettingOption {
 	return func(p *Options) {
@@ -873,6 +1043,61 @@ func preventBreakBeforeClosingPunctuation(head node.Node) node.Node {
 	return head
 }
 
+// atomBreaks returns the UAX #14 line break opportunity before each of the
+// atoms shaped from str. It returns nil if the atoms do not cover str
+// character by character, for example when the shaper dropped a character.
+// If seg is not nil, it adds the word boundaries of Thai, Lao, Khmer and
+// Burmese text.
+func atomBreaks(str string, atoms []font.Atom, seg *segment.Dictionary) []linebreak.Break {
+	runes := []rune(str)
+	breaks := linebreak.Breaks(runes)
+	if seg != nil {
+		// UAX #14 leaves the word boundaries of the SA class (Thai, Lao,
+		// Khmer, Burmese) to a dictionary.
+		for _, p := range seg.Segment(runes) {
+			if breaks[p-1] == linebreak.NoBreak && isSegmentable(runes[p-1]) && isSegmentable(runes[p]) && !unicode.In(runes[p], unicode.Mn, unicode.Mc) {
+				breaks[p-1] = linebreak.Allowed
+			}
+		}
+	}
+	ret := make([]linebreak.Break, len(atoms))
+	pos := 0
+	for i, a := range atoms {
+		if i > 0 && pos > 0 {
+			ret[i] = breaks[pos-1]
+		}
+		for _, c := range a.Components {
+			if pos >= len(runes) || runes[pos] != c {
+				return nil
+			}
+			pos++
+		}
+	}
+	if pos != len(runes) {
+		return nil
+	}
+	return ret
+}
+
+// isSegmentable reports whether the line breaks around r are found by a
+// dictionary.
+func isSegmentable(r rune) bool {
+	return linebreak.LookupClass(r) == linebreak.SA
+}
+
+// isHyphenChar reports whether s is a hyphen. Hyphenate inserts the break
+// after a hyphen in a word.
+func isHyphenChar(s string) bool {
+	return s == "-" || s == "\u2010"
+}
+
+// isIdeographicAtom reports whether the atom belongs to text that is set
+// without spaces, such as Chinese and Japanese.
+func isIdeographicAtom(a font.Atom) bool {
+	r, _ := utf8.DecodeRuneInString(a.Components)
+	return a.Upright || isUprightRune(r)
+}
+
 // isLineStartForbidden returns true for characters that should never appear
 // at the start of a line: closing brackets and closing quotation marks. The
 // list mirrors Unicode "Pe" (Punctuation, Close) plus the closing members of
@@ -901,6 +1126,8 @@ func isLineStartForbidden(s string) bool {
 
 // FormatParagraph creates a rectangular text from the data stored in the
 // Paragraph. It applies hyphenation to the node list.
+// With a vertical SettingWritingMode hsize is the length of the lines, the
+// returned box is hsize high.
 func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...TypesettingOption) (*node.VList, *ParagraphInfo, error) {
 	bag.Logger.Log(context.Background(), -8, "FormatParagraph")
 	if len(te.Items) == 0 {
@@ -934,6 +1161,11 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 			te.Settings[SettingDirection] = DirectionRTL
 		}
 	}
+	if tal, ok := te.Settings[SettingTextAlignLast]; ok {
+		if a, ok := tal.(HorizontalAlignment); ok {
+			p.TextAlignLast = a
+		}
+	}
 	// Resolve logical text-align (start/end) to physical (left/right) once
 	// the paragraph direction is known. CSS Text 3 §7: "start" maps to the
 	// line-start edge and "end" to the line-end edge of the inline-axis,
@@ -969,6 +1201,9 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 	for _, opt := range opts {
 		opt(p)
 	}
+	if p.TextAlignLast != HAlignDefault {
+		p.TextAlignLast = resolveLogicalAlignment(p.TextAlignLast, paraDir)
+	}
 	if p.Fontsize != 0 {
 		te.Settings[SettingSize] = p.Fontsize
 	}
@@ -1031,13 +1266,18 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 	var hlist, tail node.Node
 	var err error
 
-	hlist, tail, err = fe.Mknodes(te)
+	// The paragraph language from the Language option selects the word
+	// segmenter for text without SettingLanguage.
+	hlist, tail, err = fe.mknodes(te, p.Language)
 	if err != nil {
 		return nil, nil, err
 	}
 	if hlist == nil {
 		return node.NewVList(), nil, nil
 	}
+	if err = fe.formatFootnotes(hlist, p.hsize); err != nil {
+		return nil, nil, err
+	}
 
 	// A single start stop node (like a PDF dest)
 	if _, ok := hlist.(*node.StartStop); ok && hlist.Next() == nil {
@@ -1053,6 +1293,7 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 
 	Hyphenate(hlist, p.Language)
 	hlist = preventBreakBeforeClosingPunctuation(hlist)
+	resolveRubyOverhang(hlist)
 	node.AppendLineEndAfter(hlist, tail)
 
 	ls := node.NewLinebreakSettings()
@@ -1069,6 +1310,14 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 	if p.HyphenPenalty != 0 {
 		ls.Hyphenpenalty = p.HyphenPenalty
 	}
+	p.applyDemerits(ls)
+	ls.MaxConsecutiveHyphens = p.MaxConsecutiveHyphens
+	ls.InterlineSpacing = p.InterlineSpacing
+	ls.LineSkipLimit = p.LineSkipLimit
+	if p.AlignToGrid && fe.BaselineGrid != nil {
+		ls.Grid = fe.BaselineGrid
+		ls.GridOffset = p.GridOffset
+	}
 	// Settings-driven overrides (e.g. CSS -bag-linebreak-tolerance and
 	// -bag-linebreak-hyphen-penalty routed through htmlbag). The settings
 	// path takes precedence over the option-based defaults above so that
@@ -1089,14 +1338,24 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 		}
 	}
 	if hp, ok := te.Settings[SettingHangingPunctuation]; ok {
-		if hps, ok := hp.(HangingPunctuation); ok {
-			ls.HangingPunctuationEnd = hps&HangingPunctuationAllowEnd == 1
+		switch t := hp.(type) {
+		case HangingPunctuation:
+			ls.HangingPunctuationEnd = t&HangingPunctuationAllowEnd == 1
+		case string:
+			ps, ok := fe.protrusionSets[t]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown protrusion set %q", t)
+			}
+			ls.Protrusion = ps
 		}
 	}
 
 	if fe, ok := te.Settings[SettingFontExpansion]; ok {
-		if fef, ok := fe.(float64); ok {
-			ls.FontExpansion = fef
+		switch t := fe.(type) {
+		case float64:
+			ls.FontExpansion = t
+		case *node.FontExpansionSettings:
+			ls.Expansion = t
 		}
 	}
 
@@ -1125,7 +1384,48 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 		lg.Subtype = node.GlueLineStart
 		ls.LineStartGlue = lg
 	}
+	if p.TextAlignLast != HAlignDefault {
+		// The last line gets its own glue at both ends, so the paragraph
+		// fill glue must not add any stretch.
+		ls.ParFillSkip = node.NewGlue()
+		ls.LastLineStartGlue = node.NewGlue()
+		ls.LastLineEndGlue = node.NewGlue()
+		if p.TextAlignLast == HAlignLeft || p.TextAlignLast == HAlignCenter {
+			lg := node.NewGlue()
+			lg.Attributes = node.H{"origin": "glue last line end"}
+			lg.Stretch = bag.Factor
+			lg.StretchOrder = node.StretchFill
+			lg.Subtype = node.GlueLineEnd
+			ls.LastLineEndGlue = lg
+		}
+		if p.TextAlignLast == HAlignRight || p.TextAlignLast == HAlignCenter {
+			lg := node.NewGlue()
+			lg.Attributes = node.H{"origin": "glue last line start"}
+			lg.Stretch = bag.Factor
+			lg.StretchOrder = node.StretchFill
+			lg.Subtype = node.GlueLineStart
+			ls.LastLineStartGlue = lg
+		}
+	}
+	ls.MinLastLineFill = p.MinLastLineFill
+	var floatSkip bag.ScaledPoint
+	if p.parshape != nil {
+		ls.Parshape = p.parshape
+	} else if p.Floats != nil {
+		ls.Parshape, floatSkip = p.Floats.parshape(ls.HSize, ls.LineHeight, ls.Indent, ls.IndentRows)
+	}
 	vlist, info := node.Linebreak(hlist, ls)
+	if floatSkip > 0 {
+		// The first line has no room next to the floats.
+		k := node.NewKern()
+		k.Kern = floatSkip
+		k.Attributes = node.H{"origin": "below floats"}
+		vlist.List = node.InsertBefore(vlist.List, vlist.List, k)
+		vlist.Height += floatSkip
+	}
+	if p.Floats != nil {
+		p.Floats.Advance(vlist.Height + vlist.Depth)
+	}
 	for _, inf := range info {
 		pi.Widths = append(pi.Widths, inf.Width)
 	}
@@ -1138,10 +1438,16 @@ func (fe *Document) FormatParagraph(te *Text, hsize bag.ScaledPoint, opts ...Typ
 		}
 	}
 	bidiReorderVList(vlist, paragraphLevel)
+	setFootnoteLines(vlist)
 
 	for _, cb := range fe.postLinebreakCallback {
 		vlist = cb(vlist)
 	}
+	if wm, ok := te.Settings[SettingWritingMode].(WritingMode); ok && wm.IsVertical() {
+		if vlist, err = verticalParagraph(vlist, wm); err != nil {
+			return nil, nil, err
+		}
+	}
 	if htt, ok := te.Settings[SettingHeight]; ok {
 		if ht, ok := htt.(bag.ScaledPoint); ok {
 			moreHeight := ht - vlist.Height - vlist.Depth
@@ -1527,7 +1833,17 @@ func parseOpenTypeFeatures(featurelist any) []ot.Feature {
 // BuildNodelistFromString returns a node list containing glyphs from the string
 // with the settings in ts.
 func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string) (node.Node, error) {
+	return fe.buildNodelistFromString(ts, str, nil)
+}
+
+// buildNodelistFromString is BuildNodelistFromString with the language of the
+// surrounding text for the word segmenter. SettingLanguage in ts takes
+// precedence, nil is the document's default language.
+func (fe *Document) buildNodelistFromString(ts TypesettingSettings, str string, language *lang.Lang) (node.Node, error) {
 	bag.Logger.Log(context.Background(), -8, "Document#BuildNodelistFromString")
+	if language == nil {
+		language = fe.Doc.DefaultLanguage
+	}
 	fontweight := FontWeight400
 	fontstyle := FontStyleNormal
 	var fontfamily *FontFamily
@@ -1545,7 +1861,10 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 	letterSpacing := bag.ScaledPoint(0)
 	yoffset := bag.ScaledPoint(0)
 	direction := DirectionLTR
-	hyphensMode := "" // CSS hyphens: "" (auto), "auto", "manual", "none"
+	writingMode := WritingModeHorizontalTB
+	orientation := TextOrientationMixed
+	hyphensMode := ""                    // CSS hyphens: "" (auto), "auto", "manual", "none"
+	kashidaStretch := bag.ScaledPoint(0) // -1: the font's default
 	var settingFontFeatures []ot.Feature
 	for k, v := range ts {
 		switch k {
@@ -1628,14 +1947,39 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 			}
 		case SettingLanguage:
 			// consumed at the paragraph level (FormatParagraph) and at
-			// sub-Text boundaries (Mknodes); the glyph builder ignores it.
+			// sub-Text boundaries (Mknodes); the glyph builder only needs
+			// the word segmenter.
+			if l, ok := v.(*lang.Lang); ok && l != nil {
+				language = l
+			}
 		case SettingHyphens:
 			if s, ok := v.(string); ok {
 				hyphensMode = s
 			}
-		case SettingHyphenPenalty, SettingLinebreakTolerance, SettingLinebreakEmergencyStretch:
+		case SettingHyphenPenalty, SettingLinebreakTolerance, SettingLinebreakEmergencyStretch, SettingTextAlignLast:
 			// consumed at the paragraph level (FormatParagraph); the glyph
 			// builder ignores them.
+		case SettingFootnote, SettingRuby, SettingRubyAlign:
+			// consumed by Mknodes
+		case SettingWritingMode:
+			if wm, ok := v.(WritingMode); ok {
+				writingMode = wm
+			}
+		case SettingTextOrientation:
+			if to, ok := v.(TextOrientation); ok {
+				orientation = to
+			}
+		case SettingKashida:
+			switch t := v.(type) {
+			case bool:
+				if t {
+					kashidaStretch = -1
+				}
+			case bag.ScaledPoint:
+				kashidaStretch = t
+			default:
+				return nil, fmt.Errorf("SettingKashida: unknown type %T", v)
+			}
 		default:
 			return nil, fmt.Errorf("Unknown setting %v", k)
 		}
@@ -1699,12 +2043,15 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 		}
 		underlineStart.Action = node.ActionUserSetting
 	}
+	var colStart *node.StartStop
 	if col != nil {
-		colStart := node.NewStartStop()
+		colStart = node.NewStartStop()
 		colStart.Position = node.PDFOutputPage
 		colStart.ShipoutCallback = func(n node.Node) string {
 			return col.PDFStringNonStroking() + " "
 		}
+		// The backend sets the alpha of the color.
+		colStart.Value = col
 		if head != nil {
 			head = node.InsertAfter(head, head, colStart)
 		}
@@ -1717,7 +2064,26 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 	// by coverage, each segment is shaped with its own face, and the
 	// per-atom font is recorded in atomFonts. Single-family inputs
 	// (len(stack) < 2) keep the original single-shape path.
-	atoms, atomLevels, atomFonts := fe.shapeForBuild(fnt, str, fontfeatures, variations, direction, fontfamilyStack, fontweight, fontstyle, fontsize, fontfeatures, settingFontFeatures, settingVariations)
+	var atoms []font.Atom
+	var atomLevels []uint8
+	var atomFonts []*font.Font
+	if writingMode.IsVertical() {
+		atoms, atomLevels, atomFonts = shapeVertical(fnt, str, fontfeatures, variations, orientation)
+	} else {
+		atoms, atomLevels, atomFonts = fe.shapeForBuild(fnt, str, fontfeatures, variations, direction, fontfamilyStack, fontweight, fontstyle, fontsize, fontfeatures, settingFontFeatures, settingVariations)
+	}
+	var breaks []linebreak.Break
+	if !preserveWhitespace {
+		var seg *segment.Dictionary
+		if language != nil {
+			seg = language.Segmenter
+		}
+		breaks = atomBreaks(str, atoms, seg)
+	}
+	var kashida []bool
+	if kashidaStretch != 0 && !preserveWhitespace && !writingMode.IsVertical() {
+		kashida = kashidaPoints(atoms)
+	}
 	for i, r := range atoms {
 		atomFnt := atomFonts[i]
 		level := atomLevels[i]
@@ -1851,6 +2217,43 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 				lastglue = nil
 			}
 		} else {
+			if breaks != nil && i > 0 {
+				// UAX #14: forbid the break at a space that must not be
+				// broken (for example before "!" or after "("), allow a
+				// break between two characters (CJK text, after a dash
+				// or a slash).
+				if g, ok := cur.(*node.Glue); ok && breaks[i] == linebreak.NoBreak {
+					if pn, ok := g.Prev().(*node.Penalty); !ok || pn.Penalty < 10000 {
+						p := node.NewPenalty()
+						p.Penalty = 10000
+						head = node.InsertBefore(head, g, p)
+					}
+				} else if prev := atoms[i-1]; breaks[i] != linebreak.NoBreak && !prev.IsSpace && prev.Components != "­" && !isHyphenChar(prev.Components) {
+					if isIdeographicAtom(prev) || isIdeographicAtom(r) {
+						// Ideographic text has no spaces, the glue between
+						// the characters makes the lines justifiable.
+						g := node.NewGlue()
+						g.Attributes = node.H{"origin": "inter-character"}
+						g.Stretch = fnt.SpaceStretch / 4
+						head = node.InsertAfter(head, cur, g)
+						cur = g
+					} else {
+						p := node.NewPenalty()
+						head = node.InsertAfter(head, cur, p)
+						cur = p
+					}
+				}
+			}
+			if kashida != nil && kashida[i] && atomFnt == atomFonts[i-1] {
+				stretch := kashidaStretch
+				if stretch < 0 {
+					stretch = 2 * atomFnt.SpaceStretch
+				}
+				if k := kashidaGlue(atomFnt, stretch); k != nil {
+					head = node.InsertAfter(head, cur, k)
+					cur = node.Tail(k)
+				}
+			}
 			n := node.NewGlyph()
 			n.Hyphenate = r.Hyphenate
 			n.Codepoint = r.Codepoint
@@ -1867,8 +2270,9 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 			// emoji and CJK characters aligned with the surrounding Latin.
 			// For single-family runs atomFnt == fnt so the delta is zero.
 			n.XOffset = r.XOffset
+			n.Upright = r.Upright
 			baselineShift := bag.ScaledPoint(0)
-			if atomFnt != fnt {
+			if atomFnt != fnt && !r.Upright {
 				baselineShift = atomFnt.Depth - fnt.Depth
 			}
 			n.YOffset = yoffset + r.YOffset + baselineShift
@@ -1908,6 +2312,7 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 	if col != nil {
 		stop := node.NewStartStop()
 		stop.Position = node.PDFOutputPage
+		stop.StartNode = colStart
 		stop.ShipoutCallback = func(n node.Node) string {
 			return "0 0 0 RG 0 0 0 rg "
 		}
@@ -1935,10 +2340,19 @@ func (fe *Document) BuildNodelistFromString(ts TypesettingSettings, str string)
 // width. The returned head and the tail are the beginning and the end of the
 // node list.
 func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error) {
+	return fe.mknodes(ts, nil)
+}
+
+// mknodes is Mknodes with the language of the surrounding text, which applies
+// if ts has no SettingLanguage. nil is the document's default language.
+func (fe *Document) mknodes(ts *Text, language *lang.Lang) (head node.Node, tail node.Node, err error) {
 	bag.Logger.Log(context.Background(), -8, "Document#Mknodes")
 	if len(ts.Items) == 0 {
 		return nil, nil, nil
 	}
+	if l, ok := ts.Settings[SettingLanguage].(*lang.Lang); ok && l != nil {
+		language = l
+	}
 	newSettings := make(TypesettingSettings)
 	var nl, end node.Node
 	maps.Copy(newSettings, ts.Settings)
@@ -1976,7 +2390,7 @@ func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error
 				tail = endHL
 			}
 
-			nl, err = fe.BuildNodelistFromString(newSettings, t)
+			nl, err = fe.buildNodelistFromString(newSettings, t, language)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -2028,7 +2442,7 @@ func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error
 				// uses the atom's shaper-provided Advance instead of the
 				// font-wide Space default.
 				t.Settings[SettingPreserveWhitespace] = true
-				nl, err = fe.BuildNodelistFromString(t.Settings, leaderStr.(string))
+				nl, err = fe.buildNodelistFromString(t.Settings, leaderStr.(string), language)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -2044,6 +2458,42 @@ func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error
 				}
 				continue
 			}
+			// Footnote: the reference mark and an insert instead of the
+			// items.
+			if fn, ok := t.Settings[SettingFootnote]; ok {
+				body, ok := fn.(*Text)
+				if !ok {
+					return nil, nil, fmt.Errorf("SettingFootnote: unknown type %T", fn)
+				}
+				for k, v := range newSettings {
+					if _, found := t.Settings[k]; !found {
+						t.Settings[k] = v
+					}
+				}
+				nl, err = fe.buildFootnote(t, body)
+				if err != nil {
+					return nil, nil, err
+				}
+				head = node.InsertAfter(head, tail, nl)
+				tail = node.Tail(nl)
+				continue
+			}
+			// Ruby: the items are the base text of an unbreakable box
+			// with the ruby text above.
+			if ruby, ok := t.Settings[SettingRuby]; ok {
+				for k, v := range newSettings {
+					if _, found := t.Settings[k]; !found {
+						t.Settings[k] = v
+					}
+				}
+				nl, err = fe.buildRuby(t, ruby)
+				if err != nil {
+					return nil, nil, err
+				}
+				head = node.InsertAfter(head, tail, nl)
+				tail = node.Tail(nl)
+				continue
+			}
 			if hyperlinkStartNode == nil {
 				// we are within a hyperlink, so lets remove all startstop
 				if hlSetting, ok := t.Settings[SettingHyperlink]; ok {
@@ -2095,7 +2545,7 @@ func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error
 			// afterwards. Settings inheritance has already happened above, so
 			// child-without-explicit-lang inherits the parent's value and the
 			// pointers compare equal here — no spurious switch is emitted.
-			parentLang, _ := newSettings[SettingLanguage].(*lang.Lang)
+			parentLang := language
 			childLang, _ := t.Settings[SettingLanguage].(*lang.Lang)
 			needsLangSwitch := childLang != nil && childLang != parentLang
 
@@ -2106,7 +2556,7 @@ func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error
 				tail = opener
 			}
 
-			nl, end, err = fe.Mknodes(t)
+			nl, end, err = fe.mknodes(t, language)
 			// Restore the settings consumed above so a later
 			// re-formatting of the same Text (table measurement passes)
 			// still sees them.
@@ -2128,10 +2578,11 @@ func (fe *Document) Mknodes(ts *Text) (head node.Node, tail node.Node, err error
 			}
 
 			if needsLangSwitch {
-				// Restore the surrounding language. If the parent had no
-				// explicit SettingLanguage, the document default is what
-				// FormatParagraph started with — that's the language the
-				// run after this child should be hyphenated under.
+				// Restore the surrounding language. If neither the parent
+				// nor the paragraph has a language, the document default
+				// is what FormatParagraph started with — that's the
+				// language the run after this child should be hyphenated
+				// under.
 				closerLang := parentLang
 				if closerLang == nil {
 					closerLang = fe.Doc.DefaultLanguage
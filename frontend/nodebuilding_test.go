@@ -0,0 +1,23 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+func TestApplyDemerits(t *testing.T) {
+	ls := node.NewLinebreakSettings()
+	var p Options
+	p.applyDemerits(ls)
+	if ls.FinalHyphenDemerits != 0 || ls.DemeritsFitness != 100 || ls.ExHyphenPenalty != 50 {
+		t.Errorf("defaults changed: final %d, adj %d, exhyphen %d", ls.FinalHyphenDemerits, ls.DemeritsFitness, ls.ExHyphenPenalty)
+	}
+	for _, opt := range []TypesettingOption{FinalHyphenDemerits(5000), AdjDemerits(0), ExHyphenPenalty(0)} {
+		opt(&p)
+	}
+	p.applyDemerits(ls)
+	if ls.FinalHyphenDemerits != 5000 || ls.DemeritsFitness != 0 || ls.ExHyphenPenalty != 0 {
+		t.Errorf("got final %d, adj %d, exhyphen %d, want 5000, 0, 0", ls.FinalHyphenDemerits, ls.DemeritsFitness, ls.ExHyphenPenalty)
+	}
+}
@@ -0,0 +1,167 @@
+package frontend
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+// RubyAlign determines how the ruby text and the base text are distributed
+// when one of them is shorter than the other (CSS ruby-align).
+type RubyAlign int
+
+const (
+	// RubyAlignCenter centers the shorter text.
+	RubyAlignCenter RubyAlign = iota
+	// RubyAlignSpaceAround spreads the characters of the shorter text over
+	// the width, with half the space at the edges (the JIS X 4051 1:2:1
+	// rule).
+	RubyAlignSpaceAround
+)
+
+// The settings that a ruby text does not inherit from its base.
+var rubyIgnoredSettings = []SettingType{SettingRuby, SettingHyperlink, SettingDest, SettingPrepend, SettingFootnote, SettingYOffset}
+
+// buildRuby returns an unbreakable box with the items of t as the base text
+// and ruby (a string or a *Text) above it. The ruby text is set at half the
+// size of the base. If the ruby text is wider than the base, the box is
+// surrounded by negative kerns so that the ruby can overhang adjacent kana,
+// see resolveRubyOverhang.
+func (fe *Document) buildRuby(t *Text, ruby any) (node.Node, error) {
+	rt := NewText()
+	switch r := ruby.(type) {
+	case string:
+		rt.Items = append(rt.Items, r)
+	case *Text:
+		for k, v := range r.Settings {
+			rt.Settings[k] = v
+		}
+		rt.Items = r.Items
+	default:
+		return nil, fmt.Errorf("SettingRuby: unknown type %T", ruby)
+	}
+	size := 12 * bag.Factor
+	if sz, ok := t.Settings[SettingSize].(bag.ScaledPoint); ok {
+		size = sz
+	}
+	if _, ok := rt.Settings[SettingSize]; !ok {
+		rt.Settings[SettingSize] = size / 2
+	}
+	for k, v := range t.Settings {
+		if _, found := rt.Settings[k]; !found {
+			rt.Settings[k] = v
+		}
+	}
+	for _, k := range rubyIgnoredSettings {
+		delete(rt.Settings, k)
+	}
+	align, _ := t.Settings[SettingRubyAlign].(RubyAlign)
+
+	delete(t.Settings, SettingRuby)
+	baseList, _, err := fe.Mknodes(t)
+	t.Settings[SettingRuby] = ruby
+	if err != nil {
+		return nil, err
+	}
+	rtList, _, err := fe.Mknodes(rt)
+	if err != nil {
+		return nil, err
+	}
+	base, annotation := node.Hpack(baseList), node.Hpack(rtList)
+	wd := max(base.Width, annotation.Width)
+	overhang := bag.ScaledPoint(0)
+	if annotation.Width > base.Width {
+		overhang = min((annotation.Width-base.Width)/2, rt.Settings[SettingSize].(bag.ScaledPoint))
+	}
+	// For PDF/UA the box is tagged as Ruby with the children RB and RT. The
+	// backend attaches the Ruby element to the surrounding element.
+	se, rb, rtTag := fe.NewStructureElement("Ruby"), fe.NewStructureElement("RB"), fe.NewStructureElement("RT")
+	se.AddChild(rb)
+	se.AddChild(rtTag)
+	base = alignRuby(base, wd, align)
+	base.Attributes = node.H{"origin": "ruby base", "tag": rb}
+	annotation = alignRuby(annotation, wd, align)
+	annotation.Shift = base.Height + annotation.Depth
+	annotation.Attributes = node.H{"origin": "ruby text", "tag": rtTag}
+
+	k := node.NewKern()
+	k.Kern = -wd
+	node.InsertAfter(base, base, k)
+	node.InsertAfter(base, k, annotation)
+	box := node.Hpack(base)
+	box.Height = annotation.Shift + annotation.Height
+	box.Depth = base.Depth
+	box.Attributes = node.H{"origin": "ruby", "tag": se}
+	if overhang == 0 {
+		return box, nil
+	}
+	before, after := node.NewKern(), node.NewKern()
+	before.Kern, after.Kern = -overhang, -overhang
+	before.Attributes = node.H{"origin": "ruby overhang", "_rubyoverhang": "start"}
+	after.Attributes = node.H{"origin": "ruby overhang", "_rubyoverhang": "end"}
+	node.InsertAfter(before, before, box)
+	node.InsertAfter(before, box, after)
+	return before, nil
+}
+
+// alignRuby returns a box of width wd with the contents of hl aligned with
+// align.
+func alignRuby(hl *node.HList, wd bag.ScaledPoint, align RubyAlign) *node.HList {
+	if hl.Width == wd {
+		return hl
+	}
+	fil := func(stretch bag.ScaledPoint) *node.Glue {
+		g := node.NewGlue()
+		g.Stretch = stretch
+		g.StretchOrder = node.StretchFil
+		return g
+	}
+	head := hl.List
+	if head == nil {
+		return node.HpackTo(fil(bag.Factor), wd)
+	}
+	if align == RubyAlignSpaceAround {
+		for n := head; n != nil; n = n.Next() {
+			if n == head {
+				continue
+			}
+			switch n.(type) {
+			case *node.Glyph, *node.HList, *node.VList:
+				head = node.InsertBefore(head, n, fil(2*bag.Factor))
+			}
+		}
+	}
+	head = node.InsertBefore(head, head, fil(bag.Factor))
+	node.InsertAfter(head, node.Tail(head), fil(bag.Factor))
+	return node.HpackTo(head, wd)
+}
+
+// isKana reports whether s is a single hiragana or katakana character.
+func isKana(s string) bool {
+	r := []rune(s)
+	return len(r) == 1 && unicode.In(r[0], unicode.Hiragana, unicode.Katakana)
+}
+
+// resolveRubyOverhang removes the overhang of ruby texts unless the
+// neighbouring character is a kana.
+func resolveRubyOverhang(head node.Node) {
+	for n := head; n != nil; n = n.Next() {
+		k, ok := n.(*node.Kern)
+		if !ok {
+			continue
+		}
+		side, ok := k.Attributes["_rubyoverhang"].(string)
+		if !ok {
+			continue
+		}
+		neighbour := k.Prev()
+		if side == "end" {
+			neighbour = k.Next()
+		}
+		if g, ok := neighbour.(*node.Glyph); !ok || !isKana(g.Components) {
+			k.Kern = 0
+		}
+	}
+}
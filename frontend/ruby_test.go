@@ -0,0 +1,86 @@
+package frontend
+
+import (
+	"io"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/document"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+func TestBuildRuby(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	rt := NewText()
+	rt.Items = append(rt.Items, footnoteBox(30*bag.Factor))
+	base := NewText()
+	base.Settings[SettingSize] = 10 * bag.Factor
+	base.Settings[SettingRuby] = rt
+	base.Items = append(base.Items, footnoteBox(10*bag.Factor))
+
+	head, err := fe.buildRuby(base, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := base.Settings[SettingRuby]; !ok {
+		t.Error("buildRuby consumed SettingRuby")
+	}
+	before, ok := head.(*node.Kern)
+	if !ok || before.Kern != -5*bag.Factor {
+		t.Fatalf("want an overhang of 5pt (half the ruby size), got %v", head)
+	}
+	box := before.Next().(*node.HList)
+	if box.Width != 30*bag.Factor {
+		t.Errorf("box width %s, want 30pt", box.Width)
+	}
+	if want := 2 * 8 * bag.Factor; box.Height != want {
+		t.Errorf("box height %s, want %s", box.Height, want)
+	}
+	se, ok := box.Attributes["tag"].(*document.StructureElement)
+	if !ok || se.Role != "Ruby" || len(se.Children()) != 2 || se.Children()[0].Role != "RB" || se.Children()[1].Role != "RT" {
+		t.Errorf("want a Ruby structure element with RB and RT")
+	}
+	rb := box.List.(*node.HList)
+	if g, ok := rb.List.(*node.Glue); !ok || rb.Width != 30*bag.Factor || g.Width != 10*bag.Factor {
+		t.Errorf("the base is not centered under the ruby")
+	}
+
+	// The neighbours are no kana, so the ruby must not overhang.
+	resolveRubyOverhang(head)
+	if after := box.Next().(*node.Kern); before.Kern != 0 || after.Kern != 0 {
+		t.Errorf("overhang %s %s, want 0", before.Kern, after.Kern)
+	}
+}
+
+func TestAlignRubySpaceAround(t *testing.T) {
+	a, b := footnoteBox(10*bag.Factor), footnoteBox(10*bag.Factor)
+	node.InsertAfter(a, a, b)
+	hl := alignRuby(node.Hpack(a), 40*bag.Factor, RubyAlignSpaceAround)
+	// 1:2:1 distribution of the 20pt extra space.
+	var gaps []bag.ScaledPoint
+	for n := hl.List; n != nil; n = n.Next() {
+		if g, ok := n.(*node.Glue); ok {
+			gaps = append(gaps, g.Width)
+		}
+	}
+	want := []bag.ScaledPoint{5 * bag.Factor, 10 * bag.Factor, 5 * bag.Factor}
+	if len(gaps) != len(want) {
+		t.Fatalf("got %d glues, want %d", len(gaps), len(want))
+	}
+	for i := range want {
+		if gaps[i] != want[i] {
+			t.Errorf("glue %d: %s, want %s", i, gaps[i], want[i])
+		}
+	}
+}
+
+func TestIsKana(t *testing.T) {
+	for s, want := range map[string]bool{"の": true, "カ": true, "漢": false, "a": false, "のの": false} {
+		if got := isKana(s); got != want {
+			t.Errorf("isKana(%q) = %t, want %t", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package frontend
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+	"github.com/boxesandglue/svgreader"
+)
+
+// curveSegments is the number of straight lines a Bézier curve or an arc is
+// divided into.
+const curveSegments = 16
+
+type shapePoint struct {
+	x, y float64
+}
+
+// A Shape is an outline made of closed subpaths that text can be poured
+// into with FormatParagraphInShape. The coordinates are in points, x grows to
+// the right and y grows downwards as in SVG. The inside of the shape is
+// determined with the even-odd rule, so a subpath inside another one is a
+// hole.
+type Shape struct {
+	subpaths [][]shapePoint
+	cur      shapePoint
+}
+
+// NewShape creates an empty shape.
+func NewShape() *Shape {
+	return &Shape{}
+}
+
+// Moveto starts a new subpath at x, y.
+func (s *Shape) Moveto(x, y bag.ScaledPoint) *Shape {
+	s.moveto(shapePoint{x.ToPT(), y.ToPT()})
+	return s
+}
+
+// Lineto adds a straight line from the current point to x, y.
+func (s *Shape) Lineto(x, y bag.ScaledPoint) *Shape {
+	s.lineto(shapePoint{x.ToPT(), y.ToPT()})
+	return s
+}
+
+// Curveto adds a cubic Bézier curve from the current point to x, y with the
+// control points c1 and c2.
+func (s *Shape) Curveto(c1x, c1y, c2x, c2y, x, y bag.ScaledPoint) *Shape {
+	s.curveto(shapePoint{c1x.ToPT(), c1y.ToPT()}, shapePoint{c2x.ToPT(), c2y.ToPT()}, shapePoint{x.ToPT(), y.ToPT()})
+	return s
+}
+
+// Close closes the current subpath. Subpaths are always treated as closed,
+// Close only resets the current point to the start of the subpath.
+func (s *Shape) Close() *Shape {
+	if n := len(s.subpaths); n > 0 && len(s.subpaths[n-1]) > 0 {
+		s.cur = s.subpaths[n-1][0]
+	}
+	return s
+}
+
+func (s *Shape) moveto(p shapePoint) {
+	s.subpaths = append(s.subpaths, []shapePoint{p})
+	s.cur = p
+}
+
+func (s *Shape) lineto(p shapePoint) {
+	if len(s.subpaths) == 0 {
+		s.moveto(s.cur)
+	}
+	n := len(s.subpaths) - 1
+	s.subpaths[n] = append(s.subpaths[n], p)
+	s.cur = p
+}
+
+func (s *Shape) curveto(c1, c2, p shapePoint) {
+	p0 := s.cur
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		mt := 1 - t
+		a, b, c, d := mt*mt*mt, 3*mt*mt*t, 3*mt*t*t, t*t*t
+		s.lineto(shapePoint{
+			a*p0.x + b*c1.x + c*c2.x + d*p.x,
+			a*p0.y + b*c1.y + c*c2.y + d*p.y,
+		})
+	}
+}
+
+// arcto adds an SVG elliptical arc from the current point to p (SVG 1.1
+// appendix F.6.5).
+func (s *Shape) arcto(rx, ry, phi float64, largeArc, sweep bool, p shapePoint) {
+	p0 := s.cur
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || p0 == p {
+		s.lineto(p)
+		return
+	}
+	sinPhi, cosPhi := math.Sincos(phi * math.Pi / 180)
+	dx, dy := (p0.x-p.x)/2, (p0.y-p.y)/2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	f := math.Sqrt(math.Max(0, num/den))
+	if largeArc == sweep {
+		f = -f
+	}
+	cx1, cy1 := f*rx*y1/ry, -f*ry*x1/rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + (p0.x+p.x)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + (p0.y+p.y)/2
+	theta := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	delta := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx) - theta
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+	for i := 1; i < curveSegments; i++ {
+		sin, cos := math.Sincos(theta + delta*float64(i)/curveSegments)
+		s.lineto(shapePoint{
+			cx + cosPhi*rx*cos - sinPhi*ry*sin,
+			cy + sinPhi*rx*cos + cosPhi*ry*sin,
+		})
+	}
+	s.lineto(p)
+}
+
+// ShapeFromSVGPath creates a shape from SVG path data (the d attribute of a
+// path element). One user unit is one point.
+func ShapeFromSVGPath(d string) (*Shape, error) {
+	cmds, err := svgreader.ParsePathData(d)
+	if err != nil {
+		return nil, err
+	}
+	cmds = svgreader.ExpandShorthands(svgreader.ResolveToAbsolute(cmds))
+	s := NewShape()
+	for _, c := range cmds {
+		a := c.Args
+		switch c.Cmd {
+		case 'M':
+			s.moveto(shapePoint{a[0], a[1]})
+		case 'L':
+			s.lineto(shapePoint{a[0], a[1]})
+		case 'H':
+			s.lineto(shapePoint{a[0], s.cur.y})
+		case 'V':
+			s.lineto(shapePoint{s.cur.x, a[0]})
+		case 'C':
+			s.curveto(shapePoint{a[0], a[1]}, shapePoint{a[2], a[3]}, shapePoint{a[4], a[5]})
+		case 'Q':
+			c1x, c1y, c2x, c2y := svgreader.QuadToCubic(s.cur.x, s.cur.y, a[0], a[1], a[2], a[3])
+			s.curveto(shapePoint{c1x, c1y}, shapePoint{c2x, c2y}, shapePoint{a[2], a[3]})
+		case 'A':
+			s.arcto(a[0], a[1], a[2], a[3] != 0, a[4] != 0, shapePoint{a[5], a[6]})
+		case 'Z':
+			s.Close()
+		}
+	}
+	return s, nil
+}
+
+// ShapeFromPDFDraw creates a shape from the path construction operators (m,
+// l, c, v, y, re and h) of pd. All other operators are ignored. The PDF
+// coordinate system has y growing upwards, so the origin of the drawing is
+// the top left corner of the shape and the shape extends to negative y
+// values.
+func ShapeFromPDFDraw(pd *pdfdraw.Object) (*Shape, error) {
+	s := NewShape()
+	var operands []float64
+	want := map[string]int{"m": 2, "l": 2, "c": 6, "v": 4, "y": 4, "re": 4, "h": 0}
+	pt := func(i int) shapePoint {
+		return shapePoint{operands[i], -operands[i+1]}
+	}
+	for _, tok := range strings.Fields(pd.String()) {
+		if f, err := strconv.ParseFloat(tok, 64); err == nil {
+			operands = append(operands, f)
+			continue
+		}
+		if n, ok := want[tok]; ok && len(operands) != n {
+			return nil, fmt.Errorf("ShapeFromPDFDraw: operator %s needs %d operands, got %d", tok, n, len(operands))
+		}
+		switch tok {
+		case "m":
+			s.moveto(pt(0))
+		case "l":
+			s.lineto(pt(0))
+		case "c":
+			s.curveto(pt(0), pt(2), pt(4))
+		case "v":
+			s.curveto(s.cur, pt(0), pt(2))
+		case "y":
+			s.curveto(pt(0), pt(2), pt(2))
+		case "re":
+			x, y, wd, ht := operands[0], -operands[1], operands[2], -operands[3]
+			s.moveto(shapePoint{x, y})
+			s.lineto(shapePoint{x + wd, y})
+			s.lineto(shapePoint{x + wd, y + ht})
+			s.lineto(shapePoint{x, y + ht})
+			s.Close()
+		case "h":
+			s.Close()
+		}
+		operands = operands[:0]
+	}
+	return s, nil
+}
+
+// bounds returns the smallest and the largest y value of the shape.
+func (s *Shape) bounds() (top, bottom bag.ScaledPoint) {
+	first := true
+	for _, sp := range s.subpaths {
+		for _, p := range sp {
+			y := bag.ScaledPointFromFloat(p.y)
+			if first || y < top {
+				top = y
+			}
+			if first || y > bottom {
+				bottom = y
+			}
+			first = false
+		}
+	}
+	return top, bottom
+}
+
+// ShapeInterval is a horizontal range inside a shape.
+type ShapeInterval struct {
+	Left  bag.ScaledPoint
+	Right bag.ScaledPoint
+}
+
+// Width returns the width of the interval.
+func (si ShapeInterval) Width() bag.ScaledPoint {
+	return si.Right - si.Left
+}
+
+// intervalsAt returns the intervals inside the shape on the horizontal line
+// at y.
+func (s *Shape) intervalsAt(y float64) []ShapeInterval {
+	var xs []float64
+	for _, sp := range s.subpaths {
+		for i, p0 := range sp {
+			p1 := sp[(i+1)%len(sp)]
+			if (p0.y <= y && y < p1.y) || (p1.y <= y && y < p0.y) {
+				xs = append(xs, p0.x+(y-p0.y)*(p1.x-p0.x)/(p1.y-p0.y))
+			}
+		}
+	}
+	slices.Sort(xs)
+	var ret []ShapeInterval
+	for i := 0; i+1 < len(xs); i += 2 {
+		ret = append(ret, ShapeInterval{bag.ScaledPointFromFloat(xs[i]), bag.ScaledPointFromFloat(xs[i+1])})
+	}
+	return ret
+}
+
+// intersectIntervals returns the ranges that are in a and in b.
+func intersectIntervals(a, b []ShapeInterval) []ShapeInterval {
+	var ret []ShapeInterval
+	for _, ia := range a {
+		for _, ib := range b {
+			if l, r := max(ia.Left, ib.Left), min(ia.Right, ib.Right); l < r {
+				ret = append(ret, ShapeInterval{l, r})
+			}
+		}
+	}
+	return ret
+}
+
+// Intervals returns the horizontal ranges from left to right that are inside
+// the shape over the whole height of a line from top to top+height.
+func (s *Shape) Intervals(top, height bag.ScaledPoint) []ShapeInterval {
+	bottom := top + height - 1
+	ys := []float64{top.ToPT(), bottom.ToPT()}
+	for _, sp := range s.subpaths {
+		for _, p := range sp {
+			if p.y > top.ToPT() && p.y < bottom.ToPT() {
+				ys = append(ys, p.y)
+			}
+		}
+	}
+	ret := s.intervalsAt(ys[0])
+	for _, y := range ys[1:] {
+		if len(ret) == 0 {
+			break
+		}
+		ret = intersectIntervals(ret, s.intervalsAt(y))
+	}
+	return ret
+}
+
+// ShapeMode determines how FormatParagraphInShape uses lines that the shape
+// divides into several intervals.
+type ShapeMode int
+
+const (
+	// ShapeWidest uses only the widest interval of each line.
+	ShapeWidest ShapeMode = iota
+	// ShapeSplit fills all intervals of a line from left to right, each
+	// with its own line of text.
+	ShapeSplit
+)
+
+// ShapeSettings controls FormatParagraphInShape.
+type ShapeSettings struct {
+	Mode ShapeMode
+	// MinWidth is the narrowest interval that takes text. Narrower
+	// intervals stay empty.
+	MinWidth bag.ScaledPoint
+}
+
+// shapeSlot is an interval in the row of a shape that takes one line of
+// text.
+type shapeSlot struct {
+	row      int
+	interval ShapeInterval
+}
+
+// slots returns the intervals for the lines of a paragraph in reading order.
+func (s *Shape) slots(top, bottom, lineHeight bag.ScaledPoint, ss ShapeSettings) []shapeSlot {
+	var ret []shapeSlot
+	for row := 0; top+bag.ScaledPoint(row)*lineHeight < bottom; row++ {
+		var usable []ShapeInterval
+		for _, iv := range s.Intervals(top+bag.ScaledPoint(row)*lineHeight, lineHeight) {
+			if iv.Width() > 0 && iv.Width() >= ss.MinWidth {
+				usable = append(usable, iv)
+			}
+		}
+		if len(usable) == 0 {
+			continue
+		}
+		if ss.Mode == ShapeWidest {
+			widest := usable[0]
+			for _, iv := range usable[1:] {
+				if iv.Width() > widest.Width() {
+					widest = iv
+				}
+			}
+			usable = usable[:1]
+			usable[0] = widest
+		}
+		for _, iv := range usable {
+			ret = append(ret, shapeSlot{row: row, interval: iv})
+		}
+	}
+	return ret
+}
+
+// paragraphLineHeight returns the distance of the baselines that
+// FormatParagraph uses for te with the options.
+func paragraphLineHeight(te *Text, opts []TypesettingOption) bag.ScaledPoint {
+	p := &Options{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.Leading != 0 {
+		return p.Leading
+	}
+	if l, ok := te.Settings[SettingLeading].(bag.ScaledPoint); ok {
+		return l
+	}
+	return p.Fontsize * 120 / 100
+}
+
+// FormatParagraphInShape pours te into the shape. Every line of the
+// paragraph is as high as the leading, the first line is at the top of the
+// shape. The lines get the width of the interval the shape leaves at their
+// position and a ShiftX that moves them to the interval, so the top left
+// corner of the returned VList must be placed at x = 0 and the topmost y of
+// the shape. Lines that are
+// split into several intervals (ShapeSplit) are combined into one HList per
+// line. Other nodes between the lines, such as marks and inserts, follow the
+// row of the line they come after. Text that does not fit into the shape
+// continues below it in the last interval.
+func (fe *Document) FormatParagraphInShape(te *Text, shape *Shape, ss ShapeSettings, opts ...TypesettingOption) (*node.VList, *ParagraphInfo, error) {
+	lineHeight := paragraphLineHeight(te, opts)
+	if lineHeight <= 0 {
+		return nil, nil, fmt.Errorf("FormatParagraphInShape: the line height must be positive, use the Leading option")
+	}
+	top, bottom := shape.bounds()
+	slots := shape.slots(top, bottom, lineHeight, ss)
+	if len(slots) == 0 {
+		return nil, nil, fmt.Errorf("FormatParagraphInShape: the shape has no room for text")
+	}
+	parshape := make([]node.ParshapeLine, len(slots))
+	var hsize bag.ScaledPoint
+	for i, sl := range slots {
+		parshape[i] = node.ParshapeLine{Width: sl.interval.Width()}
+		hsize = max(hsize, sl.interval.Width())
+	}
+	opts = append(opts, Leading(lineHeight), func(p *Options) { p.parshape = parshape })
+	vl, pi, err := fe.FormatParagraph(te, hsize, opts...)
+	if err != nil || vl == nil {
+		return vl, pi, err
+	}
+
+	var head, tail node.Node
+	add := func(n node.Node) {
+		n.SetPrev(nil)
+		n.SetNext(nil)
+		head = node.InsertAfter(head, tail, n)
+		tail = n
+	}
+	var pos bag.ScaledPoint
+	moveTo := func(y bag.ScaledPoint) {
+		if y != pos {
+			k := node.NewKern()
+			k.Kern = y - pos
+			k.Attributes = node.H{"origin": "shape row"}
+			add(k)
+			pos = y
+		}
+	}
+	// Nodes other than lines (marks, inserts, …) follow the row of the line
+	// they come after.
+	var others []node.Node
+	addOthers := func() {
+		for _, n := range others {
+			add(n)
+			_, ht, dp := n.Sizes(node.Vertical)
+			pos += ht + dp
+		}
+		others = others[:0]
+	}
+	var row []*node.HList
+	var rowSlots []shapeSlot
+	flushRow := func() {
+		if len(row) == 0 {
+			return
+		}
+		moveTo(bag.ScaledPoint(rowSlots[0].row) * lineHeight)
+		var out *node.HList
+		if len(row) == 1 {
+			out = row[0]
+		} else {
+			var rhead, rtail node.Node
+			x := rowSlots[0].interval.Left
+			for i, line := range row {
+				if i > 0 {
+					k := node.NewKern()
+					k.Kern = rowSlots[i].interval.Left - x
+					rhead = node.InsertAfter(rhead, rtail, k)
+					rtail = k
+				}
+				line.SetPrev(nil)
+				line.SetNext(nil)
+				rhead = node.InsertAfter(rhead, rtail, line)
+				rtail = line
+				x = rowSlots[i].interval.Left + line.Width
+			}
+			out = node.Hpack(rhead)
+			out.Attributes = node.H{"origin": "shape row"}
+		}
+		out.ShiftX = rowSlots[0].interval.Left
+		add(out)
+		pos += out.Height + out.Depth
+		row, rowSlots = row[:0], rowSlots[:0]
+		addOthers()
+	}
+	lineno := 0
+	for e := vl.List; e != nil; {
+		next := e.Next()
+		switch v := e.(type) {
+		case *node.HList:
+			sl := slots[min(lineno, len(slots)-1)]
+			if lineno >= len(slots) {
+				sl.row += lineno - len(slots) + 1
+			}
+			if len(rowSlots) > 0 && rowSlots[0].row != sl.row {
+				flushRow()
+			}
+			row = append(row, v)
+			rowSlots = append(rowSlots, sl)
+			lineno++
+		case *node.Glue, *node.Kern, *node.Penalty:
+			// The rows are positioned with kerns.
+		default:
+			others = append(others, e)
+			if len(row) == 0 {
+				addOthers()
+			}
+		}
+		e = next
+	}
+	flushRow()
+	addOthers()
+	if lineno > len(slots) {
+		bag.Logger.Warn("FormatParagraphInShape: text does not fit into the shape", "lines", lineno, "slots", len(slots))
+	}
+	if head == nil {
+		return vl, pi, nil
+	}
+	ret := node.Vpack(head)
+	ret.Attributes = vl.Attributes
+	return ret, pi, nil
+}
@@ -0,0 +1,163 @@
+package frontend
+
+import (
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/boxesandglue/frontend/pdfdraw"
+)
+
+// squareWithHole is a square of 100pt with a hole from x = 30 to 60 and y =
+// 20 to 80.
+const squareWithHole = "M0 0 H100 V100 H0 Z M30 20 H60 V80 H30 Z"
+
+func TestShapeIntervals(t *testing.T) {
+	s, err := ShapeFromSVGPath(squareWithHole)
+	if err != nil {
+		t.Fatalf("ShapeFromSVGPath: %v", err)
+	}
+	pt := bag.Factor
+	data := []struct {
+		top  bag.ScaledPoint
+		want []ShapeInterval
+	}{
+		{0, []ShapeInterval{{0, 100 * pt}}},
+		{15 * pt, []ShapeInterval{{0, 30 * pt}, {60 * pt, 100 * pt}}},
+		{40 * pt, []ShapeInterval{{0, 30 * pt}, {60 * pt, 100 * pt}}},
+		{90 * pt, []ShapeInterval{{0, 100 * pt}}},
+		{100 * pt, nil},
+	}
+	for _, d := range data {
+		if got := s.Intervals(d.top, 10*pt); !slices.Equal(got, d.want) {
+			t.Errorf("Intervals(%s) = %v, want %v", d.top, got, d.want)
+		}
+	}
+
+	// A triangle gets narrower towards the top, the whole line must fit.
+	s, err = ShapeFromSVGPath("M50 0 L100 100 L0 100 Z")
+	if err != nil {
+		t.Fatalf("ShapeFromSVGPath: %v", err)
+	}
+	if got, want := s.Intervals(50*pt, 10*pt), []ShapeInterval{{25 * pt, 75 * pt}}; !slices.Equal(got, want) {
+		t.Errorf("triangle Intervals = %v, want %v", got, want)
+	}
+
+	// PDF coordinates grow upwards.
+	s, err = ShapeFromPDFDraw(pdfdraw.New().Rect(10*pt, -50*pt, 80*pt, 50*pt))
+	if err != nil {
+		t.Fatalf("ShapeFromPDFDraw: %v", err)
+	}
+	if top, bottom := s.bounds(); top != 0 || bottom != 50*pt {
+		t.Errorf("bounds = %s, %s, want 0, 50", top, bottom)
+	}
+	if got, want := s.Intervals(20*pt, 10*pt), []ShapeInterval{{10 * pt, 90 * pt}}; !slices.Equal(got, want) {
+		t.Errorf("pdfdraw Intervals = %v, want %v", got, want)
+	}
+}
+
+// shapeText returns a paragraph of n boxes of 8pt separated by stretchable
+// glue.
+func shapeText(n int) *Text {
+	te := NewText()
+	for i := range n {
+		if i > 0 {
+			g := node.NewGlue()
+			g.Width = 2 * bag.Factor
+			g.Stretch = 10 * bag.Factor
+			te.Items = append(te.Items, g)
+		}
+		te.Items = append(te.Items, footnoteBox(8*bag.Factor))
+	}
+	return te
+}
+
+func TestFormatParagraphInShape(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	s, err := ShapeFromSVGPath(squareWithHole)
+	if err != nil {
+		t.Fatalf("ShapeFromSVGPath: %v", err)
+	}
+	pt := bag.Factor
+
+	vl, _, err := fe.FormatParagraphInShape(shapeText(60), s, ShapeSettings{Mode: ShapeWidest}, Leading(10*pt))
+	if err != nil {
+		t.Fatalf("FormatParagraphInShape: %v", err)
+	}
+	var lines []*node.HList
+	for e := vl.List; e != nil; e = e.Next() {
+		if hl, ok := e.(*node.HList); ok {
+			lines = append(lines, hl)
+		}
+	}
+	if len(lines) < 3 {
+		t.Fatalf("got %d lines, want at least 3", len(lines))
+	}
+	// The first two lines are above the hole, the third line uses the
+	// wider interval right of the hole.
+	for i, want := range []ShapeInterval{{0, 100 * pt}, {0, 100 * pt}, {60 * pt, 100 * pt}} {
+		if lines[i].ShiftX != want.Left || lines[i].Width != want.Width() {
+			t.Errorf("line %d: shift %s width %s, want %s %s", i, lines[i].ShiftX, lines[i].Width, want.Left, want.Width())
+		}
+	}
+
+	vl, _, err = fe.FormatParagraphInShape(shapeText(60), s, ShapeSettings{Mode: ShapeSplit}, Leading(10*pt))
+	if err != nil {
+		t.Fatalf("FormatParagraphInShape: %v", err)
+	}
+	var row *node.HList
+	for e := vl.List; e != nil && row == nil; e = e.Next() {
+		if hl, ok := e.(*node.HList); ok && hl.Attributes["origin"] == "shape row" {
+			row = hl
+		}
+	}
+	if row == nil {
+		t.Fatal("no split row found")
+	}
+	var widths []bag.ScaledPoint
+	for e := row.List; e != nil; e = e.Next() {
+		if hl, ok := e.(*node.HList); ok {
+			widths = append(widths, hl.Width)
+		}
+	}
+	if want := []bag.ScaledPoint{30 * pt, 40 * pt}; row.ShiftX != 0 || row.Width != 100*pt || !slices.Equal(widths, want) {
+		t.Errorf("split row: shift %s width %s lines %v, want 0 100 %v", row.ShiftX, row.Width, widths, want)
+	}
+
+	if _, _, err = fe.FormatParagraphInShape(shapeText(3), NewShape(), ShapeSettings{}, Leading(10*pt)); err == nil {
+		t.Error("empty shape: no error")
+	}
+}
+
+// TestFormatParagraphInShapeMarks puts a mark after the first line of the
+// paragraph. It stays after the first line.
+func TestFormatParagraphInShapeMarks(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	m := node.NewMark("section", "1")
+	err = fe.RegisterCallback(CallbackPostLinebreak, PostLinebreakCallbackFunc(func(vl *node.VList) *node.VList {
+		node.InsertAfter(vl.List, vl.List, m)
+		return vl
+	}))
+	if err != nil {
+		t.Fatalf("RegisterCallback: %v", err)
+	}
+	s, err := ShapeFromSVGPath(squareWithHole)
+	if err != nil {
+		t.Fatalf("ShapeFromSVGPath: %v", err)
+	}
+	vl, _, err := fe.FormatParagraphInShape(shapeText(60), s, ShapeSettings{Mode: ShapeWidest}, Leading(10*bag.Factor))
+	if err != nil {
+		t.Fatalf("FormatParagraphInShape: %v", err)
+	}
+	if _, ok := vl.List.(*node.HList); !ok || vl.List.Next() != m {
+		t.Error("the mark does not follow the first line")
+	}
+}
@@ -463,6 +463,7 @@ func (row *TableRow) calculateWidths() ([]bag.ScaledPoint, []bag.ScaledPoint, []
 func (row *TableRow) build() (*node.HList, error) {
 	var head node.Node
 	var tail node.Node
+	inRowspan := false
 	for x := 0; x < row.table.nCol; x++ {
 		cellptr := row.table.cellMatrix[x][row.row]
 		if cellptr.cell == nil {
@@ -478,6 +479,7 @@ func (row *TableRow) build() (*node.HList, error) {
 			x += cellptr.cell.ExtraColspan
 		} else {
 			// dummy cell because of rowspan
+			inRowspan = true
 			g := node.NewGlue()
 			g.Stretch = bag.Factor
 			g.StretchOrder = 1
@@ -491,6 +493,10 @@ func (row *TableRow) build() (*node.HList, error) {
 	}
 	hl := node.Hpack(head)
 	hl.Attributes = node.H{"origin": "table row"}
+	if inRowspan {
+		// node.Vsplit must not split the table before this row.
+		hl.Attributes["_inRowspan"] = true
+	}
 	return hl, nil
 }
 
@@ -0,0 +1,183 @@
+package frontend
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/boxesandglue/boxesandglue/backend/font"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// WritingMode is the direction in which lines run and stack (CSS
+// writing-mode).
+type WritingMode int
+
+const (
+	// WritingModeHorizontalTB is the default writing mode. Lines run
+	// horizontally and stack from top to bottom.
+	WritingModeHorizontalTB WritingMode = iota
+	// WritingModeVerticalRL is the writing mode of Chinese and Japanese
+	// tategaki. Lines run from top to bottom and stack from right to left.
+	WritingModeVerticalRL
+	// WritingModeVerticalLR is the writing mode of traditional Mongolian.
+	// Lines run from top to bottom and stack from left to right.
+	WritingModeVerticalLR
+)
+
+func (wm WritingMode) String() string {
+	switch wm {
+	case WritingModeHorizontalTB:
+		return "horizontal-tb"
+	case WritingModeVerticalRL:
+		return "vertical-rl"
+	case WritingModeVerticalLR:
+		return "vertical-lr"
+	}
+	return fmt.Sprintf("WritingMode(%d)", int(wm))
+}
+
+// IsVertical reports whether the lines run from top to bottom.
+func (wm WritingMode) IsVertical() bool {
+	return wm == WritingModeVerticalRL || wm == WritingModeVerticalLR
+}
+
+// TextOrientation determines the orientation of the glyphs in a vertical
+// line (CSS text-orientation).
+type TextOrientation int
+
+const (
+	// TextOrientationMixed sets the characters of the CJK scripts upright
+	// and turns the other characters (Latin, digits, Mongolian)
+	// clockwise.
+	TextOrientationMixed TextOrientation = iota
+	// TextOrientationUpright sets all characters upright.
+	TextOrientationUpright
+	// TextOrientationSideways turns all characters clockwise.
+	TextOrientationSideways
+)
+
+func (to TextOrientation) String() string {
+	switch to {
+	case TextOrientationMixed:
+		return "mixed"
+	case TextOrientationUpright:
+		return "upright"
+	case TextOrientationSideways:
+		return "sideways"
+	}
+	return fmt.Sprintf("TextOrientation(%d)", int(to))
+}
+
+// isUprightRune reports whether r stands upright in a vertical line with
+// TextOrientationMixed. This is a simplification of the Unicode property
+// Vertical_Orientation (UAX #50): the CJK scripts, their punctuation and the
+// fullwidth forms are upright.
+func isUprightRune(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo):
+		return true
+	case r >= 0x3000 && r <= 0x303F: // CJK symbols and punctuation
+		return true
+	case r >= 0x30FC && r <= 0x30FE: // prolonged sound mark, iteration marks
+		return true
+	case r >= 0xFF01 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6: // fullwidth forms
+		return true
+	case r >= 0x3200 && r <= 0x33FF: // enclosed CJK letters, CJK compatibility
+		return true
+	}
+	return false
+}
+
+// shapeVertical shapes str for a vertical line. The text is split into runs
+// of upright and sideways characters according to orient. Upright runs are
+// shaped top to bottom with the vertical alternates and metrics of the font,
+// sideways runs are shaped left to right and centered on the line, so that
+// they appear turned clockwise. Vertical text is not reordered, all bidi
+// levels are 0.
+func shapeVertical(fnt *font.Font, str string, features []ot.Feature, variations map[string]float64, orient TextOrientation) ([]font.Atom, []uint8, []*font.Font) {
+	if str == "" {
+		return nil, nil, nil
+	}
+	uprightFeatures := append(append([]ot.Feature{}, features...), ot.NewFeatureOn(ot.MakeTag('v', 'r', 't', '2')))
+	var atoms []font.Atom
+	shapeRun := func(run []rune, upright bool) {
+		if len(run) == 0 {
+			return
+		}
+		if upright {
+			atoms = append(atoms, fnt.ShapeDir(string(run), uprightFeatures, variations, ot.DirectionTTB)...)
+			return
+		}
+		for _, a := range fnt.ShapeDir(string(run), features, variations, ot.DirectionLTR) {
+			if !a.IsSpace {
+				a.YOffset -= (a.Height - a.Depth) / 2
+				a.Height = (a.Height + a.Depth) / 2
+				a.Depth = a.Height
+			}
+			atoms = append(atoms, a)
+		}
+	}
+	var run []rune
+	runUpright := false
+	for _, r := range str {
+		var upright bool
+		switch orient {
+		case TextOrientationUpright:
+			upright = true
+		case TextOrientationSideways:
+			upright = false
+		default:
+			// Spaces and marks belong to the current run.
+			upright = runUpright
+			if !unicode.IsSpace(r) && !unicode.Is(unicode.Mn, r) {
+				upright = isUprightRune(r)
+			}
+		}
+		if upright != runUpright {
+			shapeRun(run, runUpright)
+			run = run[:0]
+			runUpright = upright
+		}
+		run = append(run, r)
+	}
+	shapeRun(run, runUpright)
+	levels := make([]uint8, len(atoms))
+	fonts := make([]*font.Font, len(atoms))
+	for i := range fonts {
+		fonts[i] = fnt
+	}
+	return atoms, levels, fonts
+}
+
+// verticalParagraph turns the lines of the paragraph vl onto the page for
+// the vertical writing mode wm. The lines are set horizontally with the line
+// length as the width, so they become columns that run from top to bottom.
+// The first line is at the right side with WritingModeVerticalRL and at the
+// left side with WritingModeVerticalLR. The returned box has the line length
+// as its height.
+func verticalParagraph(vl *node.VList, wm WritingMode) (*node.VList, error) {
+	if wm == WritingModeVerticalLR {
+		var head node.Node
+		for n := vl.List; n != nil; {
+			next := n.Next()
+			n.SetPrev(nil)
+			n.SetNext(head)
+			if head != nil {
+				head.SetPrev(n)
+			}
+			head = n
+			n = next
+		}
+		vl.List = head
+	}
+	// Turning clockwise, the top of the paragraph becomes its right side and
+	// the start of the lines the top.
+	t, err := node.TransformBox(vl, node.RotateMatrix(-90).Multiply(node.TranslateMatrix(0, vl.Width)))
+	if err != nil {
+		return nil, err
+	}
+	ret := node.Vpack(t)
+	ret.Attributes = node.H{"origin": "vertical writing mode"}
+	return ret, nil
+}
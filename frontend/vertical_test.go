@@ -0,0 +1,82 @@
+package frontend
+
+import (
+	"io"
+	"testing"
+
+	"github.com/boxesandglue/boxesandglue/backend/bag"
+	"github.com/boxesandglue/boxesandglue/backend/node"
+)
+
+func TestVerticalParagraph(t *testing.T) {
+	for _, wm := range []WritingMode{WritingModeVerticalRL, WritingModeVerticalLR} {
+		first, second := footnoteBox(40*bag.Factor), footnoteBox(30*bag.Factor)
+		first.Depth = 2 * bag.Factor
+		node.InsertAfter(first, first, second)
+		vl := node.Vpack(first)
+		vl.Width = 50 * bag.Factor
+		ht, dp := vl.Height, vl.Depth
+
+		ret, err := verticalParagraph(vl, wm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret.Height+ret.Depth != 50*bag.Factor {
+			t.Errorf("%s: height %s, want the line length 50pt", wm, ret.Height+ret.Depth)
+		}
+		if ret.Width != ht+dp {
+			t.Errorf("%s: width %s, want %s", wm, ret.Width, ht+dp)
+		}
+		tr, ok := ret.List.(*node.Transform)
+		if !ok {
+			t.Fatalf("%s: got %T, want a transform", wm, ret.List)
+		}
+		// The first line is at the top of the list before the box is turned
+		// clockwise, so it ends up at the right.
+		wantTop := first
+		if wm == WritingModeVerticalLR {
+			wantTop = second
+		}
+		if got := tr.List.(*node.VList).List; got != wantTop {
+			t.Errorf("%s: wrong line order", wm)
+		}
+		// The top left corner of the lines is the top of the column.
+		x, y := tr.Matrix.Apply(0, vl.Height)
+		if x != tr.Width || y != tr.Height {
+			t.Errorf("%s: start of the first line at %s, %s, want %s, %s", wm, x, y, tr.Width, tr.Height)
+		}
+	}
+}
+
+func TestIsUprightRune(t *testing.T) {
+	for _, r := range "漢あア한ㄅ、。「ー１" {
+		if !isUprightRune(r) {
+			t.Errorf("isUprightRune(%q) = false, want true", r)
+		}
+	}
+	for _, r := range "A1,ᠮ" {
+		if isUprightRune(r) {
+			t.Errorf("isUprightRune(%q) = true, want false", r)
+		}
+	}
+}
+
+func TestFormatParagraphVertical(t *testing.T) {
+	fe, err := NewForWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("NewForWriter: %v", err)
+	}
+	te := NewText()
+	te.Settings[SettingWritingMode] = WritingModeVerticalRL
+	te.Items = append(te.Items, footnoteBox(20*bag.Factor))
+	vl, _, err := fe.FormatParagraph(te, 60*bag.Factor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vl.Height+vl.Depth != 60*bag.Factor {
+		t.Errorf("height %s, want 60pt", vl.Height+vl.Depth)
+	}
+	if _, ok := vl.List.(*node.Transform); !ok {
+		t.Errorf("got %T, want a transform", vl.List)
+	}
+}
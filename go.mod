@@ -17,3 +17,5 @@ require (
 	github.com/clipperhouse/stringish v0.1.1 // indirect
 	github.com/speedata/pdfdisassembler v0.0.7 // indirect
 )
+
+replace github.com/boxesandglue/baseline-pdf => ./third_party/baseline-pdf
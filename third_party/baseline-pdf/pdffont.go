@@ -0,0 +1,622 @@
+package pdf
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/textshape/ot"
+	"github.com/boxesandglue/textshape/subset"
+)
+
+// Face represents a font structure with no specific size. To get the dimensions
+// of a font, you need to create a Font object with a given size.
+type Face struct {
+	Shaper            *ot.Shaper
+	usedChar          map[int]bool
+	glyphComponents   map[int]string // old GID -> source runes (for ToUnicode of ligatures)
+	fontobject        *Object
+	pw                *PDF
+	face              *ot.Face
+	glyphMap          map[ot.GlyphID]ot.GlyphID // old GID -> new GID (set after subsetting)
+	VariationSettings map[string]float64        // axis tag -> value for variable fonts
+	Filename          string
+	PostscriptName    string
+	FaceID            int
+	Scale             float64
+	UnitsPerEM        int32
+}
+
+// RegisterChars marks the codepoints as used on the page. For font subsetting.
+//
+// Deprecated: use RegisterCodepoints instead.
+func (face *Face) RegisterChars(codepoints []int) {
+	face.RegisterCodepoints(codepoints)
+}
+
+// RegisterChar marks the codepoint as used on the page. For font subsetting.
+//
+// Deprecated: use RegisterCodepoint instead.
+func (face *Face) RegisterChar(codepoint int) {
+	face.RegisterCodepoint(codepoint)
+}
+
+// RegisterCodepoints marks the codepoints as used on the page. For font subsetting.
+func (face *Face) RegisterCodepoints(codepoints []int) {
+	face.usedChar[0] = true
+	for _, v := range codepoints {
+		face.usedChar[v] = true
+	}
+}
+
+// RegisterCodepoint marks the codepoint as used on the page. For font subsetting.
+func (face *Face) RegisterCodepoint(codepoint int) {
+	face.usedChar[0] = true
+	face.usedChar[codepoint] = true
+}
+
+// RegisterGlyph marks the glyph as used on the page and records the source
+// runes the glyph came from. The components string allows the ToUnicode CMap
+// to recover the original text for glyphs without a direct cmap entry (typical
+// for OpenType ligatures like fi/fl), so copy-paste yields the original
+// characters instead of U+FFFD.
+func (face *Face) RegisterGlyph(glyphID int, components string) {
+	face.usedChar[0] = true
+	face.usedChar[glyphID] = true
+	if components != "" {
+		face.glyphComponents[glyphID] = components
+	}
+}
+
+func fillFaceObject(otFace *ot.Face, pw *PDF) (*Face, error) {
+	shaper, err := ot.NewShaper(otFace.Font)
+	if err != nil {
+		return nil, err
+	}
+
+	face := Face{
+		FaceID:          pw.nextID(),
+		UnitsPerEM:      int32(otFace.Upem()),
+		Shaper:          shaper,
+		PostscriptName:  otFace.PostscriptName(),
+		usedChar:        make(map[int]bool),
+		glyphComponents: make(map[int]string),
+		Scale:           1.0,
+		face:            otFace,
+	}
+
+	return &face, nil
+}
+
+// NewFaceFromData returns a Face object which is a representation of a font file.
+func (pw *PDF) NewFaceFromData(data []byte, idx int) (*Face, error) {
+	font, err := ot.ParseFont(data, idx)
+	if err != nil {
+		return nil, err
+	}
+	otFace, err := ot.NewFace(font)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fillFaceObject(otFace, pw)
+	if err != nil {
+		return nil, err
+	}
+	f.Filename = "(embedded)"
+	f.pw = pw
+	f.fontobject = pw.NewObject()
+	return f, nil
+}
+
+// LoadFace loads a font from the disc. The index specifies the sub font to be loaded.
+func (pw *PDF) LoadFace(filename string, idx int) (*Face, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	Logger.Info("Load font", "filename", filename)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	font, err := ot.ParseFont(data, idx)
+	if err != nil {
+		return nil, err
+	}
+	otFace, err := ot.NewFace(font)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fillFaceObject(otFace, pw)
+	if err != nil {
+		return nil, err
+	}
+	f.pw = pw
+	f.fontobject = pw.NewObject()
+	f.Filename = filename
+	return f, nil
+}
+
+// InternalName returns a PDF usable name such as /F1
+func (face *Face) InternalName() string {
+	return fmt.Sprintf("/F%d", face.FaceID)
+}
+
+// Codepoint tries to find the code point for r. If none found, 0 is returned.
+func (face *Face) Codepoint(r rune) int {
+	cmap := face.face.Cmap()
+	if cmap == nil {
+		return 0
+	}
+	if gid, ok := cmap.Lookup(ot.Codepoint(r)); ok {
+		return int(gid)
+	}
+	return 0
+}
+
+// Codepoints returns the internal code points for the runes.
+func (face *Face) Codepoints(runes []rune) []int {
+	cmap := face.face.Cmap()
+	if cmap == nil {
+		return nil
+	}
+	ret := make([]int, 0, len(runes))
+	for _, r := range runes {
+		if gid, ok := cmap.Lookup(ot.Codepoint(r)); ok {
+			ret = append(ret, int(gid))
+		}
+	}
+	return ret
+}
+
+// AdvanceWidth returns the advance width of the glyph with the given ID
+// in PDF text space units (1/1000 of text space, scaled by face.Scale).
+func (face *Face) AdvanceWidth(glyphID int) float64 {
+	adv := face.face.HorizontalAdvance(ot.GlyphID(glyphID))
+	return float64(adv) / float64(face.UnitsPerEM) * face.Scale
+}
+
+// OTFace returns the underlying ot.Face for direct access.
+func (face *Face) OTFace() *ot.Face {
+	return face.face
+}
+
+// MapGlyph maps an old glyph ID to the new glyph ID after compact subsetting.
+// Only useful after calling CompactSubset().
+// If compact subsetting is not used, returns the original ID unchanged.
+func (face *Face) MapGlyph(oldGID int) int {
+	if face.glyphMap == nil {
+		return oldGID
+	}
+	if newGID, ok := face.glyphMap[ot.GlyphID(oldGID)]; ok {
+		return int(newGID)
+	}
+	return oldGID
+}
+
+// CompactSubset enables compact glyph mapping for smaller font files.
+// When called, glyph IDs are renumbered (0, 1, 2, ...) instead of keeping
+// the original positions. Use MapGlyph() to convert old GIDs to new GIDs
+// when writing content streams.
+// Must be called after RegisterCodepoints() and before creating content streams.
+func (face *Face) CompactSubset() error {
+	if face.glyphMap != nil {
+		return nil // already prepared
+	}
+
+	// Collect glyphs to subset (old GIDs). Sort so the resulting
+	// subset plan (and hence the new GID assignments in glyphMap) is
+	// reproducible across runs — Go map iteration is intentionally
+	// randomised.
+	oldGlyphs := make([]ot.GlyphID, 0, len(face.usedChar))
+	for g := range face.usedChar {
+		oldGlyphs = append(oldGlyphs, ot.GlyphID(g))
+	}
+	slices.Sort(oldGlyphs)
+
+	// Create subset input
+	input := subset.NewInput()
+	input.Flags = subset.FlagDropLayoutTables
+	for _, gid := range oldGlyphs {
+		input.AddGlyph(gid)
+	}
+
+	// Create plan and get glyph map
+	plan, err := subset.CreatePlan(face.face.Font, input)
+	if err != nil {
+		return err
+	}
+
+	face.glyphMap = plan.GlyphMap()
+	return nil
+}
+
+// --- PDF formatting helpers ---
+
+// subsetTag generates a 6-character subset tag.
+// It hashes the glyph IDs and variation settings to ensure unique tags
+// for different subsets of the same font with different variations.
+func subsetTag(glyphs []ot.GlyphID, variations map[string]float64) string {
+	sorted := make([]ot.GlyphID, len(glyphs))
+	copy(sorted, glyphs)
+	slices.Sort(sorted)
+
+	data := make([]byte, len(sorted)*2)
+	for i, g := range sorted {
+		data[i*2] = byte((g >> 8) & 0xff)
+		data[i*2+1] = byte(g & 0xff)
+	}
+
+	// Include variation settings in the hash for unique tags per variation
+	if len(variations) > 0 {
+		keys := make([]string, 0, len(variations))
+		for k := range variations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			data = append(data, fmt.Appendf(nil, "%s:%.2f", k, variations[k])...)
+		}
+	}
+
+	sum := md5.Sum(data)
+	ret := make([]rune, 6)
+	for i := range 6 {
+		ret[i] = rune(sum[2*i]+sum[2*i+1])%26 + 'A'
+	}
+	return string(ret)
+}
+
+// fontNamePDF returns the PDF font name with subset tag.
+func fontNamePDF(f *ot.Face, tag string) string {
+	psName := f.PostscriptName()
+	if psName == "" {
+		psName = "Unknown"
+	}
+	if tag != "" {
+		return fmt.Sprintf("/%s+%s", tag, psName)
+	}
+	return "/" + psName
+}
+
+// bboxPDF returns the font bounding box as PDF string.
+func bboxPDF(f *ot.Face) string {
+	xMin, yMin, xMax, yMax := f.BBox()
+	return fmt.Sprintf("[%d %d %d %d]", xMin, yMin, xMax, yMax)
+}
+
+// flagsPDF returns the PDF font flags.
+func flagsPDF(f *ot.Face) int {
+	flags := 32 // Nonsymbolic (bit 6) — required for non-symbol fonts
+	if f.IsFixedPitch() {
+		flags |= 1 // FixedPitch (bit 1)
+	}
+	if f.IsItalic() {
+		flags |= 64 // Italic (bit 7)
+	}
+	return flags
+}
+
+// stemVPDF estimates StemV based on weight.
+func stemVPDF(f *ot.Face) int {
+	weight := f.WeightClass()
+	if weight >= 700 {
+		return 140
+	} else if weight >= 500 {
+		return 100
+	}
+	return 80
+}
+
+// widthsPDF returns PDF width array for glyphs.
+// newGlyphs contains the new (post-subset) glyph IDs.
+// reverseMap maps new GID -> old GID for looking up widths in the original font.
+func widthsPDF(f *ot.Face, newGlyphs []ot.GlyphID, reverseMap map[ot.GlyphID]ot.GlyphID) string {
+	if len(newGlyphs) == 0 {
+		return "[]"
+	}
+
+	// Scale: for CFF fonts the units are typically 1000, for TrueType we scale
+	scale := 1.0
+	if !f.IsCFF() {
+		scale = float64(f.Upem()) / 1000.0
+	}
+
+	getWd := func(newGID ot.GlyphID) string {
+		oldGID := reverseMap[newGID]
+		advance := f.HorizontalAdvance(oldGID)
+		return strconv.FormatFloat(float64(advance)/scale, 'f', -1, 64)
+	}
+
+	// Sort glyphs for consistent output
+	sorted := make([]ot.GlyphID, len(newGlyphs))
+	copy(sorted, newGlyphs)
+	slices.Sort(sorted)
+
+	var b strings.Builder
+	b.WriteString("[")
+	c := 0
+	for c < len(sorted) {
+		cp := sorted[c]
+		writeInt(&b, int(cp))
+		b.WriteByte('[')
+		b.WriteString(getWd(cp))
+		c++
+		for c < len(sorted) && sorted[c] == cp+1 {
+			cp++
+			b.WriteByte(' ')
+			b.WriteString(getWd(cp))
+			c++
+		}
+		b.WriteString("]")
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// cmapPDF returns PDF ToUnicode CMap for glyphs.
+// newGlyphs contains the new (post-subset) glyph IDs.
+// reverseMap maps new GID -> old GID for looking up Unicode in the original font.
+// components maps old GID -> source runes recorded at shape time, used to
+// recover the original text for glyphs without a direct cmap entry (e.g.
+// fi/fl ligatures produced by OpenType substitution).
+func cmapPDF(f *ot.Face, newGlyphs []ot.GlyphID, reverseMap map[ot.GlyphID]ot.GlyphID, components map[int]string) string {
+	if len(newGlyphs) == 0 {
+		return ""
+	}
+
+	// Build old glyph to unicode mapping from original font
+	var glyphToUnicode map[ot.GlyphID]rune
+	if cmap := f.Cmap(); cmap != nil {
+		glyphToUnicode = cmap.CollectReverseMapping()
+	} else {
+		glyphToUnicode = make(map[ot.GlyphID]rune)
+	}
+
+	// Find max new glyph ID
+	maxGlyph := ot.GlyphID(0)
+	for _, gid := range newGlyphs {
+		if gid > maxGlyph {
+			maxGlyph = gid
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo << /Registry (Adobe)/Ordering (UCS)/Supplement 0>> def
+/CMapName /Adobe-Identity-UCS def /CMapType 2 def
+1 begincodespacerange
+`)
+	b.WriteString("<0001><")
+	writeHex4Upper(&b, uint16(maxGlyph+1))
+	b.WriteString(">\nendcodespacerange\n")
+	writeInt(&b, len(newGlyphs))
+	b.WriteString(" beginbfchar\n")
+	for _, newGID := range newGlyphs {
+		oldGID := reverseMap[newGID]
+		b.WriteByte('<')
+		writeHex4Upper(&b, uint16(newGID))
+		b.WriteString("><")
+		if src, ok := components[int(oldGID)]; ok && src != "" {
+			// Components recorded at shape time — emit the full UTF-16BE
+			// sequence so ligatures and multi-rune clusters round-trip.
+			writeUTF16BEHex(&b, src)
+		} else if r := glyphToUnicode[oldGID]; r != 0 {
+			writeUTF16BEHex(&b, string(r))
+		} else {
+			writeHex4Upper(&b, 0xFFFD)
+		}
+		b.WriteString(">\n")
+	}
+	b.WriteString(`endbfchar
+endcmap CMapName currentdict /CMap defineresource pop end end`)
+	return b.String()
+}
+
+// writeUTF16BEHex appends the UTF-16BE hex encoding of s to b. Runes outside
+// the BMP are emitted as surrogate pairs. The PDF ToUnicode bfchar entry
+// expects this encoding for multi-codepoint mappings (PDF 1.7 §9.10.3).
+func writeUTF16BEHex(b *strings.Builder, s string) {
+	for _, r := range s {
+		if r <= 0xFFFF {
+			writeHex4Upper(b, uint16(r))
+		} else {
+			r -= 0x10000
+			hi := uint16(0xD800 + (r >> 10))
+			lo := uint16(0xDC00 + (r & 0x3FF))
+			writeHex4Upper(b, hi)
+			writeHex4Upper(b, lo)
+		}
+	}
+}
+
+// finish writes the font file to the PDF.
+func (face *Face) finish() error {
+	var err error
+	pdfwriter := face.pw
+	Logger.Info("Write font to PDF", "filename", face.Filename, "psname", face.PostscriptName)
+
+	// Collect glyphs to subset (old GIDs). Sort so subset.CreatePlan
+	// sees the same order across runs; Go map iteration is randomised.
+	oldGlyphs := make([]ot.GlyphID, 0, len(face.usedChar))
+	for g := range face.usedChar {
+		oldGlyphs = append(oldGlyphs, ot.GlyphID(g))
+	}
+	slices.Sort(oldGlyphs)
+
+	// Check if CompactSubset was called
+	// If not, use FlagRetainGIDs so old GIDs in content streams still work
+	useCompactMapping := face.glyphMap != nil
+
+	// Create subset input
+	input := subset.NewInput()
+	input.Flags = subset.FlagDropLayoutTables
+	if !useCompactMapping {
+		input.Flags |= subset.FlagRetainGIDs
+	}
+	for _, gid := range oldGlyphs {
+		input.AddGlyph(gid)
+	}
+
+	// Apply variation settings for instancing (creates static font from variable).
+	// Pin axes in sorted-tag order so the resulting instance is byte-stable.
+	if len(face.VariationSettings) > 0 {
+		Logger.Debug("Applying variation settings for instancing", "variations", face.VariationSettings)
+	}
+	variationKeys := make([]string, 0, len(face.VariationSettings))
+	for tag := range face.VariationSettings {
+		variationKeys = append(variationKeys, tag)
+	}
+	sort.Strings(variationKeys)
+	for _, tag := range variationKeys {
+		value := face.VariationSettings[tag]
+		input.PinAxisLocation(ot.MakeTag(tag[0], tag[1], tag[2], tag[3]), float32(value))
+	}
+
+	// Subset the font.
+	plan, err := subset.CreatePlan(face.face.Font, input)
+	if err != nil {
+		return err
+	}
+	subsetData, err := plan.Execute()
+	if err != nil {
+		return err
+	}
+
+	// Build glyph list and reverse map for PDF tables
+	var newGlyphs []ot.GlyphID
+	var reverseMap map[ot.GlyphID]ot.GlyphID
+
+	if useCompactMapping {
+		// Use the pre-computed glyph map from CompactSubset. Sort the
+		// new-GID slice so the downstream PDF tables (widthsPDF —
+		// already re-sorts but starts from this same slice — and
+		// cmapPDF — does NOT re-sort) emit their entries in a
+		// reproducible order. Go map iteration would otherwise scramble
+		// the ToUnicode CMap layout between runs.
+		newGlyphs = make([]ot.GlyphID, 0, len(face.glyphMap))
+		reverseMap = make(map[ot.GlyphID]ot.GlyphID)
+		for oldGID, newGID := range face.glyphMap {
+			newGlyphs = append(newGlyphs, newGID)
+			reverseMap[newGID] = oldGID
+		}
+		slices.Sort(newGlyphs)
+	} else {
+		// With FlagRetainGIDs, old GID == new GID (identity mapping)
+		newGlyphs = oldGlyphs
+		reverseMap = make(map[ot.GlyphID]ot.GlyphID)
+		for _, gid := range oldGlyphs {
+			reverseMap[gid] = gid
+		}
+	}
+
+	// Generate subset tag using old GIDs and variations for consistency
+	tag := subsetTag(oldGlyphs, face.VariationSettings)
+
+	fontstream := pdfwriter.NewObject()
+
+	isCFF := face.face.IsCFF()
+
+	if isCFF {
+		// For CFF fonts, PDF needs only the raw CFF table data,
+		// not the full SFNT/OTF file
+		subsetFont, err := ot.ParseFont(subsetData, 0)
+		if err != nil {
+			return fmt.Errorf("failed to parse subset font: %w", err)
+		}
+		cffData, err := subsetFont.TableData(ot.TagCFF)
+		if err != nil {
+			return fmt.Errorf("failed to get CFF table from subset: %w", err)
+		}
+		fontstream.Data.Write(cffData)
+	} else {
+		// For TrueType fonts, PDF needs the full SFNT file
+		fontstream.Data.Write(subsetData)
+	}
+	// PDF 1.7 §9.9 (Table 127): Length1 is the uncompressed length of
+	// the embedded font program. It is only specified for /FontFile
+	// (Type 1) and /FontFile2 (TrueType). /FontFile3 (CFF) omits it
+	// in favour of /Subtype. Set it explicitly here — Save() does not
+	// guess at stream semantics.
+	uncompressedLen := fontstream.Data.Len()
+	fontstream.SetCompression(9)
+
+	fontstream.Dictionary = Dict{}
+	if isCFF {
+		fontstream.Dictionary["/Subtype"] = "/CIDFontType0C"
+	} else {
+		fontstream.Dictionary["Length1"] = strconv.Itoa(uncompressedLen)
+	}
+	if err = fontstream.Save(); err != nil {
+		return err
+	}
+
+	// Font descriptor using raw metrics from ot.Face
+	f := face.face
+	fontDescriptor := Dict{
+		"Type":        "/FontDescriptor",
+		"FontName":    fontNamePDF(f, tag),
+		"FontBBox":    bboxPDF(f),
+		"Ascent":      strconv.Itoa(int(f.Ascender())),
+		"Descent":     strconv.Itoa(int(f.Descender())),
+		"CapHeight":   strconv.Itoa(int(f.CapHeight())),
+		"Flags":       strconv.Itoa(flagsPDF(f)),
+		"ItalicAngle": strconv.Itoa(int(f.ItalicAngle() >> 16)),
+		"StemV":       strconv.Itoa(stemVPDF(f)),
+		"XHeight":     strconv.Itoa(int(f.XHeight())),
+	}
+	if isCFF {
+		fontDescriptor["FontFile3"] = fontstream.ObjectNumber.Ref()
+	} else {
+		fontDescriptor["FontFile2"] = fontstream.ObjectNumber.Ref()
+	}
+
+	fontDescriptorObj := face.pw.NewObject()
+	fdd := fontDescriptorObj.Dict(fontDescriptor)
+	fdd.Save()
+
+	cmapStr := cmapPDF(f, newGlyphs, reverseMap, face.glyphComponents)
+	cmapObj := pdfwriter.NewObject()
+	cmapObj.Data.WriteString(cmapStr)
+	if err = cmapObj.Save(); err != nil {
+		return err
+	}
+
+	cidFontType2 := Dict{
+		"BaseFont":       fontNamePDF(f, tag),
+		"CIDSystemInfo":  `<< /Ordering (Identity) /Registry (Adobe) /Supplement 0 >>`,
+		"FontDescriptor": fontDescriptorObj.ObjectNumber.Ref(),
+		"Type":           "/Font",
+		"W":              widthsPDF(f, newGlyphs, reverseMap),
+	}
+
+	if isCFF {
+		cidFontType2["Subtype"] = "/CIDFontType0"
+	} else {
+		cidFontType2["Subtype"] = "/CIDFontType2"
+		cidFontType2["CIDToGIDMap"] = "/Identity"
+	}
+	cidFontType2Obj := face.pw.NewObject()
+	d := cidFontType2Obj.Dict(cidFontType2)
+	d.Save()
+
+	fontObj := face.fontobject
+	fontObj.Dict(Dict{
+		"BaseFont":        fontNamePDF(f, tag),
+		"DescendantFonts": "[" + cidFontType2Obj.ObjectNumber.Ref() + "]",
+		"Encoding":        "/Identity-H",
+		"Subtype":         "/Type0",
+		"ToUnicode":       cmapObj.ObjectNumber.Ref(),
+		"Type":            "/Font",
+	})
+	fontObj.Save()
+	return nil
+}
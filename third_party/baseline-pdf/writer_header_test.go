@@ -0,0 +1,48 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewPDFWriterWritesHeader(t *testing.T) {
+	var buf bytes.Buffer
+	pw := NewPDFWriter(&buf)
+	// Minimal PDF content
+	obj := pw.NewObject()
+	obj.Data.WriteString("BT /F1 12 Tf ET")
+	_ = pw.AddPage(obj, 0)
+	if err := pw.FinishAndClose(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	out := buf.Bytes()
+	if len(out) == 0 || out[0] != '%' || !bytes.Contains(out, []byte("xref")) || !bytes.Contains(out, []byte("trailer")) {
+		t.Fatalf("output does not look like a PDF:\n%s", string(out[:min(200, len(out))]))
+	}
+}
+
+func TestPageExtGStates(t *testing.T) {
+	var buf bytes.Buffer
+	pw := NewPDFWriter(&buf)
+	gs := pw.NewObject()
+	gs.Dict(Dict{"Type": "/ExtGState", "ca": "0.5"})
+	if err := gs.Save(); err != nil {
+		t.Fatal(err)
+	}
+	obj := pw.NewObject()
+	obj.Data.WriteString("/GS1 gs")
+	page := pw.AddPage(obj, 0)
+	page.ExtGStates = map[Name]*Object{"GS1": gs}
+	if err := pw.FinishAndClose(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	out := buf.String()
+	idx := strings.Index(out, "/ExtGState <<")
+	if idx < 0 {
+		t.Fatalf("page resources have no /ExtGState entry:\n%s", out)
+	}
+	if want := "/GS1 " + gs.ObjectNumber.Ref(); !strings.Contains(out[idx:], want) {
+		t.Errorf("/ExtGState does not contain %q", want)
+	}
+}